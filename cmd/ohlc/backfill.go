@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dneprix/ohlc/pkg/assets"
+	"github.com/dneprix/ohlc/pkg/backfills"
+	"github.com/dneprix/ohlc/pkg/downloaders"
+)
+
+// runBackfill downloads asset history by asset downloader, e.g. default asset
+// BTC/USD/KRAKEN (Kraken exchange market) is downloaded by CRYPTOWAT downloader:
+// ohlc backfill --asset BTC/USD/KRAKEN --period 60 --from 2019-01-01 --to 2019-06-01
+func runBackfill(logger *logrus.Logger, args []string) {
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	rangeFlags := newAssetRangeFlags(flags)
+	pageSize := flags.Uint("page", 500, "Candles requested by one page")
+	flags.Parse(args)
+	fromUnix, toUnix := rangeFlags.closeTimes(logger)
+
+	db := openDB(logger)
+	defer db.Close()
+
+	// Stop backfill on termination signal. Progress of saved pages is kept
+	ctx, cancel := signalContext(logger)
+	defer cancel()
+
+	asset, err := assets.GetByName(ctx, db, *rangeFlags.asset)
+	if err != nil {
+		logger.Fatalf("Get DB asset %s fail: %s", *rangeFlags.asset, err)
+	}
+	d, err := findRangeDownloader(newDownloaders(db, logger), asset.Downloader)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	if err := backfill(ctx, db, d, asset, *rangeFlags.period, fromUnix, toUnix, *pageSize); err != nil {
+		logger.Fatal(err)
+	}
+}
+
+// backfill starts or resumes stored backfill of asset range
+func backfill(ctx context.Context, db *sqlx.DB, d downloaders.RangeDownloader, asset *assets.Asset, period uint, fromUnix, toUnix int64, pageSize uint) error {
+	b, err := backfills.Start(ctx, db, asset.ID, period, fromUnix, toUnix)
+	if err != nil {
+		return fmt.Errorf("Start backfill fail: %s", err)
+	}
+	if b.Cursor != b.ToTime && !b.Done {
+		assets.Logger(d.Logger(), asset).Infof("Resume backfill: to=%s cursor=%s", formatUnix(b.ToTime), formatUnix(b.Cursor))
+	}
+	if err := downloaders.ProcessBackfill(ctx, d, asset, b, pageSize); err != nil {
+		return fmt.Errorf("Backfill fail: %s", err)
+	}
+	return nil
+}
+
+// findRangeDownloader by name
+func findRangeDownloader(list []downloaders.Downloader, name string) (downloaders.RangeDownloader, error) {
+	for _, d := range list {
+		if d.Name() != name {
+			continue
+		}
+		rd, ok := d.(downloaders.RangeDownloader)
+		if !ok {
+			return nil, fmt.Errorf("Downloader %s doesn't support ranges", name)
+		}
+		return rd, nil
+	}
+	return nil, fmt.Errorf("Unknown downloader: %s", name)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// assetRangeFlags are flags of commands working with asset history
+type assetRangeFlags struct {
+	flags  *flag.FlagSet
+	asset  *string
+	period *uint
+	from   *string
+	to     *string
+}
+
+// newAssetRangeFlags defines asset, period, from and to flags
+func newAssetRangeFlags(flags *flag.FlagSet) *assetRangeFlags {
+	return &assetRangeFlags{
+		flags:  flags,
+		asset:  flags.String("asset", "", "Asset name in FROM/TO/EXCHANGE format"),
+		period: flags.Uint("period", 0, "Candles period in seconds"),
+		from:   flags.String("from", "", "Earliest close time: 2006-01-02 or RFC3339"),
+		to:     flags.String("to", "", "Latest close time: 2006-01-02 or RFC3339 (default now)"),
+	}
+}
+
+// closeTimes returns range of close times aligned to period
+func (f *assetRangeFlags) closeTimes(logger *logrus.Logger) (int64, int64) {
+	if *f.asset == "" || *f.period == 0 || *f.from == "" {
+		f.flags.Usage()
+		os.Exit(2)
+	}
+	fromTime, err := parseTime(*f.from)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	toTime := time.Now()
+	if *f.to != "" {
+		if toTime, err = parseTime(*f.to); err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	period := int64(*f.period)
+	fromUnix := ceilUnix(fromTime.Unix(), period)
+	toUnix := toTime.Unix() - toTime.Unix()%period
+	if fromUnix > toUnix {
+		logger.Fatalf("Range is empty: from=%s to=%s", *f.from, *f.to)
+	}
+	return fromUnix, toUnix
+}
+
+// parseTime in UTC from date or RFC3339 format
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Parse time fail: %q", value)
+	}
+	return t.UTC(), nil
+}
+
+// ceilUnix rounds unix time up to period
+func ceilUnix(t, period int64) int64 {
+	if rem := t % period; rem != 0 {
+		return t + period - rem
+	}
+	return t
+}
+
+// formatUnix time in RFC3339 UTC format
+func formatUnix(t int64) string {
+	return time.Unix(t, 0).UTC().Format(time.RFC3339)
+}
+
+// signalContext is cancelled on termination signal
+func signalContext(logger *logrus.Logger) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case s := <-signals:
+			logger.Warnf("Receive signal: %s", s)
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+	return ctx, cancel
+}
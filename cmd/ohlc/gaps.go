@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/dneprix/ohlc/pkg/assets"
+	"github.com/dneprix/ohlc/pkg/candles"
+)
+
+// runGaps reports missing asset candles and optionally backfills them, e.g.
+// ohlc gaps --asset BTC/USD/KRAKEN --period 60 --from 2019-01-01 --backfill
+func runGaps(logger *logrus.Logger, args []string) {
+	flags := flag.NewFlagSet("gaps", flag.ExitOnError)
+	rangeFlags := newAssetRangeFlags(flags)
+	withBackfill := flags.Bool("backfill", false, "Backfill missing candles through asset downloader")
+	pageSize := flags.Uint("page", 500, "Candles requested by one backfill page")
+	flags.Parse(args)
+	fromUnix, toUnix := rangeFlags.closeTimes(logger)
+	period := *rangeFlags.period
+
+	db := openDB(logger)
+	defer db.Close()
+
+	ctx, cancel := signalContext(logger)
+	defer cancel()
+
+	asset, err := assets.GetByName(ctx, db, *rangeFlags.asset)
+	if err != nil {
+		logger.Fatalf("Get DB asset %s fail: %s", *rangeFlags.asset, err)
+	}
+	assetLogger := assets.Logger(logrus.NewEntry(logger), asset).WithField("period", period)
+
+	gaps, err := candles.FindGaps(ctx, db, asset.ID, period, fromUnix, toUnix)
+	if err != nil {
+		logger.Fatalf("Find candles gaps fail: %s", err)
+	}
+	missing := int64(0)
+	for _, gap := range gaps {
+		missing += gap.Missing(period)
+		assetLogger.Warnf("Gap: from=%s to=%s missing=%d", formatUnix(gap.From), formatUnix(gap.To), gap.Missing(period))
+	}
+	assetLogger.Infof("Found gaps: %d missing=%d", len(gaps), missing)
+
+	if !*withBackfill || len(gaps) == 0 {
+		return
+	}
+	d, err := findRangeDownloader(newDownloaders(db, logger), asset.Downloader)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	for _, gap := range gaps {
+		if err := backfill(ctx, db, d, asset, period, gap.From, gap.To, *pageSize); err != nil {
+			logger.Fatal(err)
+		}
+	}
+}
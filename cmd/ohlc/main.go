@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -13,18 +14,46 @@ import (
 	"github.com/golang-migrate/migrate/database/postgres"
 	_ "github.com/golang-migrate/migrate/source/file"
 
+	"github.com/dneprix/ohlc/pkg/candles"
+	"github.com/dneprix/ohlc/pkg/credentials"
 	"github.com/dneprix/ohlc/pkg/downloaders"
-	"github.com/dneprix/ohlc/pkg/schedulers"
+	"github.com/dneprix/ohlc/pkg/limiters"
+	"github.com/dneprix/ohlc/pkg/validators"
 )
 
 func main() {
-	// Setup logger
+	logger := newLogger()
+
+	// Run service without command
+	if len(os.Args) < 2 {
+		runService(logger)
+		return
+	}
+
+	switch os.Args[1] {
+	case "backfill":
+		runBackfill(logger, os.Args[2:])
+	case "gaps":
+		runGaps(logger, os.Args[2:])
+	case "resample":
+		runResample(logger, os.Args[2:])
+	default:
+		logger.Fatalf("Unknown command: %q", os.Args[1])
+	}
+}
+
+// newLogger setups logger
+func newLogger() *logrus.Logger {
 	logger := logrus.New()
 	logger.SetLevel(logrus.DebugLevel)
 	logger.SetFormatter(&logrus.TextFormatter{
 		FullTimestamp: true,
 	})
+	return logger
+}
 
+// openDB connects to DB and applies migrations
+func openDB(logger *logrus.Logger) *sqlx.DB {
 	// DB connection
 	dbConnection := os.Getenv("DB_CONNECTION")
 	db, err := sqlx.Open("postgres", dbConnection)
@@ -33,7 +62,6 @@ func main() {
 	}
 	db.SetMaxIdleConns(50)
 	db.SetConnMaxLifetime(time.Second * 5)
-	defer db.Close()
 
 	// DB migrate
 	dbMigrationsPath := os.Getenv("DB_MIGRATIONS_PATH")
@@ -47,14 +75,120 @@ func main() {
 	}
 	m.Up()
 
-	// Initialise scheduler
-	scheduler := schedulers.NewSheduler(logger)
+	return db
+}
 
-	// Add downloaders to scheduler
-	scheduler.Add(downloaders.NewCryptowatDownloader(db, logger))
-	scheduler.Add(downloaders.NewKrakenDownloader(db, logger))
-	scheduler.Add(downloaders.NewCryptocompareDownloader(db, logger))
+// newDownloaders creates all downloaders configured by env
+func newDownloaders(db *sqlx.DB, logger *logrus.Logger) []downloaders.Downloader {
+	// Candles conflict policy
+	conflictPolicy, err := candles.ParseConflictPolicy(os.Getenv("CANDLES_CONFLICT_POLICY"))
+	if err != nil {
+		logger.Fatal(err)
+	}
 
-	// Run scheduler
-	scheduler.Run()
+	// Timeframes resampled from saved candles, e.g. CANDLES_RESAMPLE=5m,15m,1h,4h,1d
+	timeframes, err := candles.ParseTimeframes(os.Getenv("CANDLES_RESAMPLE"))
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	// Rate limiter shared by downloaders with the same limit key.
+	// RATE_LIMITER=postgres shares limits between service instances
+	var limiter limiters.Limiter
+	switch os.Getenv("RATE_LIMITER") {
+	case "", "memory":
+		limiter = limiters.NewMemory()
+	case "postgres":
+		limiter = limiters.NewPostgres(db)
+	default:
+		logger.Fatalf("Unknown rate limiter: %q", os.Getenv("RATE_LIMITER"))
+	}
+
+	// Optional JSON secrets file with API credentials by downloader name, e.g. SECRETS_FILE=/run/secrets/ohlc.json
+	secrets := credentials.Store{}
+	if path := os.Getenv("SECRETS_FILE"); path != "" {
+		if secrets, err = credentials.LoadFile(path); err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	list := []downloaders.Downloader{
+		downloaders.NewCryptowatDownloader(db, logger),
+		downloaders.NewKrakenDownloader(db, logger),
+		downloaders.NewCryptocompareDownloader(db, logger),
+	}
+	for _, d := range list {
+		d.SetConflictPolicy(conflictPolicy)
+		d.SetTimeframes(timeframes)
+		d.SetLimiter(limiter)
+
+		// Optional validation actions, e.g. CANDLES_VALIDATION=aligned-close-time=warn,high-low=reject
+		validator := validators.Default()
+		if err := validator.SetActions(os.Getenv("CANDLES_VALIDATION")); err != nil {
+			logger.Fatal(err)
+		}
+		d.SetValidator(validator)
+
+		// Optional downloader interval, e.g. CRYPTOWAT_INTERVAL=5m
+		if interval := os.Getenv(d.Name() + "_INTERVAL"); interval != "" {
+			duration, err := time.ParseDuration(interval)
+			if err != nil {
+				logger.Fatalf("Parse %s interval fail: %s", d.Name(), err)
+			}
+			d.SetInterval(duration)
+		}
+
+		// Optional concurrent asset downloads in one pass, e.g. CRYPTOCOMPARE_CONCURRENCY=4
+		if concurrency := os.Getenv(d.Name() + "_CONCURRENCY"); concurrency != "" {
+			n, err := strconv.ParseUint(concurrency, 10, 8)
+			if err != nil || n == 0 {
+				logger.Fatalf("Parse %s concurrency fail: %q", d.Name(), concurrency)
+			}
+			d.SetConcurrency(int(n))
+		}
+
+		// Optional rate limit, e.g. CRYPTOWAT_RATE=10/1m CRYPTOWAT_BURST=5 CRYPTOWAT_LIMIT_KEY=api.cryptowat.ch
+		rate := d.Rate()
+		if spec := os.Getenv(d.Name() + "_RATE"); spec != "" {
+			if rate, err = limiters.ParseRate(spec); err != nil {
+				logger.Fatalf("Parse %s rate fail: %s", d.Name(), err)
+			}
+		}
+		if burst := os.Getenv(d.Name() + "_BURST"); burst != "" {
+			n, err := strconv.ParseUint(burst, 10, 16)
+			if err != nil || n == 0 {
+				logger.Fatalf("Parse %s burst fail: %q", d.Name(), burst)
+			}
+			rate.Burst = int(n)
+		}
+		d.SetRate(rate)
+		if key := os.Getenv(d.Name() + "_LIMIT_KEY"); key != "" {
+			d.SetLimitKey(key)
+		}
+
+		// Optional HTTP request attempt timeout and retries, e.g. KRAKEN_HTTP_TIMEOUT=5s KRAKEN_HTTP_RETRIES=5
+		if timeout := os.Getenv(d.Name() + "_HTTP_TIMEOUT"); timeout != "" {
+			duration, err := time.ParseDuration(timeout)
+			if err != nil {
+				logger.Fatalf("Parse %s HTTP timeout fail: %s", d.Name(), err)
+			}
+			d.HTTPClient().SetTimeout(duration)
+		}
+		if retries := os.Getenv(d.Name() + "_HTTP_RETRIES"); retries != "" {
+			n, err := strconv.ParseUint(retries, 10, 8)
+			if err != nil {
+				logger.Fatalf("Parse %s HTTP retries fail: %s", d.Name(), err)
+			}
+			d.HTTPClient().SetRetries(int(n))
+		}
+
+		// Optional API credentials, e.g. CRYPTOWAT_API_KEY=... or KRAKEN_API_KEY=... KRAKEN_API_SECRET=...
+		if c, ok := secrets.Lookup(d.Name(), os.Getenv); ok {
+			if err := d.SetCredentials(c); err != nil {
+				logger.Fatal(err)
+			}
+			logger.Infof("Authorize %s requests: %s", d.Name(), c.WithDefaults(d.AuthDefaults()))
+		}
+	}
+	return list
 }
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/dneprix/ohlc/pkg/assets"
+	"github.com/dneprix/ohlc/pkg/candles"
+)
+
+// runResample resamples stored asset candles into higher timeframes, e.g.
+// ohlc resample --asset BTC/USD/KRAKEN --period 60 --timeframes 5m,1h,1d+8h --from 2019-01-01
+func runResample(logger *logrus.Logger, args []string) {
+	flags := flag.NewFlagSet("resample", flag.ExitOnError)
+	rangeFlags := newAssetRangeFlags(flags)
+	timeframesSpec := flags.String("timeframes", "", "Comma separated timeframes with optional offset, e.g. 5m,4h,1d+8h")
+	flags.Parse(args)
+	fromUnix, toUnix := rangeFlags.closeTimes(logger)
+	period := *rangeFlags.period
+
+	timeframes, err := candles.ParseTimeframes(*timeframesSpec)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if len(timeframes) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	conflictPolicy, err := candles.ParseConflictPolicy(os.Getenv("CANDLES_CONFLICT_POLICY"))
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	db := openDB(logger)
+	defer db.Close()
+
+	ctx, cancel := signalContext(logger)
+	defer cancel()
+
+	asset, err := assets.GetByName(ctx, db, *rangeFlags.asset)
+	if err != nil {
+		logger.Fatalf("Get DB asset %s fail: %s", *rangeFlags.asset, err)
+	}
+	assetLogger := assets.Logger(logrus.NewEntry(logger), asset).WithField("period", period)
+
+	for _, tf := range timeframes {
+		result, err := candles.ResampleStored(ctx, db, asset.ID, period, tf, fromUnix, toUnix, conflictPolicy)
+		if err != nil {
+			logger.Fatalf("Resample candles to %s fail: %s", tf, err)
+		}
+		assetLogger.Infof(
+			"Candles were resampled to %s: inserted=%d updated=%d unchanged=%d",
+			tf, result.Inserted, result.Updated, result.Unchanged,
+		)
+	}
+}
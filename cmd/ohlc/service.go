@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/dneprix/ohlc/pkg/schedulers"
+	"github.com/dneprix/ohlc/pkg/servers"
+)
+
+// shutdownTimeout limits waiting for running downloads on termination
+const shutdownTimeout = 30 * time.Second
+
+// runService schedules downloaders until termination signal
+func runService(logger *logrus.Logger) {
+	db := openDB(logger)
+
+	// Initialise scheduler
+	scheduler := schedulers.NewSheduler(logger)
+
+	// Optional read API with live candles, e.g. HTTP_ADDR=:8080
+	var server *servers.Server
+	if addr := os.Getenv("HTTP_ADDR"); addr != "" {
+		server = servers.NewServer(addr, db, logger)
+	}
+
+	// Optional freshness watchdog, e.g. WATCHDOG_THRESHOLD=10m
+	watchdog := newWatchdog(db, logger)
+	if watchdog != nil && server != nil {
+		server.SetWatchdog(watchdog)
+	}
+
+	// Add downloaders to scheduler
+	list := newDownloaders(db, logger)
+	for _, d := range list {
+		if server != nil {
+			d.SetPublisher(server.Hub())
+		}
+
+		// Optional cron schedule instead of interval, e.g. CRYPTOWAT_SCHEDULE="5 * * * * *"
+		if spec := os.Getenv(d.Name() + "_SCHEDULE"); spec != "" {
+			schedule, err := schedulers.ParseCron(spec)
+			if err != nil {
+				logger.Fatalf("Parse %s schedule fail: %s", d.Name(), err)
+			}
+			scheduler.AddWithSchedule(d, schedule)
+			continue
+		}
+		scheduler.Add(d)
+	}
+
+	// Health endpoints check downloaders heartbeats,
+	// optional timeout of stuck downloader pass, e.g. HEALTH_PASS_TIMEOUT=30m
+	if server != nil {
+		server.SetDownloaders(list)
+		if timeout := os.Getenv("HEALTH_PASS_TIMEOUT"); timeout != "" {
+			duration, err := time.ParseDuration(timeout)
+			if err != nil || duration <= 0 {
+				logger.Fatalf("Parse health pass timeout fail: %q", timeout)
+			}
+			server.SetPassTimeout(duration)
+		}
+	}
+
+	// Run scheduler
+	go scheduler.Run()
+
+	// Run watchdog until shutdown
+	watchdogCtx, stopWatchdog := context.WithCancel(context.Background())
+	watchdogDone := make(chan (bool))
+	go func() {
+		defer close(watchdogDone)
+		if watchdog != nil {
+			watchdog.Run(watchdogCtx)
+		}
+	}()
+
+	// Run read API
+	if server != nil {
+		go func() {
+			if err := server.Run(); err != nil {
+				logger.Fatalf("Run HTTP server fail: %s", err)
+			}
+		}()
+	}
+
+	// Wait for termination signal
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	logger.Warnf("Receive signal: %s", <-signals)
+
+	// Stop scheduler and wait for running downloads
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if server != nil {
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Errorf("Shutdown HTTP server fail: %s", err)
+		}
+	}
+	if err := scheduler.Shutdown(ctx); err != nil {
+		logger.Errorf("Shutdown scheduler fail: %s", err)
+	}
+	stopWatchdog()
+	<-watchdogDone
+	if err := db.Close(); err != nil {
+		logger.Errorf("Close DB fail: %s", err)
+	}
+	logger.Info("Service is stopped")
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dneprix/ohlc/pkg/watchdogs"
+)
+
+// newWatchdog creates freshness watchdog configured by env.
+// Returns nil if WATCHDOG_THRESHOLD is not set
+func newWatchdog(db *sqlx.DB, logger *logrus.Logger) *watchdogs.Watchdog {
+	// Staleness threshold over candle period, e.g. WATCHDOG_THRESHOLD=10m
+	threshold := os.Getenv("WATCHDOG_THRESHOLD")
+	if threshold == "" {
+		return nil
+	}
+	duration, err := time.ParseDuration(threshold)
+	if err != nil {
+		logger.Fatalf("Parse watchdog threshold fail: %s", err)
+	}
+	w := watchdogs.NewWatchdog(db, logger, duration)
+
+	// Optional check interval, e.g. WATCHDOG_INTERVAL=30s
+	if interval := os.Getenv("WATCHDOG_INTERVAL"); interval != "" {
+		duration, err := time.ParseDuration(interval)
+		if err != nil || duration <= 0 {
+			logger.Fatalf("Parse watchdog interval fail: %q", interval)
+		}
+		w.SetInterval(duration)
+	}
+
+	w.AddNotifier(watchdogs.NewLogNotifier(logger))
+
+	// Optional webhook, e.g. WATCHDOG_WEBHOOK_URL=https://hooks.example.com/ohlc
+	if url := os.Getenv("WATCHDOG_WEBHOOK_URL"); url != "" {
+		w.AddNotifier(watchdogs.NewWebhookNotifier(url))
+	}
+
+	// Optional email through local relay, e.g. WATCHDOG_SMTP_ADDR=localhost:25
+	if addr := os.Getenv("WATCHDOG_SMTP_ADDR"); addr != "" {
+		from := os.Getenv("WATCHDOG_SMTP_FROM")
+		to := os.Getenv("WATCHDOG_SMTP_TO")
+		if from == "" || to == "" {
+			logger.Fatal("WATCHDOG_SMTP_FROM and WATCHDOG_SMTP_TO are required for WATCHDOG_SMTP_ADDR")
+		}
+		w.AddNotifier(watchdogs.NewSMTPNotifier(addr, from, strings.Split(to, ",")))
+	}
+	return w
+}
@@ -0,0 +1 @@
+ALTER TABLE assets DROP COLUMN periods;
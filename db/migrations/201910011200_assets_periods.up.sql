@@ -0,0 +1 @@
+ALTER TABLE assets ADD COLUMN periods integer[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,9 @@
+-- Only one period per close time can be kept with old key
+DELETE FROM candles c
+USING candles d
+WHERE c.asset_id = d.asset_id
+  AND c.close_time = d.close_time
+  AND c.id > d.id;
+
+ALTER TABLE candles DROP CONSTRAINT candles_unique_key;
+ALTER TABLE candles ADD CONSTRAINT candles_unique_key UNIQUE (asset_id, close_time);
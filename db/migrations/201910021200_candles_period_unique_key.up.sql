@@ -0,0 +1,2 @@
+ALTER TABLE candles DROP CONSTRAINT candles_unique_key;
+ALTER TABLE candles ADD CONSTRAINT candles_unique_key UNIQUE (asset_id, period, close_time);
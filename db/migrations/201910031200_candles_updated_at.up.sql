@@ -0,0 +1 @@
+ALTER TABLE candles ADD COLUMN updated_at timestamp NOT NULL DEFAULT now();
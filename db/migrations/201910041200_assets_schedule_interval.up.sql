@@ -0,0 +1,2 @@
+-- Seconds between downloads of asset. Zero means each downloader run
+ALTER TABLE assets ADD COLUMN schedule_interval integer NOT NULL DEFAULT 0;
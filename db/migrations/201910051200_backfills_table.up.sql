@@ -0,0 +1,15 @@
+-- Progress of historical backfills. Cursor moves backwards from to_time to from_time
+CREATE TABLE backfills
+(
+  id serial,
+  asset_id int references assets(id),
+  period int NOT NULL,
+  from_time timestamp NOT NULL,
+  to_time timestamp NOT NULL,
+  cursor_time timestamp NOT NULL,
+  done boolean NOT NULL DEFAULT false,
+  created_at timestamp NOT NULL DEFAULT now(),
+  updated_at timestamp NOT NULL DEFAULT now(),
+  CONSTRAINT backfills_pk PRIMARY KEY (id),
+  CONSTRAINT backfills_unique_key UNIQUE (asset_id, period, from_time, to_time)
+);
@@ -0,0 +1,2 @@
+-- Derived candles are resampled from stored candles of lower period
+ALTER TABLE candles ADD COLUMN derived boolean NOT NULL DEFAULT false;
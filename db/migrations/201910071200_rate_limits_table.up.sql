@@ -0,0 +1,8 @@
+-- Token buckets of rate limits shared by service instances
+CREATE TABLE rate_limits
+(
+  key varchar(255) NOT NULL,
+  tokens double precision NOT NULL,
+  updated_at timestamp NOT NULL DEFAULT now(),
+  CONSTRAINT rate_limits_pk PRIMARY KEY (key)
+);
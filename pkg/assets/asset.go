@@ -1,9 +1,13 @@
 package assets
 
 import (
+	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 )
 
@@ -15,22 +19,77 @@ type Asset struct {
 	Exchange   string `db:"exchange"`
 	Downloader string `db:"downloader"`
 	URL        string `db:"url"`
+
+	// Periods in seconds to keep from downloaded data. Empty list keeps all periods
+	Periods pq.Int64Array `db:"periods"`
+
+	// ScheduleInterval in seconds between asset downloads. Zero downloads asset on each downloader run
+	ScheduleInterval uint `db:"schedule_interval"`
+}
+
+// Name of asset in FROM/TO/EXCHANGE format
+func (a *Asset) Name() string {
+	return fmt.Sprintf("%s/%s/%s", a.CoinFrom, a.CoinTo, a.Exchange)
+}
+
+// ParseName splits asset name in FROM/TO/EXCHANGE format
+func ParseName(name string) (coinFrom, coinTo, exchange string, err error) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", fmt.Errorf("Parse asset name fail: %q", name)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+// Interval between asset downloads
+func (a *Asset) Interval() time.Duration {
+	return time.Duration(a.ScheduleInterval) * time.Second
+}
+
+// HasPeriod checks if candles of period should be kept for asset
+func (a *Asset) HasPeriod(period uint) bool {
+	if len(a.Periods) == 0 {
+		return true
+	}
+	for _, p := range a.Periods {
+		if p == int64(period) {
+			return true
+		}
+	}
+	return false
 }
 
 // GetListByDownloaderName from database
-func GetListByDownloaderName(db *sqlx.DB, name string) ([]*Asset, error) {
+func GetListByDownloaderName(ctx context.Context, db *sqlx.DB, name string) ([]*Asset, error) {
 	assets := []*Asset{}
-	if err := db.Select(&assets, "SELECT * FROM assets WHERE downloader=$1", name); err != nil {
+	if err := db.SelectContext(ctx, &assets, "SELECT * FROM assets WHERE downloader=$1", name); err != nil {
 		return nil, err
 	}
 	return assets, nil
 }
 
+// GetByName from database. Name is in FROM/TO/EXCHANGE format
+func GetByName(ctx context.Context, db *sqlx.DB, name string) (*Asset, error) {
+	coinFrom, coinTo, exchange, err := ParseName(name)
+	if err != nil {
+		return nil, err
+	}
+	asset := &Asset{}
+	if err := db.GetContext(
+		ctx, asset,
+		"SELECT * FROM assets WHERE coin_from=$1 AND coin_to=$2 AND exchange=$3",
+		coinFrom, coinTo, exchange,
+	); err != nil {
+		return nil, err
+	}
+	return asset, nil
+}
+
 // Logger with asset field
 func Logger(logger *logrus.Entry, asset *Asset) *logrus.Entry {
 	return logger.WithFields(
 		logrus.Fields{
-			"asset": fmt.Sprintf("%s/%s/%s", asset.CoinFrom, asset.CoinTo, asset.Exchange),
+			"asset": asset.Name(),
 		},
 	)
 }
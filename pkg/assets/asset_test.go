@@ -1,11 +1,14 @@
 package assets
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
@@ -39,7 +42,7 @@ func TestGetListByDownloaderNameSuccess(t *testing.T) {
 		"SELECT \\* FROM assets WHERE downloader=\\$1",
 	).WithArgs(expectedAssets[0].Downloader).WillReturnRows(rows)
 
-	actualAssets, err := GetListByDownloaderName(sqlxDB, expectedAssets[0].Downloader)
+	actualAssets, err := GetListByDownloaderName(context.Background(), sqlxDB, expectedAssets[0].Downloader)
 
 	assert.Equal(t, expectedAssets, actualAssets)
 	assert.NoError(t, err)
@@ -54,13 +57,116 @@ func TestGetListByDownloaderNameFail(t *testing.T) {
 	expectedDownloader := "DOWNLOADER"
 	mock.ExpectQuery("SELECT").WithArgs(expectedDownloader).WillReturnError(expectedError)
 
-	actualAssets, err := GetListByDownloaderName(sqlxDB, expectedDownloader)
+	actualAssets, err := GetListByDownloaderName(context.Background(), sqlxDB, expectedDownloader)
 
 	assert.Nil(t, actualAssets)
 	assert.Error(t, err)
 	assert.EqualError(t, err, expectedError.Error())
 }
 
+func TestGetListByDownloaderNamePeriods(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	expectedDownloader := "DOWNLOADER"
+	rows := sqlmock.NewRows([]string{"id", "coin_from", "coin_to", "exchange", "downloader", "url", "periods"}).
+		AddRow(1, "BTC", "USD", "KRAKEN", expectedDownloader, "TEST_URL", "{60,3600}")
+	mock.ExpectQuery("SELECT").WithArgs(expectedDownloader).WillReturnRows(rows)
+
+	actualAssets, err := GetListByDownloaderName(context.Background(), sqlxDB, expectedDownloader)
+
+	assert.NoError(t, err)
+	assert.Len(t, actualAssets, 1)
+	assert.Equal(t, pq.Int64Array{60, 3600}, actualAssets[0].Periods)
+}
+
+func TestAsset_HasPeriod(t *testing.T) {
+	asset := &Asset{}
+	assert.True(t, asset.HasPeriod(60))
+	assert.True(t, asset.HasPeriod(86400))
+
+	asset.Periods = pq.Int64Array{60, 3600}
+	assert.True(t, asset.HasPeriod(60))
+	assert.True(t, asset.HasPeriod(3600))
+	assert.False(t, asset.HasPeriod(180))
+}
+
+func TestAsset_Interval(t *testing.T) {
+	asset := &Asset{}
+	assert.Equal(t, time.Duration(0), asset.Interval())
+
+	asset.ScheduleInterval = 3600
+	assert.Equal(t, time.Hour, asset.Interval())
+}
+
+func TestGetByNameSuccess(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	rows := sqlmock.NewRows([]string{"id", "coin_from", "coin_to", "exchange", "downloader", "url"}).
+		AddRow(1, "BTC", "USD", "KRAKEN", "KRAKEN", "TEST_URL")
+	mock.ExpectQuery(
+		"SELECT \\* FROM assets WHERE coin_from=\\$1 AND coin_to=\\$2 AND exchange=\\$3",
+	).WithArgs("BTC", "USD", "KRAKEN").WillReturnRows(rows)
+
+	actualAsset, err := GetByName(context.Background(), sqlxDB, "BTC/USD/KRAKEN")
+
+	assert.NoError(t, err)
+	assert.Equal(t, &Asset{
+		ID:         1,
+		CoinFrom:   "BTC",
+		CoinTo:     "USD",
+		Exchange:   "KRAKEN",
+		Downloader: "KRAKEN",
+		URL:        "TEST_URL",
+	}, actualAsset)
+}
+
+func TestGetByNameFail(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	expectedError := fmt.Errorf("DB error")
+	mock.ExpectQuery("SELECT").WithArgs("BTC", "USD", "KRAKEN").WillReturnError(expectedError)
+
+	actualAsset, err := GetByName(context.Background(), sqlxDB, "BTC/USD/KRAKEN")
+
+	assert.Nil(t, actualAsset)
+	assert.EqualError(t, err, expectedError.Error())
+}
+
+func TestGetByNameFailName(t *testing.T) {
+	mockDB, _, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	actualAsset, err := GetByName(context.Background(), sqlxDB, "BTC/USD")
+
+	assert.Nil(t, actualAsset)
+	assert.EqualError(t, err, `Parse asset name fail: "BTC/USD"`)
+}
+
+func TestParseName(t *testing.T) {
+	coinFrom, coinTo, exchange, err := ParseName("BTC/USD/KRAKEN")
+	assert.NoError(t, err)
+	assert.Equal(t, "BTC", coinFrom)
+	assert.Equal(t, "USD", coinTo)
+	assert.Equal(t, "KRAKEN", exchange)
+
+	for _, name := range []string{"", "BTC", "BTC/USD", "BTC//KRAKEN", "BTC/USD/KRAKEN/X"} {
+		_, _, _, err := ParseName(name)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestAsset_Name(t *testing.T) {
+	asset := &Asset{CoinFrom: "BTC", CoinTo: "USD", Exchange: "KRAKEN"}
+	assert.Equal(t, "BTC/USD/KRAKEN", asset.Name())
+}
+
 func TestLogger(t *testing.T) {
 	logger := logrus.NewEntry(logrus.New())
 	asset := &Asset{
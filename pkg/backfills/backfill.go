@@ -0,0 +1,98 @@
+package backfills
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Backfill is a progress of historical download of asset candles.
+// Candles are downloaded backwards from ToTime to FromTime and Cursor is
+// the latest close time which is not downloaded yet
+type Backfill struct {
+	ID       uint  `db:"id"`
+	AssetID  uint  `db:"asset_id"`
+	Period   uint  `db:"period"`
+	FromTime int64 `db:"from_time"`
+	ToTime   int64 `db:"to_time"`
+	Cursor   int64 `db:"cursor_time"`
+	Done     bool  `db:"done"`
+}
+
+// Start backfill or resume stored backfill with the same asset, period and from time.
+// The latest unfinished backfill is resumed with its own to time, so rerun with
+// to time of now continues it instead of starting a new one
+func Start(ctx context.Context, db *sqlx.DB, assetID, period uint, fromTime, toTime int64) (*Backfill, error) {
+	backfill, err := getUnfinished(ctx, db, assetID, period, fromTime)
+	if err != nil || backfill != nil {
+		return backfill, err
+	}
+
+	sqls := `INSERT INTO backfills(
+        asset_id,
+        period,
+        from_time,
+        to_time,
+        cursor_time
+      ) VALUES(
+        $1,
+        $2,
+        to_timestamp($3),
+        to_timestamp($4),
+        to_timestamp($4)
+      )
+      ON CONFLICT (asset_id, period, from_time, to_time) DO UPDATE SET updated_at = now()
+      RETURNING
+        id,
+        asset_id,
+        period,
+        extract(epoch FROM from_time::timestamptz)::bigint AS from_time,
+        extract(epoch FROM to_time::timestamptz)::bigint AS to_time,
+        extract(epoch FROM cursor_time::timestamptz)::bigint AS cursor_time,
+        done;
+      `
+	backfill = &Backfill{}
+	if err := db.GetContext(ctx, backfill, sqls, assetID, period, fromTime, toTime); err != nil {
+		return nil, err
+	}
+	return backfill, nil
+}
+
+// getUnfinished returns the latest unfinished backfill of asset period with from time
+// or nil if there is no one
+func getUnfinished(ctx context.Context, db *sqlx.DB, assetID, period uint, fromTime int64) (*Backfill, error) {
+	sqls := `SELECT
+        id,
+        asset_id,
+        period,
+        extract(epoch FROM from_time::timestamptz)::bigint AS from_time,
+        extract(epoch FROM to_time::timestamptz)::bigint AS to_time,
+        extract(epoch FROM cursor_time::timestamptz)::bigint AS cursor_time,
+        done
+      FROM backfills
+      WHERE asset_id=$1 AND period=$2 AND from_time=to_timestamp($3) AND NOT done
+      ORDER BY id DESC
+      LIMIT 1;
+      `
+	backfill := &Backfill{}
+	if err := db.GetContext(ctx, backfill, sqls, assetID, period, fromTime); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return backfill, nil
+}
+
+// SaveProgress of backfill to database
+func SaveProgress(ctx context.Context, db *sqlx.DB, backfill *Backfill) error {
+	sqls := `UPDATE backfills SET
+        cursor_time = to_timestamp(:cursor_time),
+        done = :done,
+        updated_at = now()
+      WHERE id = :id;
+      `
+	_, err := db.NamedExecContext(ctx, sqls, backfill)
+	return err
+}
@@ -0,0 +1,128 @@
+package backfills
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+var backfillColumns = []string{"id", "asset_id", "period", "from_time", "to_time", "cursor_time", "done"}
+
+func TestStartSuccess(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	rows := sqlmock.NewRows(backfillColumns).
+		AddRow(1, 2, 60, 1546300800, 1559347200, 1550000000, false)
+	mock.ExpectQuery("SELECT .+ FROM backfills").WithArgs(2, 60, 1546300800).WillReturnRows(sqlmock.NewRows(backfillColumns))
+	mock.ExpectQuery(
+		"INSERT INTO backfills.+ON CONFLICT \\(asset_id, period, from_time, to_time\\) DO UPDATE SET updated_at = now\\(\\) RETURNING id, asset_id, period, "+
+			"extract\\(epoch FROM from_time::timestamptz\\)::bigint AS from_time, "+
+			"extract\\(epoch FROM to_time::timestamptz\\)::bigint AS to_time, "+
+			"extract\\(epoch FROM cursor_time::timestamptz\\)::bigint AS cursor_time, done",
+	).WithArgs(2, 60, 1546300800, 1559347200).WillReturnRows(rows)
+
+	actual, err := Start(context.Background(), sqlxDB, 2, 60, 1546300800, 1559347200)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &Backfill{
+		ID:       1,
+		AssetID:  2,
+		Period:   60,
+		FromTime: 1546300800,
+		ToTime:   1559347200,
+		Cursor:   1550000000,
+	}, actual)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestStartResumeUnfinished(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	// Backfill started with earlier to time is resumed instead of new one
+	mock.ExpectQuery(
+		"SELECT id, asset_id, period, "+
+			"extract\\(epoch FROM from_time::timestamptz\\)::bigint AS from_time, "+
+			"extract\\(epoch FROM to_time::timestamptz\\)::bigint AS to_time, "+
+			"extract\\(epoch FROM cursor_time::timestamptz\\)::bigint AS cursor_time, done "+
+			"FROM backfills WHERE asset_id=\\$1 AND period=\\$2 AND from_time=to_timestamp\\(\\$3\\) AND NOT done "+
+			"ORDER BY id DESC LIMIT 1",
+	).WithArgs(2, 60, 1546300800).WillReturnRows(sqlmock.NewRows(backfillColumns).
+		AddRow(1, 2, 60, 1546300800, 1559347200, 1550000000, false))
+
+	actual, err := Start(context.Background(), sqlxDB, 2, 60, 1546300800, 1569600000)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &Backfill{
+		ID:       1,
+		AssetID:  2,
+		Period:   60,
+		FromTime: 1546300800,
+		ToTime:   1559347200,
+		Cursor:   1550000000,
+	}, actual)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestStartFail(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	expectedError := fmt.Errorf("DB error")
+	mock.ExpectQuery("SELECT .+ FROM backfills").WillReturnError(expectedError)
+
+	actual, err := Start(context.Background(), sqlxDB, 2, 60, 1546300800, 1559347200)
+
+	assert.Nil(t, actual)
+	assert.EqualError(t, err, expectedError.Error())
+
+	mock.ExpectQuery("SELECT .+ FROM backfills").WillReturnRows(sqlmock.NewRows(backfillColumns))
+	mock.ExpectQuery("INSERT INTO backfills").WillReturnError(expectedError)
+
+	actual, err = Start(context.Background(), sqlxDB, 2, 60, 1546300800, 1559347200)
+
+	assert.Nil(t, actual)
+	assert.EqualError(t, err, expectedError.Error())
+}
+
+func TestSaveProgressSuccess(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	mock.ExpectExec("UPDATE backfills SET cursor_time = to_timestamp\\(\\?\\), done = \\?, updated_at = now\\(\\) WHERE id = \\?").
+		WithArgs(1550000000, true, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := SaveProgress(context.Background(), sqlxDB, &Backfill{ID: 1, Cursor: 1550000000, Done: true})
+
+	assert.NoError(t, err)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSaveProgressFail(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	expectedError := fmt.Errorf("DB error")
+	mock.ExpectExec("UPDATE backfills").WillReturnError(expectedError)
+
+	err := SaveProgress(context.Background(), sqlxDB, &Backfill{ID: 1})
+
+	assert.EqualError(t, err, expectedError.Error())
+}
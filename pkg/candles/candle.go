@@ -1,6 +1,8 @@
 package candles
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 
 	"github.com/jmoiron/sqlx"
@@ -8,19 +10,40 @@ import (
 
 // Candle structure
 type Candle struct {
-	ID         uint    `db:"id"`
-	AssetID    uint    `db:"asset_id"`
-	Period     uint    `db:"period"`
-	CloseTime  int64   `db:"close_time"`
-	OpenPrice  float32 `db:"open_price"`
-	HighPrice  float32 `db:"high_price"`
-	LowPrice   float32 `db:"low_price"`
-	ClosePrice float32 `db:"close_price"`
-	Volume     float32 `db:"volume"`
+	ID         uint    `db:"id" json:"id"`
+	AssetID    uint    `db:"asset_id" json:"asset_id"`
+	Period     uint    `db:"period" json:"period"`
+	CloseTime  int64   `db:"close_time" json:"close_time"`
+	OpenPrice  Decimal `db:"open_price" json:"open_price"`
+	HighPrice  Decimal `db:"high_price" json:"high_price"`
+	LowPrice   Decimal `db:"low_price" json:"low_price"`
+	ClosePrice Decimal `db:"close_price" json:"close_price"`
+	Volume     Decimal `db:"volume" json:"volume"`
+
+	// Derived candle is resampled from stored candles of lower period
+	Derived bool `db:"derived" json:"derived"`
+}
+
+// SaveResult counts candles by outcome of Save
+type SaveResult struct {
+	Inserted  int
+	Updated   int
+	Unchanged int
+
+	// Changed candles which were inserted or updated
+	Changed []*Candle
 }
 
-// Save to database
-func Save(db *sqlx.DB, candles []*Candle) error {
+// Save to database resolving already stored candles by conflict policy
+func Save(ctx context.Context, db *sqlx.DB, candles []*Candle, policy ConflictPolicy) (SaveResult, error) {
+	result := SaveResult{}
+
+	conflict, err := policy.conflictClause()
+	if err != nil {
+		return result, err
+	}
+
+	// xmax is zero only for rows inserted by current transaction
 	sqls := `INSERT INTO candles(
         asset_id,
         period,
@@ -29,7 +52,8 @@ func Save(db *sqlx.DB, candles []*Candle) error {
         high_price,
         low_price,
         close_price,
-        volume
+        volume,
+        derived
       ) VALUES(
         :asset_id,
         :period,
@@ -38,21 +62,69 @@ func Save(db *sqlx.DB, candles []*Candle) error {
         :high_price,
         :low_price,
         :close_price,
-        :volume
+        :volume,
+        :derived
       )
-      ON CONFLICT DO NOTHING;
+      ` + conflict + `
+      RETURNING (xmax = 0) AS inserted;
       `
 
-	tx := db.MustBegin()
-	stmt, _ := tx.PrepareNamed(sqls)
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return result, fmt.Errorf("Tx begin fail: %s", err)
+	}
+	stmt, err := tx.PrepareNamedContext(ctx, sqls)
+	if err != nil {
+		tx.Rollback()
+		return result, fmt.Errorf("Tx stmt prepare fail: %s", err)
+	}
 	for _, candle := range candles {
-		if _, err := stmt.Exec(candle); err != nil {
-			return fmt.Errorf("Tx stmt exec fail: %s", err)
+		var inserted bool
+		err := stmt.QueryRowxContext(ctx, candle).Scan(&inserted)
+		switch {
+		case err == sql.ErrNoRows:
+			// Conflict was skipped by policy
+			result.Unchanged++
+		case err != nil:
+			tx.Rollback()
+			return SaveResult{}, fmt.Errorf("Tx stmt exec fail: %s", err)
+		case inserted:
+			result.Inserted++
+			result.Changed = append(result.Changed, candle)
+		default:
+			result.Updated++
+			result.Changed = append(result.Changed, candle)
 		}
 	}
 	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("Tx commit fail: %s", err)
+		return SaveResult{}, fmt.Errorf("Tx commit fail: %s", err)
 	}
 
-	return nil
+	return result, nil
+}
+
+// GetLastCloseTimes of stored source asset candles by period.
+// Unique key (asset_id, period, close_time) is used for lookup. Close time
+// without time zone is written by to_timestamp() in session time zone,
+// so it is read back as timestamptz of the same time zone
+func GetLastCloseTimes(ctx context.Context, db *sqlx.DB, assetID uint) (map[uint]int64, error) {
+	rows := []struct {
+		Period    uint  `db:"period"`
+		CloseTime int64 `db:"close_time"`
+	}{}
+	sqls := `SELECT
+        period,
+        extract(epoch FROM max(close_time)::timestamptz)::bigint AS close_time
+      FROM candles
+      WHERE asset_id=$1 AND NOT derived
+      GROUP BY period;
+      `
+	if err := db.SelectContext(ctx, &rows, sqls, assetID); err != nil {
+		return nil, err
+	}
+	closeTimes := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		closeTimes[row.Period] = row.CloseTime
+	}
+	return closeTimes, nil
 }
@@ -1,6 +1,7 @@
 package candles
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -14,9 +15,88 @@ func TestSaveSuccess(t *testing.T) {
 	defer mockDB.Close()
 	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
 
+	mock.ExpectBegin()
+	mock.ExpectPrepare("INSERT INTO candles.+ON CONFLICT \\(asset_id, period, close_time\\) DO NOTHING")
+	mock.ExpectQuery("INSERT INTO candles").WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+	mock.ExpectCommit()
+
+	candles := []*Candle{
+		{
+			AssetID:    1,
+			Period:     60,
+			CloseTime:  1569563400,
+			OpenPrice:  MustParseDecimal("7937.2"),
+			HighPrice:  MustParseDecimal("7937.2"),
+			LowPrice:   MustParseDecimal("7937.6"),
+			ClosePrice: MustParseDecimal("7937.6"),
+			Volume:     MustParseDecimal("0.00839492"),
+		},
+	}
+	result, err := Save(context.Background(), sqlxDB, candles, ConflictIgnore)
+
+	assert.NoError(t, err)
+	assert.Equal(t, SaveResult{Inserted: 1, Changed: candles}, result)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSaveSameCloseTimeDifferentPeriods(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	mock.ExpectBegin()
+	mock.ExpectPrepare("INSERT INTO candles")
+	mock.ExpectQuery("INSERT INTO candles").WithArgs(
+		1, 60, 1569564000, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), false,
+	).WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+	mock.ExpectQuery("INSERT INTO candles").WithArgs(
+		1, 3600, 1569564000, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), false,
+	).WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+	mock.ExpectCommit()
+
+	candles := []*Candle{
+		{
+			AssetID:    1,
+			Period:     60,
+			CloseTime:  1569564000,
+			OpenPrice:  MustParseDecimal("7937.2"),
+			HighPrice:  MustParseDecimal("7937.2"),
+			LowPrice:   MustParseDecimal("7937.6"),
+			ClosePrice: MustParseDecimal("7937.6"),
+			Volume:     MustParseDecimal("0.00839492"),
+		},
+		{
+			AssetID:    1,
+			Period:     3600,
+			CloseTime:  1569564000,
+			OpenPrice:  MustParseDecimal("7920.2"),
+			HighPrice:  MustParseDecimal("7950.2"),
+			LowPrice:   MustParseDecimal("7910.6"),
+			ClosePrice: MustParseDecimal("7937.6"),
+			Volume:     MustParseDecimal("12.00839492"),
+		},
+	}
+	result, err := Save(context.Background(), sqlxDB, candles, ConflictIgnore)
+
+	assert.NoError(t, err)
+	assert.Equal(t, SaveResult{Inserted: 2, Changed: candles}, result)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSaveExactDecimals(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
 	mock.ExpectBegin()
 	mock.ExpectPrepare("INSERT INTO candles")
-	mock.ExpectExec("INSERT INTO candles").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("INSERT INTO candles").WithArgs(
+		1, 60, 1569563400, "7937.2", "7937.20000000", "7936.9", "7937.6", "0.00000001", false,
+	).WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
 	mock.ExpectCommit()
 
 	candles := []*Candle{
@@ -24,16 +104,108 @@ func TestSaveSuccess(t *testing.T) {
 			AssetID:    1,
 			Period:     60,
 			CloseTime:  1569563400,
-			OpenPrice:  7937.2001953125,
-			HighPrice:  7937.2001953125,
-			LowPrice:   7937.60009765625,
-			ClosePrice: 7937.60009765625,
-			Volume:     0.008394920267164707,
+			OpenPrice:  MustParseDecimal("7937.2"),
+			HighPrice:  MustParseDecimal("7937.20000000"),
+			LowPrice:   MustParseDecimal("7936.9"),
+			ClosePrice: MustParseDecimal("7937.6"),
+			Volume:     MustParseDecimal("0.00000001"),
 		},
 	}
-	err := Save(sqlxDB, candles)
+	_, err := Save(context.Background(), sqlxDB, candles, ConflictIgnore)
+
+	assert.NoError(t, err)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSaveOverwriteChangedCounts(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	mock.ExpectBegin()
+	mock.ExpectPrepare("INSERT INTO candles.+DO UPDATE SET.+IS DISTINCT FROM.+RETURNING \\(xmax = 0\\) AS inserted")
+	mock.ExpectQuery("INSERT INTO candles").WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+	mock.ExpectQuery("INSERT INTO candles").WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(false))
+	mock.ExpectQuery("INSERT INTO candles").WillReturnRows(sqlmock.NewRows([]string{"inserted"}))
+	mock.ExpectCommit()
+
+	candles := []*Candle{
+		{AssetID: 1, Period: 60, CloseTime: 1569563400},
+		{AssetID: 1, Period: 60, CloseTime: 1569563460},
+		{AssetID: 1, Period: 60, CloseTime: 1569563520},
+	}
+	result, err := Save(context.Background(), sqlxDB, candles, ConflictOverwriteChanged)
 
 	assert.NoError(t, err)
+	assert.Equal(t, SaveResult{Inserted: 1, Updated: 1, Unchanged: 1, Changed: candles[:2]}, result)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSaveUnknownPolicyFail(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	result, err := Save(context.Background(), sqlxDB, []*Candle{}, ConflictPolicy(100))
+
+	assert.Error(t, err)
+	assert.EqualError(t, err, "Unknown conflict policy: ConflictPolicy(100)")
+	assert.Equal(t, SaveResult{}, result)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSaveBeginFail(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	expectedError := fmt.Errorf("DB error")
+	mock.ExpectBegin().WillReturnError(expectedError)
+
+	_, err := Save(context.Background(), sqlxDB, []*Candle{}, ConflictIgnore)
+
+	assert.Error(t, err)
+	assert.EqualError(t, err, "Tx begin fail: "+expectedError.Error())
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSaveContextDone(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	mock.ExpectBegin()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := Save(ctx, sqlxDB, []*Candle{}, ConflictIgnore)
+
+	assert.Error(t, err)
+	assert.EqualError(t, err, "Tx begin fail: "+context.Canceled.Error())
+}
+
+func TestSavePrepareFail(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	expectedError := fmt.Errorf("DB error")
+	mock.ExpectBegin()
+	mock.ExpectPrepare("INSERT INTO candles").WillReturnError(expectedError)
+	mock.ExpectRollback()
+
+	_, err := Save(context.Background(), sqlxDB, []*Candle{}, ConflictIgnore)
+
+	assert.Error(t, err)
+	assert.EqualError(t, err, "Tx stmt prepare fail: "+expectedError.Error())
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
@@ -47,24 +219,26 @@ func TestSaveExecFail(t *testing.T) {
 	expectedError := fmt.Errorf("DB error")
 	mock.ExpectBegin()
 	mock.ExpectPrepare("INSERT INTO candles")
-	mock.ExpectExec("INSERT INTO candles").WillReturnError(expectedError)
+	mock.ExpectQuery("INSERT INTO candles").WillReturnError(expectedError)
+	mock.ExpectRollback()
 
 	candles := []*Candle{
 		{
 			AssetID:    1,
 			Period:     60,
 			CloseTime:  1569563400,
-			OpenPrice:  7937.2001953125,
-			HighPrice:  7937.2001953125,
-			LowPrice:   7937.60009765625,
-			ClosePrice: 7937.60009765625,
-			Volume:     0.008394920267164707,
+			OpenPrice:  MustParseDecimal("7937.2"),
+			HighPrice:  MustParseDecimal("7937.2"),
+			LowPrice:   MustParseDecimal("7937.6"),
+			ClosePrice: MustParseDecimal("7937.6"),
+			Volume:     MustParseDecimal("0.00839492"),
 		},
 	}
-	err := Save(sqlxDB, candles)
+	result, err := Save(context.Background(), sqlxDB, candles, ConflictOverwrite)
 
 	assert.Error(t, err)
 	assert.EqualError(t, err, "Tx stmt exec fail: "+expectedError.Error())
+	assert.Equal(t, SaveResult{}, result)
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -79,7 +253,7 @@ func TestSaveCommitFail(t *testing.T) {
 	expectedError := fmt.Errorf("DB error")
 	mock.ExpectBegin()
 	mock.ExpectPrepare("INSERT INTO candles")
-	mock.ExpectExec("INSERT INTO candles").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("INSERT INTO candles").WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
 	mock.ExpectCommit().WillReturnError(expectedError)
 
 	candles := []*Candle{
@@ -87,19 +261,51 @@ func TestSaveCommitFail(t *testing.T) {
 			AssetID:    1,
 			Period:     60,
 			CloseTime:  1569563400,
-			OpenPrice:  7937.2001953125,
-			HighPrice:  7937.2001953125,
-			LowPrice:   7937.60009765625,
-			ClosePrice: 7937.60009765625,
-			Volume:     0.008394920267164707,
+			OpenPrice:  MustParseDecimal("7937.2"),
+			HighPrice:  MustParseDecimal("7937.2"),
+			LowPrice:   MustParseDecimal("7937.6"),
+			ClosePrice: MustParseDecimal("7937.6"),
+			Volume:     MustParseDecimal("0.00839492"),
 		},
 	}
-	err := Save(sqlxDB, candles)
+	result, err := Save(context.Background(), sqlxDB, candles, ConflictIgnore)
 
 	assert.Error(t, err)
 	assert.EqualError(t, err, "Tx commit fail: "+expectedError.Error())
+	assert.Equal(t, SaveResult{}, result)
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestGetLastCloseTimesSuccess(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	mock.ExpectQuery("SELECT period, extract\\(epoch FROM max\\(close_time\\)::timestamptz\\)::bigint AS close_time FROM candles WHERE asset_id=\\$1 AND NOT derived GROUP BY period").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"period", "close_time"}).
+			AddRow(60, 1569563400).
+			AddRow(3600, 1569560400))
+
+	actual, err := GetLastCloseTimes(context.Background(), sqlxDB, 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[uint]int64{60: 1569563400, 3600: 1569560400}, actual)
+}
+
+func TestGetLastCloseTimesFail(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	expectedError := fmt.Errorf("DB error")
+	mock.ExpectQuery("SELECT").WithArgs(1).WillReturnError(expectedError)
+
+	actual, err := GetLastCloseTimes(context.Background(), sqlxDB, 1)
+
+	assert.Nil(t, actual)
+	assert.EqualError(t, err, expectedError.Error())
+}
@@ -0,0 +1,86 @@
+package candles
+
+import (
+	"fmt"
+)
+
+// ConflictPolicy defines how Save handles candles that are already stored
+type ConflictPolicy int
+
+const (
+	// ConflictIgnore keeps stored candle untouched
+	ConflictIgnore ConflictPolicy = iota
+	// ConflictOverwrite always replaces stored candle values
+	ConflictOverwrite
+	// ConflictOverwriteChanged replaces stored candle values only if they differ
+	ConflictOverwriteChanged
+)
+
+// DefaultConflictPolicy revises candles that were saved while still forming
+const DefaultConflictPolicy = ConflictOverwriteChanged
+
+var conflictPolicyNames = map[ConflictPolicy]string{
+	ConflictIgnore:           "ignore",
+	ConflictOverwrite:        "overwrite",
+	ConflictOverwriteChanged: "overwrite-changed",
+}
+
+// ParseConflictPolicy from name. Empty name returns DefaultConflictPolicy
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	if name == "" {
+		return DefaultConflictPolicy, nil
+	}
+	for policy, policyName := range conflictPolicyNames {
+		if policyName == name {
+			return policy, nil
+		}
+	}
+	return DefaultConflictPolicy, fmt.Errorf("Unknown conflict policy: %q", name)
+}
+
+// String name of conflict policy
+func (cp ConflictPolicy) String() string {
+	if name, ok := conflictPolicyNames[cp]; ok {
+		return name
+	}
+	return fmt.Sprintf("ConflictPolicy(%d)", int(cp))
+}
+
+// conflictClause returns ON CONFLICT clause of insert query for policy.
+// Derived candle never replaces source candle
+func (cp ConflictPolicy) conflictClause() (string, error) {
+	const target = "ON CONFLICT (asset_id, period, close_time)"
+	const update = target + ` DO UPDATE SET
+        open_price = EXCLUDED.open_price,
+        high_price = EXCLUDED.high_price,
+        low_price = EXCLUDED.low_price,
+        close_price = EXCLUDED.close_price,
+        volume = EXCLUDED.volume,
+        derived = EXCLUDED.derived,
+        updated_at = now()
+      WHERE (candles.derived OR NOT EXCLUDED.derived)`
+
+	switch cp {
+	case ConflictIgnore:
+		return target + " DO NOTHING", nil
+	case ConflictOverwrite:
+		return update, nil
+	case ConflictOverwriteChanged:
+		return update + ` AND (
+        candles.open_price,
+        candles.high_price,
+        candles.low_price,
+        candles.close_price,
+        candles.volume,
+        candles.derived
+      ) IS DISTINCT FROM (
+        EXCLUDED.open_price,
+        EXCLUDED.high_price,
+        EXCLUDED.low_price,
+        EXCLUDED.close_price,
+        EXCLUDED.volume,
+        EXCLUDED.derived
+      )`, nil
+	}
+	return "", fmt.Errorf("Unknown conflict policy: %s", cp)
+}
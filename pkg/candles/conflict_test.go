@@ -0,0 +1,57 @@
+package candles
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConflictPolicy(t *testing.T) {
+	tests := map[string]ConflictPolicy{
+		"":                  DefaultConflictPolicy,
+		"ignore":            ConflictIgnore,
+		"overwrite":         ConflictOverwrite,
+		"overwrite-changed": ConflictOverwriteChanged,
+	}
+	for name, expected := range tests {
+		actual, err := ParseConflictPolicy(name)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, actual)
+	}
+}
+
+func TestParseConflictPolicyFail(t *testing.T) {
+	actual, err := ParseConflictPolicy("replace")
+	assert.Error(t, err)
+	assert.EqualError(t, err, `Unknown conflict policy: "replace"`)
+	assert.Equal(t, DefaultConflictPolicy, actual)
+}
+
+func TestConflictPolicy_String(t *testing.T) {
+	assert.Equal(t, "ignore", ConflictIgnore.String())
+	assert.Equal(t, "overwrite", ConflictOverwrite.String())
+	assert.Equal(t, "overwrite-changed", ConflictOverwriteChanged.String())
+	assert.Equal(t, "ConflictPolicy(100)", ConflictPolicy(100).String())
+}
+
+func TestConflictPolicy_conflictClause(t *testing.T) {
+	actual, err := ConflictIgnore.conflictClause()
+	assert.NoError(t, err)
+	assert.Equal(t, "ON CONFLICT (asset_id, period, close_time) DO NOTHING", actual)
+
+	actual, err = ConflictOverwrite.conflictClause()
+	assert.NoError(t, err)
+	assert.Contains(t, actual, "DO UPDATE SET")
+	assert.Contains(t, actual, "updated_at = now()")
+	assert.Contains(t, actual, "WHERE (candles.derived OR NOT EXCLUDED.derived)")
+	assert.NotContains(t, actual, "IS DISTINCT FROM")
+
+	actual, err = ConflictOverwriteChanged.conflictClause()
+	assert.NoError(t, err)
+	assert.Contains(t, actual, "DO UPDATE SET")
+	assert.Contains(t, actual, "IS DISTINCT FROM")
+
+	actual, err = ConflictPolicy(100).conflictClause()
+	assert.Error(t, err)
+	assert.Empty(t, actual)
+}
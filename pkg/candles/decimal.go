@@ -0,0 +1,54 @@
+package candles
+
+import (
+	"database/sql/driver"
+
+	"github.com/shopspring/decimal"
+)
+
+// Decimal is an exact decimal number that keeps the scale of its source text,
+// so "1.20000000" is written back as "1.20000000" and not as "1.2"
+type Decimal struct {
+	decimal.Decimal
+}
+
+// ParseDecimal from text
+func ParseDecimal(s string) (Decimal, error) {
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		return Decimal{}, err
+	}
+	return Decimal{d}, nil
+}
+
+// MustParseDecimal from text. Panics if text is not a decimal number
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// String representation with source scale
+func (d Decimal) String() string {
+	if exp := d.Exponent(); exp < 0 {
+		return d.StringFixed(-exp)
+	}
+	return d.Decimal.String()
+}
+
+// Value implements driver.Valuer interface
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// MarshalJSON implements json.Marshaler interface
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + d.String() + `"`), nil
+}
+
+// MarshalText implements encoding.TextMarshaler interface
+func (d Decimal) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
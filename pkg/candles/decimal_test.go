@@ -0,0 +1,72 @@
+package candles
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDecimal(t *testing.T) {
+	actual, err := ParseDecimal("7937.2")
+	assert.NoError(t, err)
+	assert.Equal(t, "7937.2", actual.String())
+
+	actual, err = ParseDecimal("price")
+	assert.Error(t, err)
+	assert.Equal(t, Decimal{}, actual)
+}
+
+func TestMustParseDecimal(t *testing.T) {
+	assert.Equal(t, "0.00839492", MustParseDecimal("0.00839492").String())
+	assert.Panics(t, func() { MustParseDecimal("price") })
+}
+
+func TestDecimal_String(t *testing.T) {
+	tests := []string{
+		"7937.2",
+		"1.20000000",
+		"0.00000001",
+		"7940",
+		"0",
+		"-12.50",
+		"123456789012345678901234567890.123456789012345678901234567890",
+	}
+	for _, expected := range tests {
+		assert.Equal(t, expected, MustParseDecimal(expected).String())
+	}
+	assert.Equal(t, "0", Decimal{}.String())
+	assert.Equal(t, "1500", MustParseDecimal("1.5e3").String())
+}
+
+func TestDecimal_Value(t *testing.T) {
+	actual, err := MustParseDecimal("1.20000000").Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "1.20000000", actual)
+}
+
+func TestDecimal_Scan(t *testing.T) {
+	d := Decimal{}
+	err := d.Scan([]byte("7937.20000000"))
+	assert.NoError(t, err)
+	assert.Equal(t, "7937.20000000", d.String())
+}
+
+func TestDecimal_JSON(t *testing.T) {
+	values := []Decimal{}
+	err := json.Unmarshal([]byte(`[7937.2, "0.00839492", 1.20000000]`), &values)
+	assert.NoError(t, err)
+	assert.Equal(t, []Decimal{
+		MustParseDecimal("7937.2"),
+		MustParseDecimal("0.00839492"),
+		MustParseDecimal("1.20000000"),
+	}, values)
+
+	actual, err := json.Marshal(values)
+	assert.NoError(t, err)
+	assert.Equal(t, `["7937.2","0.00839492","1.20000000"]`, string(actual))
+
+	text, err := values[2].MarshalText()
+	assert.NoError(t, err)
+	assert.Equal(t, "1.20000000", string(text))
+}
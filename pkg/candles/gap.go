@@ -0,0 +1,46 @@
+package candles
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Gap is a range of missing candles close times (inclusive)
+type Gap struct {
+	From int64 `db:"from_time"`
+	To   int64 `db:"to_time"`
+}
+
+// Missing number of candles with period inside gap
+func (g Gap) Missing(period uint) int64 {
+	return (g.To-g.From)/int64(period) + 1
+}
+
+// FindGaps in stored asset candles of period with close times from and to (inclusive).
+// Sentinel close times around range report missing candles at range edges
+func FindGaps(ctx context.Context, db *sqlx.DB, assetID, period uint, from, to int64) ([]Gap, error) {
+	sqls := `SELECT
+        prev_close_time + $2 AS from_time,
+        close_time - $2 AS to_time
+      FROM (
+        SELECT
+          close_time,
+          lag(close_time) OVER (ORDER BY close_time) AS prev_close_time
+        FROM (
+          SELECT extract(epoch FROM close_time::timestamptz)::bigint AS close_time
+          FROM candles
+          WHERE asset_id=$1 AND period=$2 AND close_time BETWEEN to_timestamp($3) AND to_timestamp($4)
+          UNION ALL SELECT $3::bigint - $2::bigint
+          UNION ALL SELECT $4::bigint + $2::bigint
+        ) AS close_times
+      ) AS neighbours
+      WHERE close_time - prev_close_time > $2
+      ORDER BY from_time;
+      `
+	gaps := []Gap{}
+	if err := db.SelectContext(ctx, &gaps, sqls, assetID, period, from, to); err != nil {
+		return nil, err
+	}
+	return gaps, nil
+}
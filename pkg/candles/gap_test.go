@@ -0,0 +1,53 @@
+package candles
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindGapsSuccess(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	mock.ExpectQuery("SELECT prev_close_time \\+ \\$2 AS from_time, close_time - \\$2 AS to_time FROM .+ lag\\(close_time\\) OVER \\(ORDER BY close_time\\) AS prev_close_time FROM \\( SELECT extract\\(epoch FROM close_time::timestamptz\\)::bigint AS close_time FROM candles").
+		WithArgs(1, 60, 1569560400, 1569564000).
+		WillReturnRows(sqlmock.NewRows([]string{"from_time", "to_time"}).
+			AddRow(1569560400, 1569560520).
+			AddRow(1569563400, 1569563400))
+
+	actual, err := FindGaps(context.Background(), sqlxDB, 1, 60, 1569560400, 1569564000)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Gap{
+		{From: 1569560400, To: 1569560520},
+		{From: 1569563400, To: 1569563400},
+	}, actual)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestFindGapsFail(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	expectedError := fmt.Errorf("DB error")
+	mock.ExpectQuery("SELECT").WillReturnError(expectedError)
+
+	actual, err := FindGaps(context.Background(), sqlxDB, 1, 60, 1569560400, 1569564000)
+
+	assert.Nil(t, actual)
+	assert.EqualError(t, err, expectedError.Error())
+}
+
+func TestGap_Missing(t *testing.T) {
+	assert.Equal(t, int64(1), Gap{From: 1569563400, To: 1569563400}.Missing(60))
+	assert.Equal(t, int64(3), Gap{From: 1569560400, To: 1569560520}.Missing(60))
+}
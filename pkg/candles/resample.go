@@ -0,0 +1,211 @@
+package candles
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Timeframe is a period of resampled candles. Close times are aligned to
+// multiples of period since unix epoch shifted by offset
+type Timeframe struct {
+	// Period in seconds
+	Period uint
+	// Offset in seconds, 0 <= Offset < Period
+	Offset int64
+}
+
+// ParseTimeframe from duration with optional offset, e.g. "15m", "4h" or
+// "1d+8h" for days closing at 08:00 UTC. Days are supported by "d" suffix
+func ParseTimeframe(spec string) (Timeframe, error) {
+	periodSpec, offsetSpec := spec, ""
+	if i := strings.Index(spec, "+"); i >= 0 {
+		periodSpec, offsetSpec = spec[:i], spec[i+1:]
+	}
+
+	period, err := parseTimeframeDuration(periodSpec)
+	if err != nil || period < time.Second || period%time.Second != 0 {
+		return Timeframe{}, fmt.Errorf("Parse timeframe period fail: %q", spec)
+	}
+	tf := Timeframe{Period: uint(period / time.Second)}
+
+	if offsetSpec != "" {
+		offset, err := parseTimeframeDuration(offsetSpec)
+		if err != nil || offset%time.Second != 0 {
+			return Timeframe{}, fmt.Errorf("Parse timeframe offset fail: %q", spec)
+		}
+		tf.Offset = int64(offset/time.Second) % int64(tf.Period)
+	}
+	return tf, nil
+}
+
+// ParseTimeframes from comma separated list. Empty list returns no timeframes
+func ParseTimeframes(spec string) ([]Timeframe, error) {
+	timeframes := []Timeframe{}
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		tf, err := ParseTimeframe(s)
+		if err != nil {
+			return nil, err
+		}
+		timeframes = append(timeframes, tf)
+	}
+	return timeframes, nil
+}
+
+func parseTimeframeDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseUint(strings.TrimSuffix(s, "d"), 10, 32)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// String representation of timeframe
+func (tf Timeframe) String() string {
+	if tf.Offset == 0 {
+		return fmt.Sprintf("%ds", tf.Period)
+	}
+	return fmt.Sprintf("%ds+%ds", tf.Period, tf.Offset)
+}
+
+// CloseTime of timeframe candle which includes source candle closed at closeTime
+func (tf Timeframe) CloseTime(closeTime int64) int64 {
+	period := int64(tf.Period)
+	t := closeTime - tf.Offset
+	rem := t % period
+	if rem < 0 {
+		rem += period
+	}
+	if rem != 0 {
+		t += period - rem
+	}
+	return t + tf.Offset
+}
+
+// Supports checks if timeframe candles can be resampled from candles of source period
+func (tf Timeframe) Supports(sourcePeriod uint) bool {
+	return sourcePeriod != 0 &&
+		tf.Period > sourcePeriod &&
+		tf.Period%sourcePeriod == 0 &&
+		tf.Offset%int64(sourcePeriod) == 0
+}
+
+// Resample source candles of period into timeframe candles: first open,
+// max high, min low, last close and sum of volumes. Only complete timeframe
+// candles are returned. Returned candles are marked as derived
+func Resample(source []*Candle, sourcePeriod uint, tf Timeframe) ([]*Candle, error) {
+	if !tf.Supports(sourcePeriod) {
+		return nil, fmt.Errorf("Unsupported timeframe %s for period: %d", tf, sourcePeriod)
+	}
+
+	sorted := make([]*Candle, 0, len(source))
+	for _, c := range source {
+		if c.Period == sourcePeriod {
+			sorted = append(sorted, c)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].AssetID != sorted[j].AssetID {
+			return sorted[i].AssetID < sorted[j].AssetID
+		}
+		return sorted[i].CloseTime < sorted[j].CloseTime
+	})
+
+	size := int(tf.Period / sourcePeriod)
+	resampled := []*Candle{}
+	var current *Candle
+	count := 0
+	flush := func() {
+		if current != nil && count == size {
+			resampled = append(resampled, current)
+		}
+	}
+	for _, c := range sorted {
+		closeTime := tf.CloseTime(c.CloseTime)
+		if current == nil || current.AssetID != c.AssetID || current.CloseTime != closeTime {
+			flush()
+			current = &Candle{
+				AssetID:    c.AssetID,
+				Period:     tf.Period,
+				CloseTime:  closeTime,
+				OpenPrice:  c.OpenPrice,
+				HighPrice:  c.HighPrice,
+				LowPrice:   c.LowPrice,
+				ClosePrice: c.ClosePrice,
+				Volume:     c.Volume,
+				Derived:    true,
+			}
+			count = 1
+			continue
+		}
+		if c.HighPrice.GreaterThan(current.HighPrice.Decimal) {
+			current.HighPrice = c.HighPrice
+		}
+		if c.LowPrice.LessThan(current.LowPrice.Decimal) {
+			current.LowPrice = c.LowPrice
+		}
+		current.ClosePrice = c.ClosePrice
+		current.Volume = Decimal{current.Volume.Add(c.Volume.Decimal)}
+		count++
+	}
+	flush()
+
+	return resampled, nil
+}
+
+// GetList of stored asset candles of period with close times after (exclusive) and before (inclusive)
+func GetList(ctx context.Context, db *sqlx.DB, assetID, period uint, after, before int64) ([]*Candle, error) {
+	sqls := `SELECT
+        id,
+        asset_id,
+        period,
+        extract(epoch FROM close_time::timestamptz)::bigint AS close_time,
+        open_price,
+        high_price,
+        low_price,
+        close_price,
+        volume,
+        derived
+      FROM candles
+      WHERE asset_id=$1 AND period=$2 AND close_time > to_timestamp($3) AND close_time <= to_timestamp($4)
+      ORDER BY close_time;
+      `
+	candles := []*Candle{}
+	if err := db.SelectContext(ctx, &candles, sqls, assetID, period, after, before); err != nil {
+		return nil, err
+	}
+	return candles, nil
+}
+
+// ResampleStored resamples stored asset candles of source period into
+// timeframe candles which include close times from and to, and saves them
+func ResampleStored(ctx context.Context, db *sqlx.DB, assetID, sourcePeriod uint, tf Timeframe, from, to int64, policy ConflictPolicy) (SaveResult, error) {
+	if !tf.Supports(sourcePeriod) {
+		return SaveResult{}, fmt.Errorf("Unsupported timeframe %s for period: %d", tf, sourcePeriod)
+	}
+
+	source, err := GetList(ctx, db, assetID, sourcePeriod, tf.CloseTime(from)-int64(tf.Period), tf.CloseTime(to))
+	if err != nil {
+		return SaveResult{}, fmt.Errorf("Get stored candles fail: %s", err)
+	}
+	resampled, err := Resample(source, sourcePeriod, tf)
+	if err != nil {
+		return SaveResult{}, err
+	}
+	if len(resampled) == 0 {
+		return SaveResult{}, nil
+	}
+	return Save(ctx, db, resampled, policy)
+}
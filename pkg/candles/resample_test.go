@@ -0,0 +1,209 @@
+package candles
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimeframe(t *testing.T) {
+	for spec, expected := range map[string]Timeframe{
+		"5m":     {Period: 300},
+		"4h":     {Period: 14400},
+		"1d":     {Period: 86400},
+		"1d+8h":  {Period: 86400, Offset: 28800},
+		"1h+90m": {Period: 3600, Offset: 1800},
+	} {
+		actual, err := ParseTimeframe(spec)
+		assert.NoError(t, err, spec)
+		assert.Equal(t, expected, actual, spec)
+	}
+
+	for _, spec := range []string{"", "0s", "-1h", "1.5s", "xd", "1h+x", "1h+1ms"} {
+		_, err := ParseTimeframe(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestParseTimeframes(t *testing.T) {
+	actual, err := ParseTimeframes("5m, 15m,1h,,1d+8h")
+	assert.NoError(t, err)
+	assert.Equal(t, []Timeframe{{Period: 300}, {Period: 900}, {Period: 3600}, {Period: 86400, Offset: 28800}}, actual)
+
+	actual, err = ParseTimeframes("")
+	assert.NoError(t, err)
+	assert.Empty(t, actual)
+
+	actual, err = ParseTimeframes("5m,x")
+	assert.Nil(t, actual)
+	assert.EqualError(t, err, `Parse timeframe period fail: "x"`)
+}
+
+func TestTimeframe_String(t *testing.T) {
+	assert.Equal(t, "3600s", Timeframe{Period: 3600}.String())
+	assert.Equal(t, "86400s+28800s", Timeframe{Period: 86400, Offset: 28800}.String())
+}
+
+func TestTimeframe_CloseTime(t *testing.T) {
+	tf := Timeframe{Period: 3600}
+	assert.Equal(t, int64(1569560400), tf.CloseTime(1569560400))
+	assert.Equal(t, int64(1569564000), tf.CloseTime(1569560460))
+	assert.Equal(t, int64(1569564000), tf.CloseTime(1569564000))
+
+	tf = Timeframe{Period: 86400, Offset: 28800}
+	assert.Equal(t, int64(1569571200), tf.CloseTime(1569564000))
+	assert.Equal(t, int64(1569571200), tf.CloseTime(1569571200))
+	assert.Equal(t, int64(1569657600), tf.CloseTime(1569571260))
+}
+
+func TestTimeframe_Supports(t *testing.T) {
+	assert.True(t, Timeframe{Period: 300}.Supports(60))
+	assert.False(t, Timeframe{Period: 300}.Supports(0))
+	assert.False(t, Timeframe{Period: 60}.Supports(60))
+	assert.False(t, Timeframe{Period: 300}.Supports(120))
+	assert.False(t, Timeframe{Period: 3600, Offset: 30}.Supports(60))
+}
+
+func TestResample(t *testing.T) {
+	source := []*Candle{
+		// Incomplete candle of previous timeframe
+		{AssetID: 1, Period: 60, CloseTime: 1569563820, OpenPrice: MustParseDecimal("1"), HighPrice: MustParseDecimal("1"), LowPrice: MustParseDecimal("1"), ClosePrice: MustParseDecimal("1"), Volume: MustParseDecimal("1")},
+		// Unsorted candles of 1569564000 close time
+		{AssetID: 1, Period: 60, CloseTime: 1569564000, OpenPrice: MustParseDecimal("10.5"), HighPrice: MustParseDecimal("11"), LowPrice: MustParseDecimal("10"), ClosePrice: MustParseDecimal("10.8"), Volume: MustParseDecimal("0.25")},
+		{AssetID: 1, Period: 60, CloseTime: 1569563880, OpenPrice: MustParseDecimal("10"), HighPrice: MustParseDecimal("10.2"), LowPrice: MustParseDecimal("9.5"), ClosePrice: MustParseDecimal("10.1"), Volume: MustParseDecimal("1.5")},
+		{AssetID: 1, Period: 60, CloseTime: 1569563940, OpenPrice: MustParseDecimal("10.1"), HighPrice: MustParseDecimal("12"), LowPrice: MustParseDecimal("10.1"), ClosePrice: MustParseDecimal("10.5"), Volume: MustParseDecimal("2.00")},
+		// Other period is ignored
+		{AssetID: 1, Period: 3600, CloseTime: 1569563940},
+	}
+
+	actual, err := Resample(source, 60, Timeframe{Period: 180})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []*Candle{
+		{
+			AssetID:    1,
+			Period:     180,
+			CloseTime:  1569564000,
+			OpenPrice:  MustParseDecimal("10"),
+			HighPrice:  MustParseDecimal("12"),
+			LowPrice:   MustParseDecimal("9.5"),
+			ClosePrice: MustParseDecimal("10.8"),
+			Volume:     MustParseDecimal("3.75"),
+			Derived:    true,
+		},
+	}, actual)
+}
+
+func TestResampleUnsupported(t *testing.T) {
+	actual, err := Resample([]*Candle{}, 120, Timeframe{Period: 300})
+
+	assert.Nil(t, actual)
+	assert.EqualError(t, err, "Unsupported timeframe 300s for period: 120")
+}
+
+func TestGetListSuccess(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	mock.ExpectQuery("SELECT .+ extract\\(epoch FROM close_time::timestamptz\\)::bigint AS close_time, .+ FROM candles WHERE asset_id=\\$1 AND period=\\$2 AND close_time > to_timestamp\\(\\$3\\) AND close_time <= to_timestamp\\(\\$4\\) ORDER BY close_time").
+		WithArgs(1, 60, 1569563820, 1569564000).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "asset_id", "period", "close_time", "open_price", "high_price", "low_price", "close_price", "volume", "derived"}).
+			AddRow(1, 1, 60, 1569563880, "10", "10.2", "9.5", "10.1", "1.50", false))
+
+	actual, err := GetList(context.Background(), sqlxDB, 1, 60, 1569563820, 1569564000)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []*Candle{
+		{
+			ID:         1,
+			AssetID:    1,
+			Period:     60,
+			CloseTime:  1569563880,
+			OpenPrice:  MustParseDecimal("10"),
+			HighPrice:  MustParseDecimal("10.2"),
+			LowPrice:   MustParseDecimal("9.5"),
+			ClosePrice: MustParseDecimal("10.1"),
+			Volume:     MustParseDecimal("1.50"),
+		},
+	}, actual)
+}
+
+func TestGetListFail(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	expectedError := fmt.Errorf("DB error")
+	mock.ExpectQuery("SELECT").WillReturnError(expectedError)
+
+	actual, err := GetList(context.Background(), sqlxDB, 1, 60, 1569563820, 1569564000)
+
+	assert.Nil(t, actual)
+	assert.EqualError(t, err, expectedError.Error())
+}
+
+func TestResampleStoredSuccess(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	rows := sqlmock.NewRows([]string{"id", "asset_id", "period", "close_time", "open_price", "high_price", "low_price", "close_price", "volume", "derived"})
+	for _, closeTime := range []int64{1569563880, 1569563940, 1569564000} {
+		rows.AddRow(closeTime, 1, 60, closeTime, "1", "1", "1", "1", "1", false)
+	}
+	mock.ExpectQuery("SELECT .+ FROM candles").
+		WithArgs(1, 60, 1569563820, 1569564000).
+		WillReturnRows(rows)
+	mock.ExpectBegin()
+	mock.ExpectPrepare("INSERT INTO candles")
+	mock.ExpectQuery("INSERT INTO candles").
+		WithArgs(1, 180, 1569564000, "1", "1", "1", "1", "3", true).
+		WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+	mock.ExpectCommit()
+
+	result, err := ResampleStored(context.Background(), sqlxDB, 1, 60, Timeframe{Period: 180}, 1569563880, 1569563940, ConflictOverwriteChanged)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Inserted)
+	assert.Len(t, result.Changed, 1)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestResampleStoredNothing(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	mock.ExpectQuery("SELECT .+ FROM candles").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "asset_id", "period", "close_time", "open_price", "high_price", "low_price", "close_price", "volume", "derived"}))
+
+	result, err := ResampleStored(context.Background(), sqlxDB, 1, 60, Timeframe{Period: 180}, 1569563880, 1569563940, ConflictOverwriteChanged)
+
+	assert.NoError(t, err)
+	assert.Equal(t, SaveResult{}, result)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestResampleStoredFail(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	result, err := ResampleStored(context.Background(), sqlxDB, 1, 60, Timeframe{Period: 90}, 1569563880, 1569563940, ConflictOverwriteChanged)
+	assert.EqualError(t, err, "Unsupported timeframe 90s for period: 60")
+	assert.Equal(t, SaveResult{}, result)
+
+	mock.ExpectQuery("SELECT").WillReturnError(fmt.Errorf("DB error"))
+	result, err = ResampleStored(context.Background(), sqlxDB, 1, 60, Timeframe{Period: 180}, 1569563880, 1569563940, ConflictOverwriteChanged)
+	assert.EqualError(t, err, "Get stored candles fail: DB error")
+	assert.Equal(t, SaveResult{}, result)
+}
@@ -0,0 +1,81 @@
+package credentials
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Authorizer adds credentials to data source request. It is called
+// before each request attempt, so signatures are fresh on retries
+type Authorizer interface {
+	Authorize(req *http.Request) error
+}
+
+// HeaderAuthorizer sets API key header, e.g. X-CW-API-Key
+type HeaderAuthorizer struct {
+	Name string
+	Key  string
+}
+
+// Authorize implements Authorizer interface
+func (ha *HeaderAuthorizer) Authorize(req *http.Request) error {
+	req.Header.Set(ha.Name, ha.Key)
+	return nil
+}
+
+// QueryAuthorizer sets API key query param, e.g. api_key
+type QueryAuthorizer struct {
+	Name string
+	Key  string
+}
+
+// Authorize implements Authorizer interface
+func (qa *QueryAuthorizer) Authorize(req *http.Request) error {
+	query := req.URL.Query()
+	query.Set(qa.Name, qa.Key)
+	req.URL.RawQuery = query.Encode()
+	return nil
+}
+
+// BearerAuthorizer sets bearer token of Authorization header
+type BearerAuthorizer struct {
+	Token string
+}
+
+// Authorize implements Authorizer interface
+func (ba *BearerAuthorizer) Authorize(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+ba.Token)
+	return nil
+}
+
+// HMACAuthorizer signs request by secret. Headers are named by prefix:
+// <prefix>-Key is API key, <prefix>-Timestamp is unix time in milliseconds and
+// <prefix>-Sign is hex HMAC-SHA256 of timestamp, method and request URI
+type HMACAuthorizer struct {
+	Prefix string
+	Key    string
+	Secret string
+
+	now func() time.Time
+}
+
+// Authorize implements Authorizer interface
+func (ha *HMACAuthorizer) Authorize(req *http.Request) error {
+	now := time.Now
+	if ha.now != nil {
+		now = ha.now
+	}
+	timestamp := strconv.FormatInt(now().UnixNano()/int64(time.Millisecond), 10)
+
+	mac := hmac.New(sha256.New, []byte(ha.Secret))
+	mac.Write([]byte(timestamp + req.Method + req.URL.RequestURI()))
+
+	req.Header.Set(ha.Prefix+"-Key", ha.Key)
+	req.Header.Set(ha.Prefix+"-Timestamp", timestamp)
+	req.Header.Set(ha.Prefix+"-Sign", hex.EncodeToString(mac.Sum(nil)))
+	return nil
+}
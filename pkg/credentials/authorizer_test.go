@@ -0,0 +1,52 @@
+package credentials
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRequest(t *testing.T) *http.Request {
+	req, err := http.NewRequest(http.MethodGet, "https://api.example.com/ohlc?after=1", nil)
+	assert.NoError(t, err)
+	return req
+}
+
+func TestHeaderAuthorizer_Authorize(t *testing.T) {
+	req := newTestRequest(t)
+	assert.NoError(t, (&HeaderAuthorizer{Name: "X-CW-API-Key", Key: "TEST_KEY"}).Authorize(req))
+	assert.Equal(t, "TEST_KEY", req.Header.Get("X-CW-API-Key"))
+}
+
+func TestQueryAuthorizer_Authorize(t *testing.T) {
+	req := newTestRequest(t)
+	assert.NoError(t, (&QueryAuthorizer{Name: "api_key", Key: "TEST_KEY"}).Authorize(req))
+	assert.Equal(t, "https://api.example.com/ohlc?after=1&api_key=TEST_KEY", req.URL.String())
+
+	// Retry doesn't duplicate param
+	assert.NoError(t, (&QueryAuthorizer{Name: "api_key", Key: "TEST_KEY"}).Authorize(req))
+	assert.Equal(t, "after=1&api_key=TEST_KEY", req.URL.RawQuery)
+}
+
+func TestBearerAuthorizer_Authorize(t *testing.T) {
+	req := newTestRequest(t)
+	assert.NoError(t, (&BearerAuthorizer{Token: "TEST_TOKEN"}).Authorize(req))
+	assert.Equal(t, "Bearer TEST_TOKEN", req.Header.Get("Authorization"))
+}
+
+func TestHMACAuthorizer_Authorize(t *testing.T) {
+	req := newTestRequest(t)
+	ha := &HMACAuthorizer{
+		Prefix: "API",
+		Key:    "TEST_KEY",
+		Secret: "TEST_SECRET",
+		now:    func() time.Time { return time.Unix(1569563400, 0) },
+	}
+	assert.NoError(t, ha.Authorize(req))
+	assert.Equal(t, "TEST_KEY", req.Header.Get("API-Key"))
+	assert.Equal(t, "1569563400000", req.Header.Get("API-Timestamp"))
+	// HMAC-SHA256 of "1569563400000GET/ohlc?after=1" by TEST_SECRET
+	assert.Equal(t, "5af5dc8d579dbef65f9bc97c871eee80967e456a08314a16906ef41241c92a29", req.Header.Get("API-Sign"))
+}
@@ -0,0 +1,143 @@
+package credentials
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// Auth types of credentials
+const (
+	AuthHeader = "header"
+	AuthQuery  = "query"
+	AuthBearer = "bearer"
+	AuthHMAC   = "hmac"
+)
+
+// defaultHMACPrefix of HMAC headers, e.g. API-Key and API-Sign
+const defaultHMACPrefix = "API"
+
+// Credentials of data source API. Auth type is detected by set fields if it is empty:
+// token is bearer, key with secret is HMAC and key alone is header
+type Credentials struct {
+	// Auth type: header, query, bearer or hmac
+	Auth string `json:"auth"`
+
+	// Name of API key header or query param, or prefix of HMAC headers
+	Name string `json:"name"`
+
+	Key    string `json:"key"`
+	Secret string `json:"secret"`
+	Token  string `json:"token"`
+}
+
+// Empty credentials have no key and token
+func (c Credentials) Empty() bool {
+	return c.Key == "" && c.Token == ""
+}
+
+// Type of auth, detected by set fields if it is not set explicitly
+func (c Credentials) Type() string {
+	switch {
+	case c.Auth != "":
+		return c.Auth
+	case c.Token != "":
+		return AuthBearer
+	case c.Secret != "":
+		return AuthHMAC
+	}
+	return AuthHeader
+}
+
+// WithDefaults fills empty auth type and name, e.g. by downloader defaults.
+// Defaults are not applied to explicitly set other auth type
+func (c Credentials) WithDefaults(defaults Credentials) Credentials {
+	if c.Auth == "" && c.Token == "" && c.Secret == "" {
+		c.Auth = defaults.Auth
+	}
+	if c.Name == "" && c.Type() == defaults.Type() {
+		c.Name = defaults.Name
+	}
+	return c
+}
+
+// Authorizer of requests by credentials
+func (c Credentials) Authorizer() (Authorizer, error) {
+	switch c.Type() {
+	case AuthHeader, AuthQuery:
+		if c.Key == "" {
+			return nil, fmt.Errorf("API key is required for %s auth", c.Type())
+		}
+		if c.Name == "" {
+			return nil, fmt.Errorf("API key name is required for %s auth", c.Type())
+		}
+		if c.Type() == AuthQuery {
+			return &QueryAuthorizer{Name: c.Name, Key: c.Key}, nil
+		}
+		return &HeaderAuthorizer{Name: c.Name, Key: c.Key}, nil
+	case AuthBearer:
+		if c.Token == "" {
+			return nil, fmt.Errorf("API token is required for %s auth", c.Type())
+		}
+		return &BearerAuthorizer{Token: c.Token}, nil
+	case AuthHMAC:
+		if c.Key == "" || c.Secret == "" {
+			return nil, fmt.Errorf("API key and secret are required for %s auth", c.Type())
+		}
+		prefix := c.Name
+		if prefix == "" {
+			prefix = defaultHMACPrefix
+		}
+		return &HMACAuthorizer{Prefix: prefix, Key: c.Key, Secret: c.Secret}, nil
+	}
+	return nil, fmt.Errorf("Unknown auth type: %q", c.Auth)
+}
+
+// String of credentials without secrets, e.g. for logs
+func (c Credentials) String() string {
+	return fmt.Sprintf("%s auth %q key %s", c.Type(), c.Name, mask(c.Key+c.Token))
+}
+
+// mask secret value keeping the last 4 chars of long values
+func mask(value string) string {
+	if len(value) < 12 {
+		return "****"
+	}
+	return "****" + value[len(value)-4:]
+}
+
+// Store of credentials by downloader name
+type Store map[string]Credentials
+
+// LoadFile of JSON secrets by downloader name, e.g.
+// {"CRYPTOWAT": {"key": "..."}, "KRAKEN": {"key": "...", "secret": "..."}}
+func LoadFile(path string) (Store, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Read secrets file fail: %s", err)
+	}
+	store := Store{}
+	if err := json.Unmarshal(data, &store); err != nil {
+		return nil, fmt.Errorf("Parse secrets file fail: %s", err)
+	}
+	return store, nil
+}
+
+// Lookup credentials of downloader. Env fields override file fields:
+// <NAME>_AUTH, <NAME>_AUTH_NAME, <NAME>_API_KEY, <NAME>_API_SECRET and <NAME>_API_TOKEN.
+// Returns false if credentials are empty
+func (s Store) Lookup(name string, getenv func(string) string) (Credentials, bool) {
+	c := s[name]
+	for suffix, field := range map[string]*string{
+		"_AUTH":       &c.Auth,
+		"_AUTH_NAME":  &c.Name,
+		"_API_KEY":    &c.Key,
+		"_API_SECRET": &c.Secret,
+		"_API_TOKEN":  &c.Token,
+	} {
+		if value := getenv(name + suffix); value != "" {
+			*field = value
+		}
+	}
+	return c, !c.Empty()
+}
@@ -0,0 +1,112 @@
+package credentials
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentials_Type(t *testing.T) {
+	assert.Equal(t, AuthHeader, Credentials{Key: "TEST_KEY"}.Type())
+	assert.Equal(t, AuthHMAC, Credentials{Key: "TEST_KEY", Secret: "TEST_SECRET"}.Type())
+	assert.Equal(t, AuthBearer, Credentials{Token: "TEST_TOKEN"}.Type())
+	assert.Equal(t, AuthQuery, Credentials{Auth: AuthQuery, Key: "TEST_KEY"}.Type())
+}
+
+func TestCredentials_WithDefaults(t *testing.T) {
+	defaults := Credentials{Auth: AuthQuery, Name: "api_key"}
+	assert.Equal(t, Credentials{Auth: AuthQuery, Name: "api_key", Key: "TEST_KEY"}, Credentials{Key: "TEST_KEY"}.WithDefaults(defaults))
+
+	// Explicit name is kept
+	assert.Equal(t, "key", Credentials{Name: "key", Key: "TEST_KEY"}.WithDefaults(defaults).Name)
+
+	// Defaults of other auth type are not applied
+	assert.Equal(t, Credentials{Token: "TEST_TOKEN"}, Credentials{Token: "TEST_TOKEN"}.WithDefaults(defaults))
+	assert.Equal(t, Credentials{Auth: AuthHeader, Key: "TEST_KEY"}, Credentials{Auth: AuthHeader, Key: "TEST_KEY"}.WithDefaults(defaults))
+}
+
+func TestCredentials_Authorizer(t *testing.T) {
+	tests := []struct {
+		name        string
+		credentials Credentials
+		expected    Authorizer
+		err         string
+	}{
+		{"header", Credentials{Name: "X-API-Key", Key: "TEST_KEY"}, &HeaderAuthorizer{Name: "X-API-Key", Key: "TEST_KEY"}, ""},
+		{"query", Credentials{Auth: AuthQuery, Name: "api_key", Key: "TEST_KEY"}, &QueryAuthorizer{Name: "api_key", Key: "TEST_KEY"}, ""},
+		{"bearer", Credentials{Token: "TEST_TOKEN"}, &BearerAuthorizer{Token: "TEST_TOKEN"}, ""},
+		{"hmac", Credentials{Key: "TEST_KEY", Secret: "TEST_SECRET"}, &HMACAuthorizer{Prefix: "API", Key: "TEST_KEY", Secret: "TEST_SECRET"}, ""},
+		{"hmac prefix", Credentials{Name: "X", Key: "TEST_KEY", Secret: "TEST_SECRET"}, &HMACAuthorizer{Prefix: "X", Key: "TEST_KEY", Secret: "TEST_SECRET"}, ""},
+		{"no name", Credentials{Key: "TEST_KEY"}, nil, "API key name is required for header auth"},
+		{"no key", Credentials{Auth: AuthQuery, Name: "api_key"}, nil, "API key is required for query auth"},
+		{"no token", Credentials{Auth: AuthBearer, Key: "TEST_KEY"}, nil, "API token is required for bearer auth"},
+		{"no secret", Credentials{Auth: AuthHMAC, Key: "TEST_KEY"}, nil, "API key and secret are required for hmac auth"},
+		{"unknown", Credentials{Auth: "TEST_AUTH"}, nil, `Unknown auth type: "TEST_AUTH"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authorizer, err := tt.credentials.Authorizer()
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, authorizer)
+		})
+	}
+}
+
+func TestCredentials_String(t *testing.T) {
+	assert.Equal(t, `header auth "X-CW-API-Key" key ****`, Credentials{Name: "X-CW-API-Key", Key: "SHORT"}.String())
+	assert.Equal(t, `hmac auth "" key ****CDEF`, Credentials{Key: "0123456789ABCDEF", Secret: "TEST_SECRET"}.String())
+}
+
+func TestLoadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "secrets.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"CRYPTOWAT": {"key": "TEST_KEY"}, "KRAKEN": {"auth": "hmac", "key": "TEST_KEY", "secret": "TEST_SECRET"}}`), 0600))
+	store, err := LoadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, Store{
+		"CRYPTOWAT": {Key: "TEST_KEY"},
+		"KRAKEN":    {Auth: AuthHMAC, Key: "TEST_KEY", Secret: "TEST_SECRET"},
+	}, store)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`[]`), 0600))
+	_, err = LoadFile(path)
+	assert.Contains(t, err.Error(), "Parse secrets file fail")
+
+	_, err = LoadFile(filepath.Join(dir, "missing.json"))
+	assert.Contains(t, err.Error(), "Read secrets file fail")
+}
+
+func TestStore_Lookup(t *testing.T) {
+	store := Store{"KRAKEN": {Key: "FILE_KEY", Secret: "FILE_SECRET"}}
+	env := map[string]string{
+		"KRAKEN_API_KEY":       "ENV_KEY",
+		"CRYPTOWAT_API_TOKEN":  "ENV_TOKEN",
+		"CRYPTOWAT_AUTH":       AuthBearer,
+		"CRYPTOCOMPARE_AUTH":   AuthQuery,
+		"CRYPTOCOMPARE_SECRET": "IGNORED",
+	}
+	getenv := func(key string) string { return env[key] }
+
+	// Env overrides file fields
+	c, ok := store.Lookup("KRAKEN", getenv)
+	assert.True(t, ok)
+	assert.Equal(t, Credentials{Key: "ENV_KEY", Secret: "FILE_SECRET"}, c)
+
+	c, ok = store.Lookup("CRYPTOWAT", getenv)
+	assert.True(t, ok)
+	assert.Equal(t, Credentials{Auth: AuthBearer, Token: "ENV_TOKEN"}, c)
+
+	// Credentials without key and token are not used
+	_, ok = store.Lookup("CRYPTOCOMPARE", getenv)
+	assert.False(t, ok)
+}
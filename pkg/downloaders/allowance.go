@@ -0,0 +1,102 @@
+package downloaders
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// maxAllowanceDelay limits slowing down of one request by remaining allowance
+const maxAllowanceDelay = time.Minute
+
+// AllowanceError is returned instead of request which would exhaust API allowance
+type AllowanceError struct {
+	ResetAt time.Time
+}
+
+// Error implements error interface
+func (ae *AllowanceError) Error() string {
+	return fmt.Sprintf("API allowance is exhausted until %s", ae.ResetAt.UTC().Format(time.RFC3339))
+}
+
+// allowance of API budget which is reset every reset period from the start
+// of period, e.g. every hour. Zero value has unknown budget and doesn't limit requests
+type allowance struct {
+	mu          sync.Mutex
+	cost        float64
+	remaining   float64
+	updated     time.Time
+	resetAt     time.Time
+	resetPeriod time.Duration
+	now         func() time.Time
+}
+
+// clock of allowance
+func (a *allowance) clock() time.Time {
+	if a.now == nil {
+		return time.Now()
+	}
+	return a.now()
+}
+
+// update budget by cost of the last request and remaining allowance
+func (a *allowance) update(cost, remaining float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.clock()
+	a.cost, a.remaining, a.updated = cost, remaining, now
+	a.resetAt = now.Truncate(a.resetPeriod).Add(a.resetPeriod)
+}
+
+// exhaust allowance until reset, e.g. on 429 response. Retry-After is used if it is set
+func (a *allowance) exhaust(retryAfter time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.clock()
+	a.remaining, a.updated = 0, now
+	a.resetAt = now.Truncate(a.resetPeriod).Add(a.resetPeriod)
+	if retryAfter > 0 {
+		a.resetAt = now.Add(retryAfter)
+	}
+}
+
+// delay of the next request. Requests are paced to spread remaining allowance
+// until reset. Returns *AllowanceError if the next request would exhaust allowance
+func (a *allowance) delay() (time.Duration, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.clock()
+	if a.resetAt.IsZero() {
+		return 0, nil
+	}
+	if !now.Before(a.resetAt) {
+		// Budget is reset and unknown until the next response
+		a.cost, a.remaining, a.resetAt = 0, 0, time.Time{}
+		return 0, nil
+	}
+	if a.remaining <= 0 || a.remaining < a.cost {
+		return 0, &AllowanceError{ResetAt: a.resetAt}
+	}
+	if a.cost == 0 {
+		return 0, nil
+	}
+
+	// Cost and budget may be fractional, e.g. Cryptowatch credits
+	requests := a.remaining / a.cost
+	wait := time.Duration(float64(a.resetAt.Sub(a.updated))/requests) - now.Sub(a.updated)
+	if wait < 0 {
+		return 0, nil
+	}
+	if wait > maxAllowanceDelay {
+		return maxAllowanceDelay, nil
+	}
+	return wait, nil
+}
+
+// status of allowance: last request cost and remaining budget
+func (a *allowance) status() (cost, remaining float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.cost, a.remaining
+}
@@ -0,0 +1,107 @@
+package downloaders
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAllowance(now *time.Time) *allowance {
+	return &allowance{
+		resetPeriod: time.Hour,
+		now:         func() time.Time { return *now },
+	}
+}
+
+func TestAllowance_delay(t *testing.T) {
+	now := time.Date(2019, 9, 27, 6, 0, 0, 0, time.UTC)
+	a := newTestAllowance(&now)
+
+	// Unknown budget is not limited
+	delay, err := a.delay()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), delay)
+
+	// Plenty of budget
+	a.update(1000, 3600*1000)
+	delay, err = a.delay()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, delay)
+
+	// Elapsed time is taken into account
+	now = now.Add(400 * time.Millisecond)
+	delay, err = a.delay()
+	assert.NoError(t, err)
+	assert.Equal(t, 600*time.Millisecond, delay)
+	now = now.Add(time.Second)
+	delay, err = a.delay()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), delay)
+
+	// Shrinking budget slows down requests up to max delay
+	a.update(1000, 30*1000)
+	delay, err = a.delay()
+	assert.NoError(t, err)
+	assert.True(t, delay > time.Minute-2*time.Second && delay <= maxAllowanceDelay, "delay %s", delay)
+	a.update(1000, 2*1000)
+	delay, err = a.delay()
+	assert.NoError(t, err)
+	assert.Equal(t, maxAllowanceDelay, delay)
+
+	// Request which would exhaust budget is paused until reset
+	a.update(1000, 999)
+	_, err = a.delay()
+	assert.EqualError(t, err, "API allowance is exhausted until 2019-09-27T07:00:00Z")
+	assert.Equal(t, time.Date(2019, 9, 27, 7, 0, 0, 0, time.UTC), err.(*AllowanceError).ResetAt)
+
+	cost, remaining := a.status()
+	assert.Equal(t, float64(1000), cost)
+	assert.Equal(t, float64(999), remaining)
+
+	// Budget is unknown after reset
+	now = time.Date(2019, 9, 27, 7, 0, 0, 0, time.UTC)
+	delay, err = a.delay()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), delay)
+	cost, remaining = a.status()
+	assert.Equal(t, float64(0), cost)
+	assert.Equal(t, float64(0), remaining)
+}
+
+func TestAllowance_delayFractional(t *testing.T) {
+	now := time.Date(2019, 9, 27, 6, 0, 0, 0, time.UTC)
+	a := newTestAllowance(&now)
+
+	// 400 requests of fractional cost are spread until reset
+	a.update(0.025, 10)
+	delay, err := a.delay()
+	assert.NoError(t, err)
+	assert.Equal(t, 9*time.Second, delay)
+
+	// Budget less than one request cost is exhausted
+	a.update(0.025, 0.02)
+	_, err = a.delay()
+	assert.EqualError(t, err, "API allowance is exhausted until 2019-09-27T07:00:00Z")
+}
+
+func TestAllowance_exhaust(t *testing.T) {
+	now := time.Date(2019, 9, 27, 6, 30, 0, 0, time.UTC)
+	a := newTestAllowance(&now)
+
+	a.exhaust(0)
+	_, err := a.delay()
+	assert.EqualError(t, err, "API allowance is exhausted until 2019-09-27T07:00:00Z")
+
+	a.exhaust(time.Minute)
+	_, err = a.delay()
+	assert.EqualError(t, err, "API allowance is exhausted until 2019-09-27T06:31:00Z")
+}
+
+func TestAllowance_zeroValue(t *testing.T) {
+	a := &allowance{}
+	a.update(1000, 0)
+	delay, err := a.delay()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), delay)
+}
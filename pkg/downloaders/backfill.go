@@ -0,0 +1,91 @@
+package downloaders
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dneprix/ohlc/pkg/assets"
+	"github.com/dneprix/ohlc/pkg/backfills"
+)
+
+// defaultBackfillPageSize is a number of candles requested by one backfill page
+const defaultBackfillPageSize = 500
+
+// ProcessBackfill downloads asset candles backwards page by page from
+// backfill cursor to backfill from time. Progress is saved after each page,
+// so failed or interrupted backfill is resumed from the last saved page.
+// Backfill fails on range older than history of HistoryDownloader
+func ProcessBackfill(ctx context.Context, d RangeDownloader, asset *assets.Asset, backfill *backfills.Backfill, pageSize uint) error {
+	if backfill.Period == 0 {
+		return fmt.Errorf("Backfill period is not set")
+	}
+	if pageSize == 0 {
+		pageSize = defaultBackfillPageSize
+	}
+	span := int64(backfill.Period) * int64(pageSize)
+	logger := assets.Logger(d.Logger(), asset).WithField("period", backfill.Period)
+
+	for !backfill.Done {
+		// Previous page of candles which close not later than cursor
+		r := Range{
+			Period: backfill.Period,
+			After:  backfill.Cursor - span + int64(backfill.Period),
+			Before: backfill.Cursor,
+		}
+		if r.After < backfill.FromTime {
+			r.After = backfill.FromTime
+		}
+
+		// Range older than downloader history would be empty. Backfill is not done then
+		if hd, ok := d.(HistoryDownloader); ok {
+			if oldest := hd.OldestCloseTime(backfill.Period, time.Now()); r.Before < oldest {
+				return fmt.Errorf("Backfill range is older than downloader history: cursor=%d oldest=%d", backfill.Cursor, oldest)
+			}
+		}
+
+		// Check and wait timer since last downloading
+		if err := d.CheckWaitTimer(ctx); err != nil {
+			return fmt.Errorf("Abort waiting timer: %s", err)
+		}
+		logger.Infof("Download backfill page: after=%d before=%d", r.After, r.Before)
+
+		downloadCtx, cancel := context.WithTimeout(ctx, d.Timeout())
+		candlesData, err := d.DownloadCandlesRange(downloadCtx, asset, r)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("Download candles fail: %s", err)
+		}
+
+		candlesData, err = validateCandles(d, asset, candlesData, logger)
+		if err != nil {
+			return fmt.Errorf("Validate candles fail: %s", err)
+		}
+
+		if len(candlesData) == 0 {
+			logger.Warn("Download ZERO candles data: Nothing to save")
+		} else {
+			result, err := saveCandles(ctx, d, asset, candlesData)
+			if err != nil {
+				return fmt.Errorf("Save candles data fail: %s", err)
+			}
+			logger.Debugf(
+				"Candles data was successfull saved: inserted=%d updated=%d unchanged=%d",
+				result.Inserted, result.Updated, result.Unchanged,
+			)
+			if result.Inserted+result.Updated > 0 {
+				resampleCandles(ctx, d, asset.ID, candlesData, logger)
+			}
+		}
+
+		// Move cursor before downloaded page
+		backfill.Cursor = r.After - int64(backfill.Period)
+		backfill.Done = backfill.Cursor < backfill.FromTime
+		if err := backfills.SaveProgress(ctx, d.DB(), backfill); err != nil {
+			return fmt.Errorf("Save backfill progress fail: %s", err)
+		}
+	}
+
+	logger.Info("Backfill is done")
+	return nil
+}
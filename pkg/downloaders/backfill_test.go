@@ -0,0 +1,230 @@
+package downloaders
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dneprix/ohlc/pkg/assets"
+	"github.com/dneprix/ohlc/pkg/backfills"
+	"github.com/dneprix/ohlc/pkg/candles"
+	"github.com/dneprix/ohlc/pkg/limiters"
+	"github.com/dneprix/ohlc/pkg/validators"
+)
+
+type mockRangeDownloader struct {
+	*downloader
+	ranges                   []Range
+	TestDownloadCandlesRange func(Range) ([]*candles.Candle, error)
+}
+
+func (m *mockRangeDownloader) DownloadCandles(ctx context.Context, asset *assets.Asset) ([]*candles.Candle, error) {
+	return m.DownloadCandlesRange(ctx, asset, Range{})
+}
+
+func (m *mockRangeDownloader) DownloadCandlesRange(ctx context.Context, asset *assets.Asset, r Range) ([]*candles.Candle, error) {
+	m.ranges = append(m.ranges, r)
+	return m.TestDownloadCandlesRange(r)
+}
+
+func newMockRangeDownloader(db *sqlx.DB, download func(Range) ([]*candles.Candle, error)) *mockRangeDownloader {
+	logger, _ := test.NewNullLogger()
+	return &mockRangeDownloader{
+		downloader: &downloader{
+			db:      db,
+			name:    "TEST_DOWNLOADER",
+			timeout: time.Second,
+			logger: logger.WithFields(logrus.Fields{
+				"downloader": "TEST_DOWNLOADER",
+			}),
+		},
+		TestDownloadCandlesRange: download,
+	}
+}
+
+func TestProcessBackfillSuccess(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	db := sqlx.NewDb(mockDB, "sqlmock")
+
+	d := newMockRangeDownloader(db, func(r Range) ([]*candles.Candle, error) {
+		return []*candles.Candle{{AssetID: 1, Period: r.Period, CloseTime: r.Before}}, nil
+	})
+	asset := &assets.Asset{ID: 1, CoinFrom: "BTC", CoinTo: "USD", Exchange: "KRAKEN"}
+	backfill := &backfills.Backfill{ID: 1, AssetID: 1, Period: 60, FromTime: 600, ToTime: 1200, Cursor: 1200}
+
+	for _, cursor := range []int64{840, 540} {
+		mock.ExpectBegin()
+		mock.ExpectPrepare("INSERT INTO candles")
+		mock.ExpectQuery("INSERT INTO candles").WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+		mock.ExpectCommit()
+		mock.ExpectExec("UPDATE backfills").
+			WithArgs(cursor, cursor < 600, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	err := ProcessBackfill(context.Background(), d, asset, backfill, 6)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Range{
+		{Period: 60, After: 900, Before: 1200},
+		{Period: 60, After: 600, Before: 840},
+	}, d.ranges)
+	assert.True(t, backfill.Done)
+	assert.Equal(t, int64(540), backfill.Cursor)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestProcessBackfillDone(t *testing.T) {
+	d := newMockRangeDownloader(nil, nil)
+	asset := &assets.Asset{ID: 1}
+	backfill := &backfills.Backfill{ID: 1, Period: 60, Done: true}
+
+	err := ProcessBackfill(context.Background(), d, asset, backfill, 0)
+
+	assert.NoError(t, err)
+	assert.Empty(t, d.ranges)
+}
+
+func TestProcessBackfillNoCandles(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	db := sqlx.NewDb(mockDB, "sqlmock")
+
+	d := newMockRangeDownloader(db, func(r Range) ([]*candles.Candle, error) {
+		return []*candles.Candle{}, nil
+	})
+	asset := &assets.Asset{ID: 1}
+	backfill := &backfills.Backfill{ID: 1, Period: 60, FromTime: 600, ToTime: 1200, Cursor: 1200}
+
+	mock.ExpectExec("UPDATE backfills").
+		WithArgs(540, true, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := ProcessBackfill(context.Background(), d, asset, backfill, 0)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Range{{Period: 60, After: 600, Before: 1200}}, d.ranges)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestProcessBackfillFailDownload(t *testing.T) {
+	d := newMockRangeDownloader(nil, func(r Range) ([]*candles.Candle, error) {
+		return nil, fmt.Errorf("HTTP error")
+	})
+	asset := &assets.Asset{ID: 1}
+	backfill := &backfills.Backfill{ID: 1, Period: 60, FromTime: 600, ToTime: 1200, Cursor: 1200}
+
+	err := ProcessBackfill(context.Background(), d, asset, backfill, 0)
+
+	assert.EqualError(t, err, "Download candles fail: HTTP error")
+	assert.Equal(t, int64(1200), backfill.Cursor)
+	assert.False(t, backfill.Done)
+}
+
+func TestProcessBackfillFailSaveProgress(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	db := sqlx.NewDb(mockDB, "sqlmock")
+
+	d := newMockRangeDownloader(db, func(r Range) ([]*candles.Candle, error) {
+		return []*candles.Candle{}, nil
+	})
+	asset := &assets.Asset{ID: 1}
+	backfill := &backfills.Backfill{ID: 1, Period: 60, FromTime: 600, ToTime: 1200, Cursor: 1200}
+
+	mock.ExpectExec("UPDATE backfills").WillReturnError(fmt.Errorf("DB error"))
+
+	err := ProcessBackfill(context.Background(), d, asset, backfill, 0)
+
+	assert.EqualError(t, err, "Save backfill progress fail: DB error")
+}
+
+func TestProcessBackfillContextDone(t *testing.T) {
+	d := newMockRangeDownloader(nil, nil)
+	d.limiter = limiters.NewMemory()
+	d.rate = limiters.Every(time.Hour)
+	asset := &assets.Asset{ID: 1}
+	backfill := &backfills.Backfill{ID: 1, Period: 60, FromTime: 600, ToTime: 1200, Cursor: 1200}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := ProcessBackfill(ctx, d, asset, backfill, 0)
+
+	assert.EqualError(t, err, "Abort waiting timer: context canceled")
+	assert.Empty(t, d.ranges)
+}
+
+func TestProcessBackfillFailPeriod(t *testing.T) {
+	d := newMockRangeDownloader(nil, nil)
+	asset := &assets.Asset{ID: 1}
+
+	err := ProcessBackfill(context.Background(), d, asset, &backfills.Backfill{ID: 1}, 0)
+
+	assert.EqualError(t, err, "Backfill period is not set")
+}
+
+func TestProcessBackfillFailValidation(t *testing.T) {
+	d := newMockRangeDownloader(nil, func(r Range) ([]*candles.Candle, error) {
+		return []*candles.Candle{{AssetID: 1, Period: 60, CloseTime: 1201}}, nil
+	})
+	d.validator = validators.Default().Add(validators.AlignedCloseTime, validators.ActionReject)
+	asset := &assets.Asset{ID: 1}
+	backfill := &backfills.Backfill{ID: 1, Period: 60, FromTime: 600, ToTime: 1200, Cursor: 1200}
+
+	err := ProcessBackfill(context.Background(), d, asset, backfill, 0)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Validate candles fail: Candles batch is rejected by rule aligned-close-time")
+	assert.Equal(t, int64(1200), backfill.Cursor)
+}
+
+type mockHistoryDownloader struct {
+	*mockRangeDownloader
+	oldest int64
+}
+
+func (m *mockHistoryDownloader) OldestCloseTime(period uint, now time.Time) int64 {
+	return m.oldest
+}
+
+func TestProcessBackfillOlderThanHistory(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	db := sqlx.NewDb(mockDB, "sqlmock")
+
+	// Only the first page overlaps downloader history
+	d := &mockHistoryDownloader{
+		mockRangeDownloader: newMockRangeDownloader(db, func(r Range) ([]*candles.Candle, error) {
+			return []*candles.Candle{}, nil
+		}),
+		oldest: 1000,
+	}
+	asset := &assets.Asset{ID: 1}
+	backfill := &backfills.Backfill{ID: 1, Period: 60, FromTime: 600, ToTime: 1200, Cursor: 1200}
+
+	mock.ExpectExec("UPDATE backfills").
+		WithArgs(840, false, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := ProcessBackfill(context.Background(), d, asset, backfill, 6)
+
+	assert.EqualError(t, err, "Backfill range is older than downloader history: cursor=840 oldest=1000")
+	assert.Equal(t, []Range{{Period: 60, After: 900, Before: 1200}}, d.ranges)
+	assert.False(t, backfill.Done)
+	assert.Equal(t, int64(840), backfill.Cursor)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
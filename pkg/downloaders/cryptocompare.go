@@ -1,6 +1,12 @@
 package downloaders
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -8,10 +14,27 @@ import (
 
 	"github.com/dneprix/ohlc/pkg/assets"
 	"github.com/dneprix/ohlc/pkg/candles"
+	"github.com/dneprix/ohlc/pkg/credentials"
 )
 
 const cryptocompareWaitTime = 10 * time.Second
 
+// cryptocompareHost is a rate limit key of CryptoCompare API
+const cryptocompareHost = "min-api.cryptocompare.com"
+
+// cryptocompareAuth sends API key by query param
+var cryptocompareAuth = credentials.Credentials{Auth: credentials.AuthQuery, Name: "api_key"}
+
+// cryptocompareMaxLimit is the maximum number of candles in one response
+const cryptocompareMaxLimit = 2000
+
+// cryptocompareEndpointPeriods maps historical endpoints to candle period in seconds
+var cryptocompareEndpointPeriods = map[string]uint{
+	"histominute": 60,
+	"histohour":   3600,
+	"histoday":    86400,
+}
+
 // CryptocompareDownloader structure
 type CryptocompareDownloader struct {
 	*downloader
@@ -19,13 +42,138 @@ type CryptocompareDownloader struct {
 
 // NewCryptocompareDownloader constructor
 func NewCryptocompareDownloader(db *sqlx.DB, logger *logrus.Logger) *CryptocompareDownloader {
-	return &CryptocompareDownloader{
+	d := &CryptocompareDownloader{
 		newDownloader(db, logger, "CRYPTOCOMPARE", cryptocompareWaitTime),
 	}
+	d.SetLimitKey(cryptocompareHost)
+	d.authDefaults = cryptocompareAuth
+	return d
 }
 
 // DownloadCandles function
-func (kd *CryptocompareDownloader) DownloadCandles(asset *assets.Asset) ([]*candles.Candle, error) {
-	// TODO: Implement DownloadCandles for CryptocompareDownloader
-	return nil, nil
+func (cd *CryptocompareDownloader) DownloadCandles(ctx context.Context, asset *assets.Asset) ([]*candles.Candle, error) {
+	return cd.DownloadCandlesRange(ctx, asset, Range{})
+}
+
+// DownloadCandlesRange function. Range is requested by toTs and limit params
+func (cd *CryptocompareDownloader) DownloadCandlesRange(ctx context.Context, asset *assets.Asset, r Range) ([]*candles.Candle, error) {
+	period, err := cryptocomparePeriod(asset.URL)
+	if err != nil {
+		return nil, err
+	}
+	if r.Period != 0 && r.Period != period {
+		return nil, fmt.Errorf("Unsupported period for asset url: %d", r.Period)
+	}
+
+	params := url.Values{}
+	if r.Before != 0 {
+		// toTs is compared with candle open time
+		params.Set("toTs", strconv.FormatInt(r.Before-int64(period), 10))
+	}
+	if r.After != 0 && r.Before != 0 {
+		limit := (r.Before - r.After) / int64(period)
+		if limit < 1 {
+			limit = 1
+		}
+		if limit > cryptocompareMaxLimit {
+			limit = cryptocompareMaxLimit
+		}
+		params.Set("limit", strconv.FormatInt(limit, 10))
+	}
+	requestURL, err := withQuery(asset.URL, params)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := cd.HTTPClient().Get(ctx, requestURL)
+	if err != nil {
+		return nil, err
+	}
+
+	candlesResponse := CryptocompareResponse{}
+	if err := json.Unmarshal(data, &candlesResponse); err != nil {
+		return nil, fmt.Errorf("Parse response fail: %s", err)
+	}
+	if candlesResponse.Response == "Error" {
+		return nil, &CryptocompareError{Message: candlesResponse.Message}
+	}
+
+	// Data is only an object with candles for successful responses
+	candlesResponseData := CryptocompareResponseData{}
+	if err := json.Unmarshal(candlesResponse.Data, &candlesResponseData); err != nil {
+		return nil, fmt.Errorf("Parse response data fail: %s", err)
+	}
+
+	candlesData := make([]*candles.Candle, 0, len(candlesResponseData.Data))
+	for _, p := range candlesResponseData.Data {
+		candlesData = append(candlesData, &candles.Candle{
+			AssetID:    asset.ID,
+			Period:     period,
+			CloseTime:  p.Time + int64(period),
+			OpenPrice:  p.Open,
+			HighPrice:  p.High,
+			LowPrice:   p.Low,
+			ClosePrice: p.Close,
+			Volume:     p.VolumeFrom,
+		})
+	}
+
+	return r.Filter(candlesData), nil
+}
+
+// cryptocomparePeriod returns candle period in seconds from endpoint and aggregate param of url
+func cryptocomparePeriod(rawURL string) (uint, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0, fmt.Errorf("Parse asset url fail: %s", err)
+	}
+	endpoint := path.Base(u.Path)
+	period, ok := cryptocompareEndpointPeriods[endpoint]
+	if !ok {
+		return 0, fmt.Errorf("Unsupported asset url endpoint: %q", endpoint)
+	}
+	aggregate := u.Query().Get("aggregate")
+	if aggregate == "" {
+		return period, nil
+	}
+	n, err := strconv.ParseUint(aggregate, 10, 32)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("Parse asset url aggregate fail: %q", aggregate)
+	}
+	return period * uint(n), nil
+}
+
+// CryptocompareError is an error message returned by CryptoCompare API
+type CryptocompareError struct {
+	Message string
+}
+
+// Error implements error interface
+func (ce *CryptocompareError) Error() string {
+	return fmt.Sprintf("Cryptocompare response error: %s", ce.Message)
+}
+
+// CryptocompareResponse structure
+type CryptocompareResponse struct {
+	Response string          `json:"Response"`
+	Message  string          `json:"Message"`
+	Data     json.RawMessage `json:"Data"`
+}
+
+// CryptocompareResponseData structure
+type CryptocompareResponseData struct {
+	TimeFrom int64                         `json:"TimeFrom"`
+	TimeTo   int64                         `json:"TimeTo"`
+	Data     []CryptocompareResponsePeriod `json:"Data"`
+}
+
+// CryptocompareResponsePeriod structure
+type CryptocompareResponsePeriod struct {
+	Time       int64           `json:"time"`
+	Open       candles.Decimal `json:"open"`
+	High       candles.Decimal `json:"high"`
+	Low        candles.Decimal `json:"low"`
+	Close      candles.Decimal `json:"close"`
+	VolumeFrom candles.Decimal `json:"volumefrom"`
+	VolumeTo   candles.Decimal `json:"volumeto"`
 }
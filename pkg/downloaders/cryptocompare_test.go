@@ -1,6 +1,10 @@
 package downloaders
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -9,6 +13,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/dneprix/ohlc/pkg/assets"
+	"github.com/dneprix/ohlc/pkg/candles"
 )
 
 func TestNewCryptocompareDownloader(t *testing.T) {
@@ -24,13 +29,235 @@ func TestNewCryptocompareDownloader(t *testing.T) {
 	assert.Equal(t, expectedLogger, actual.logger.Logger)
 	assert.Equal(t, expectedDB, actual.db)
 	assert.Equal(t, expectedName, actual.name)
-	assert.Equal(t, expectedWaitTime, actual.wait)
+	assert.Equal(t, expectedWaitTime, actual.rate.Every)
+	assert.Equal(t, cryptocompareHost, actual.limitKey)
 }
 
-func TestCryptocompareDownloader_DownloadCandles(t *testing.T) {
+func TestCryptocompareDownloader_DownloadCandlesSuccess(t *testing.T) {
 	d := &CryptocompareDownloader{}
-	asset := &assets.Asset{}
-	actual, err := d.DownloadCandles(asset)
-	assert.Nil(t, actual)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(
+			`{
+          "Response": "Success",
+          "Message": "",
+          "HasWarning": false,
+          "Type": 100,
+          "RateLimit": {},
+          "Data": {
+            "Aggregated": false,
+            "TimeFrom": 1569560400,
+            "TimeTo": 1569564000,
+            "Data": [
+              {"time": 1569560400, "high": 7950.1, "low": 7920.5, "open": 7930.2, "volumefrom": 120.5, "volumeto": 956000.1, "close": 7940.3, "conversionType": "direct", "conversionSymbol": ""},
+              {"time": 1569564000, "high": 7960.1, "low": 7930.5, "open": 7940.3, "volumefrom": 80.25, "volumeto": 637000.7, "close": 7955.6, "conversionType": "direct", "conversionSymbol": ""}
+            ]
+          }
+        }
+        `))
+		return
+	}))
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: server.URL + "/data/v2/histohour?fsym=BTC&tsym=USD&e=Kraken",
+	}
+	actual, err := d.DownloadCandles(context.Background(), asset)
+	assert.NoError(t, err)
+	assert.Len(t, actual, 2)
+	assert.Equal(t, uint(1), actual[0].AssetID)
+	assert.Equal(t, uint(3600), actual[0].Period)
+	assert.Equal(t, int64(1569564000), actual[0].CloseTime)
+	assert.Equal(t, candles.MustParseDecimal("7930.2"), actual[0].OpenPrice)
+	assert.Equal(t, candles.MustParseDecimal("7950.1"), actual[0].HighPrice)
+	assert.Equal(t, candles.MustParseDecimal("7920.5"), actual[0].LowPrice)
+	assert.Equal(t, candles.MustParseDecimal("7940.3"), actual[0].ClosePrice)
+	assert.Equal(t, candles.MustParseDecimal("120.5"), actual[0].Volume)
+}
+
+func TestCryptocompareDownloader_DownloadCandlesAggregate(t *testing.T) {
+	d := &CryptocompareDownloader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Response":"Success","Data":{"Data":[{"time":1569560400,"high":1,"low":1,"open":1,"volumefrom":1,"volumeto":1,"close":1}]}}`))
+		return
+	}))
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: server.URL + "/data/histominute?fsym=BTC&tsym=USD&aggregate=15",
+	}
+	actual, err := d.DownloadCandles(context.Background(), asset)
+	assert.NoError(t, err)
+	assert.Len(t, actual, 1)
+	assert.Equal(t, uint(900), actual[0].Period)
+	assert.Equal(t, int64(1569561300), actual[0].CloseTime)
+}
+
+func TestCryptocompareDownloader_DownloadCandlesRange(t *testing.T) {
+	d := &CryptocompareDownloader{}
+
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Write([]byte(`{"Response":"Success","Data":{"Data":[
+          {"time":1569553200,"high":1,"low":1,"open":1,"volumefrom":1,"volumeto":1,"close":1},
+          {"time":1569556800,"high":1,"low":1,"open":1,"volumefrom":1,"volumeto":1,"close":1},
+          {"time":1569560400,"high":1,"low":1,"open":1,"volumefrom":1,"volumeto":1,"close":1}
+        ]}}`))
+		return
+	}))
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: server.URL + "/data/v2/histohour?fsym=BTC&tsym=USD&limit=10",
+	}
+	actual, err := d.DownloadCandlesRange(context.Background(), asset, Range{Period: 3600, After: 1569560400, Before: 1569564000})
+	assert.NoError(t, err)
+	assert.Equal(t, "1569560400", query.Get("toTs"))
+	assert.Equal(t, "1", query.Get("limit"))
+	assert.Len(t, actual, 2)
+	assert.Equal(t, int64(1569560400), actual[0].CloseTime)
+	assert.Equal(t, int64(1569564000), actual[1].CloseTime)
+}
+
+func TestCryptocompareDownloader_DownloadCandlesRangeLimit(t *testing.T) {
+	d := &CryptocompareDownloader{}
+
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Write([]byte(`{"Response":"Success","Data":{"Data":[]}}`))
+		return
+	}))
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: server.URL + "/data/v2/histominute?fsym=BTC&tsym=USD",
+	}
+	actual, err := d.DownloadCandlesRange(context.Background(), asset, Range{After: 1569000000, Before: 1569564000})
 	assert.NoError(t, err)
+	assert.Len(t, actual, 0)
+	assert.Equal(t, "1569563940", query.Get("toTs"))
+	assert.Equal(t, "2000", query.Get("limit"))
+}
+
+func TestCryptocompareDownloader_DownloadCandlesRangeFailPeriod(t *testing.T) {
+	d := &CryptocompareDownloader{}
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: "http://localhost/data/histominute",
+	}
+	actual, err := d.DownloadCandlesRange(context.Background(), asset, Range{Period: 3600})
+	assert.Nil(t, actual)
+	assert.Error(t, err)
+	assert.EqualError(t, err, "Unsupported period for asset url: 3600")
+}
+
+func TestCryptocompareDownloader_DownloadCandlesFailEndpoint(t *testing.T) {
+	d := &CryptocompareDownloader{}
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: "http://localhost/data/price?fsym=BTC&tsyms=USD",
+	}
+	actual, err := d.DownloadCandles(context.Background(), asset)
+	assert.Nil(t, actual)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Unsupported asset url endpoint")
+}
+
+func TestCryptocompareDownloader_DownloadCandlesFailAggregate(t *testing.T) {
+	d := &CryptocompareDownloader{}
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: "http://localhost/data/histoday?fsym=BTC&tsym=USD&aggregate=0",
+	}
+	actual, err := d.DownloadCandles(context.Background(), asset)
+	assert.Nil(t, actual)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Parse asset url aggregate fail")
+}
+
+func TestCryptocompareDownloader_DownloadCandlesFailURL(t *testing.T) {
+	d := &CryptocompareDownloader{}
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: "%",
+	}
+	actual, err := d.DownloadCandles(context.Background(), asset)
+	assert.Nil(t, actual)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Parse asset url fail")
+}
+
+func TestCryptocompareDownloader_DownloadCandlesFailHttp(t *testing.T) {
+	d := &CryptocompareDownloader{}
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: "TEST_URL/histominute",
+	}
+	actual, err := d.DownloadCandles(context.Background(), asset)
+	assert.Nil(t, actual)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Get HTTP Request fail")
+}
+
+func TestCryptocompareDownloader_DownloadCandlesFailParse(t *testing.T) {
+	d := &CryptocompareDownloader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<>"))
+		return
+	}))
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: server.URL + "/data/histominute",
+	}
+	actual, err := d.DownloadCandles(context.Background(), asset)
+	assert.Nil(t, actual)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Parse response fail")
+}
+
+func TestCryptocompareDownloader_DownloadCandlesFailParseData(t *testing.T) {
+	d := &CryptocompareDownloader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Response":"Success","Data":[]}`))
+		return
+	}))
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: server.URL + "/data/histominute",
+	}
+	actual, err := d.DownloadCandles(context.Background(), asset)
+	assert.Nil(t, actual)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Parse response data fail")
+}
+
+func TestCryptocompareDownloader_DownloadCandlesFailResponseError(t *testing.T) {
+	d := &CryptocompareDownloader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Response":"Error","Message":"fsym is a required param.","HasWarning":false,"Type":2,"RateLimit":{},"Data":{}}`))
+		return
+	}))
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: server.URL + "/data/v2/histominute",
+	}
+	actual, err := d.DownloadCandles(context.Background(), asset)
+	assert.Nil(t, actual)
+	assert.Error(t, err)
+	assert.IsType(t, &CryptocompareError{}, err)
+	assert.EqualError(t, err, "Cryptocompare response error: fsym is a required param.")
 }
@@ -1,10 +1,13 @@
 package downloaders
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -12,75 +15,194 @@ import (
 
 	"github.com/dneprix/ohlc/pkg/assets"
 	"github.com/dneprix/ohlc/pkg/candles"
+	"github.com/dneprix/ohlc/pkg/credentials"
+	"github.com/dneprix/ohlc/pkg/metrics"
 )
 
+// cryptowatName of downloader is used by allowance metrics
+const cryptowatName = "CRYPTOWAT"
+
 const cryptowatWaitTime = 5 * time.Second
 
+// cryptowatHost is a rate limit key of Cryptowatch API
+const cryptowatHost = "api.cryptowat.ch"
+
+// cryptowatAuth sends API key of paid plan by header
+var cryptowatAuth = credentials.Credentials{Auth: credentials.AuthHeader, Name: "X-CW-API-Key"}
+
+// cryptowatAllowanceReset is a period of Cryptowatch allowance
+const cryptowatAllowanceReset = time.Hour
+
 // CryptowatDownloader structure
 type CryptowatDownloader struct {
 	*downloader
+
+	// allowance of Cryptowatch API returned with each response
+	allowance allowance
 }
 
 // NewCryptowatDownloader constructor
 func NewCryptowatDownloader(db *sqlx.DB, logger *logrus.Logger) *CryptowatDownloader {
-	return &CryptowatDownloader{
-		newDownloader(db, logger, "CRYPTOWAT", cryptowatWaitTime),
+	d := &CryptowatDownloader{
+		downloader: newDownloader(db, logger, cryptowatName, cryptowatWaitTime),
+		allowance:  allowance{resetPeriod: cryptowatAllowanceReset},
 	}
+	d.SetLimitKey(cryptowatHost)
+	d.authDefaults = cryptowatAuth
+	return d
 }
 
 // DownloadCandles function
-func (cd *CryptowatDownloader) DownloadCandles(asset *assets.Asset) ([]*candles.Candle, error) {
+func (cd *CryptowatDownloader) DownloadCandles(ctx context.Context, asset *assets.Asset) ([]*candles.Candle, error) {
+	return cd.DownloadCandlesRange(ctx, asset, Range{})
+}
 
-	res, err := http.Get(asset.URL)
+// DownloadCandlesRange function. Range is requested by after, before and periods params
+func (cd *CryptowatDownloader) DownloadCandlesRange(ctx context.Context, asset *assets.Asset, r Range) ([]*candles.Candle, error) {
+	params := url.Values{}
+	if r.After != 0 {
+		params.Set("after", strconv.FormatInt(r.After, 10))
+	}
+	if r.Before != 0 {
+		params.Set("before", strconv.FormatInt(r.Before, 10))
+	}
+	if r.Period != 0 {
+		params.Set("periods", strconv.FormatUint(uint64(r.Period), 10))
+	}
+	requestURL, err := withQuery(asset.URL, params)
 	if err != nil {
-		return nil, fmt.Errorf("Get HTTP Request fail: %s", err)
+		return nil, err
+	}
+
+	data, err := cd.HTTPClient().Get(ctx, requestURL)
+	if se, ok := err.(*StatusError); ok && se.StatusCode == http.StatusTooManyRequests {
+		cd.allowance.exhaust(se.RetryAfter)
 	}
-	data, err := ioutil.ReadAll(res.Body)
-	res.Body.Close()
 	if err != nil {
-		return nil, fmt.Errorf("Read response body fail: %s", err)
+		return nil, err
 	}
 
 	candlesResponse := CryptowatResponse{}
 	if err := json.Unmarshal(data, &candlesResponse); err != nil {
 		return nil, fmt.Errorf("Parse response fail: %s", err)
 	}
+	if a := candlesResponse.Allowance; a != nil {
+		cd.allowance.update(a.Cost, a.Remaining)
+		metrics.AllowanceCost.WithLabelValues(cryptowatName).Set(a.Cost)
+		metrics.AllowanceRemaining.WithLabelValues(cryptowatName).Set(a.Remaining)
+	}
+
+	periods, err := candlesResponse.Result.Periods()
+	if err != nil {
+		return nil, err
+	}
+
+	candlesData := []*candles.Candle{}
+	for _, period := range periods {
+		// Period of range overrides asset periods
+		if r.Period == 0 && !asset.HasPeriod(period) {
+			continue
+		}
+		for _, p := range candlesResponse.Result[strconv.FormatUint(uint64(period), 10)] {
+			candlesData = append(candlesData, &candles.Candle{
+				AssetID:    asset.ID,
+				Period:     period,
+				CloseTime:  p.CloseTime,
+				OpenPrice:  p.OpenPrice,
+				HighPrice:  p.HighPrice,
+				LowPrice:   p.LowPrice,
+				ClosePrice: p.ClosePrice,
+				Volume:     p.Volume,
+			})
+		}
+	}
+
+	return r.Filter(candlesData), nil
+}
+
+// CheckWaitTimer waits for rate limit and slows down as remaining allowance shrinks.
+// Returns *AllowanceError without waiting if the next request would exhaust allowance
+func (cd *CryptowatDownloader) CheckWaitTimer(ctx context.Context) error {
+	if _, err := cd.allowance.delay(); err != nil {
+		cd.allowanceLogger().Warnf("Pause downloader: %s", err)
+		return err
+	}
+	if err := cd.downloader.CheckWaitTimer(ctx); err != nil {
+		return err
+	}
 
-	candlesData := make([]*candles.Candle, 0, len(candlesResponse.Result.Period60))
-	for _, period := range candlesResponse.Result.Period60 {
-		candlesData = append(candlesData, &candles.Candle{
-			AssetID:    asset.ID,
-			Period:     60,
-			CloseTime:  period.CloseTime,
-			OpenPrice:  period.OpenPrice,
-			HighPrice:  period.HighPrice,
-			LowPrice:   period.LowPrice,
-			ClosePrice: period.ClosePrice,
-			Volume:     period.Volume,
-		})
+	// Time of rate limit waiting is taken into account
+	delay, err := cd.allowance.delay()
+	if err != nil {
+		return err
+	}
+	if delay == 0 {
+		cd.allowanceLogger().Debug("Check allowance")
+		return nil
 	}
+	cd.allowanceLogger().Infof("Slow down by allowance: %s", delay)
+	start := time.Now()
+	defer func() {
+		metrics.WaitTimerBlocked.WithLabelValues(cd.Name()).Add(time.Since(start).Seconds())
+	}()
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-	return candlesData, nil
+// allowanceLogger with the last known allowance
+func (cd *CryptowatDownloader) allowanceLogger() *logrus.Entry {
+	cost, remaining := cd.allowance.status()
+	return cd.Logger().WithFields(logrus.Fields{
+		"allowance_cost":      cost,
+		"allowance_remaining": remaining,
+	})
 }
 
 // CryptowatResponse structure
 type CryptowatResponse struct {
-	Result struct {
-		Period60 []CryptowatResponsePeriod `json:"60"`
-	} `json:"result"`
+	Result    CryptowatResponseResult `json:"result"`
+	Allowance *CryptowatAllowance     `json:"allowance"`
+}
+
+// CryptowatAllowance is a remaining budget of API requests and cost of the request.
+// Values are fractional credits, e.g. {"cost":0.015,"remaining":9.985}
+type CryptowatAllowance struct {
+	Cost      float64 `json:"cost"`
+	Remaining float64 `json:"remaining"`
+}
+
+// CryptowatResponseResult maps period in seconds to candles
+type CryptowatResponseResult map[string][]CryptowatResponsePeriod
+
+// Periods returns sorted result periods in seconds
+func (crr CryptowatResponseResult) Periods() ([]uint, error) {
+	periods := make([]uint, 0, len(crr))
+	for key := range crr {
+		period, err := strconv.ParseUint(key, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Parse response period key fail: %q", key)
+		}
+		periods = append(periods, uint(period))
+	}
+	sort.Slice(periods, func(i, j int) bool { return periods[i] < periods[j] })
+	return periods, nil
 }
 
 // CryptowatResponsePeriod structure
 type CryptowatResponsePeriod struct {
 	CloseTime  int64
-	OpenPrice  float32
-	HighPrice  float32
-	LowPrice   float32
-	ClosePrice float32
-	Volume     float32
+	OpenPrice  candles.Decimal
+	HighPrice  candles.Decimal
+	LowPrice   candles.Decimal
+	ClosePrice candles.Decimal
+	Volume     candles.Decimal
 }
 
-// UnmarshalJSON for CryptowatResponsePeriod
+// UnmarshalJSON for CryptowatResponsePeriod. Decimal values are parsed from raw JSON number text
 func (crp *CryptowatResponsePeriod) UnmarshalJSON(buf []byte) error {
 	tmp := []interface{}{
 		&crp.CloseTime,
@@ -1,16 +1,25 @@
 package downloaders
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/dneprix/ohlc/pkg/assets"
+	"github.com/dneprix/ohlc/pkg/candles"
+	"github.com/dneprix/ohlc/pkg/limiters"
+	"github.com/dneprix/ohlc/pkg/metrics"
 )
 
 func TestNewCryptowatDownloader(t *testing.T) {
@@ -26,7 +35,9 @@ func TestNewCryptowatDownloader(t *testing.T) {
 	assert.Equal(t, expectedLogger, actual.logger.Logger)
 	assert.Equal(t, expectedDB, actual.db)
 	assert.Equal(t, expectedName, actual.name)
-	assert.Equal(t, expectedWaitTime, actual.wait)
+	assert.Equal(t, expectedWaitTime, actual.rate.Every)
+	assert.Equal(t, cryptowatHost, actual.limitKey)
+	assert.Equal(t, cryptowatAllowanceReset, actual.allowance.resetPeriod)
 }
 
 func TestCryptowatDownloader_DownloadCandlesSuccess(t *testing.T) {
@@ -56,9 +67,185 @@ func TestCryptowatDownloader_DownloadCandlesSuccess(t *testing.T) {
 		ID:  1,
 		URL: server.URL,
 	}
-	actual, err := d.DownloadCandles(asset)
+	actual, err := d.DownloadCandles(context.Background(), asset)
 	assert.NoError(t, err)
 	assert.Len(t, actual, 3)
+
+	cost, remaining := d.allowance.status()
+	assert.Equal(t, float64(28071405), cost)
+	assert.Equal(t, float64(6843524322), remaining)
+	assert.Equal(t, float64(6843524322), testutil.ToFloat64(metrics.AllowanceRemaining.WithLabelValues(cryptowatName)))
+}
+
+func TestCryptowatDownloader_DownloadCandlesFractionalAllowance(t *testing.T) {
+	d := &CryptowatDownloader{allowance: allowance{resetPeriod: cryptowatAllowanceReset}}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(
+			`{
+          "result": {
+            "60": [
+              [1481634360, 782.14, 782.14, 781.13, 781.13, 1.92525]
+            ]
+          },
+          "allowance": {
+            "cost": 0.015,
+            "remaining": 9.985
+          }
+        }
+        `))
+		return
+	}))
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: server.URL,
+	}
+	actual, err := d.DownloadCandles(context.Background(), asset)
+	assert.NoError(t, err)
+	assert.Len(t, actual, 1)
+
+	cost, remaining := d.allowance.status()
+	assert.Equal(t, 0.015, cost)
+	assert.Equal(t, 9.985, remaining)
+	assert.Equal(t, 9.985, testutil.ToFloat64(metrics.AllowanceRemaining.WithLabelValues(cryptowatName)))
+
+	// Fractional budget of hundreds of requests doesn't pause downloader
+	delay, err := d.allowance.delay()
+	assert.NoError(t, err)
+	assert.True(t, delay > 0 && delay < 10*time.Second, "delay %s", delay)
+}
+
+func TestCryptowatDownloader_DownloadCandlesAllPeriods(t *testing.T) {
+	d := &CryptowatDownloader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(
+			`{
+          "result": {
+            "3600": [
+              [1481634000, 780.14, 782.14, 779.13, 781.13, 92.52]
+            ],
+            "60": [
+              [1481634360, 782.14, 782.14, 781.13, 781.13, 1.92525],
+              [1481634420, 782.02, 782.06, 781.94, 781.98, 2.37578]
+            ],
+            "86400": [
+              [1481587200, 770.14, 790.14, 760.13, 781.13, 1092.1]
+            ]
+          }
+        }
+        `))
+		return
+	}))
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: server.URL,
+	}
+	actual, err := d.DownloadCandles(context.Background(), asset)
+	assert.NoError(t, err)
+	assert.Len(t, actual, 4)
+	assert.Equal(t, uint(60), actual[0].Period)
+	assert.Equal(t, int64(1481634360), actual[0].CloseTime)
+	assert.Equal(t, uint(60), actual[1].Period)
+	assert.Equal(t, uint(3600), actual[2].Period)
+	assert.Equal(t, int64(1481634000), actual[2].CloseTime)
+	assert.Equal(t, uint(86400), actual[3].Period)
+	assert.Equal(t, int64(1481587200), actual[3].CloseTime)
+}
+
+func TestCryptowatDownloader_DownloadCandlesAssetPeriods(t *testing.T) {
+	d := &CryptowatDownloader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(
+			`{
+          "result": {
+            "60": [[1481634360, 782.14, 782.14, 781.13, 781.13, 1.92525]],
+            "180": [[1481634360, 782.14, 782.14, 781.13, 781.13, 1.92525]],
+            "3600": [[1481634000, 780.14, 782.14, 779.13, 781.13, 92.52]]
+          }
+        }
+        `))
+		return
+	}))
+
+	asset := &assets.Asset{
+		ID:      1,
+		URL:     server.URL,
+		Periods: pq.Int64Array{3600},
+	}
+	actual, err := d.DownloadCandles(context.Background(), asset)
+	assert.NoError(t, err)
+	assert.Len(t, actual, 1)
+	assert.Equal(t, uint(3600), actual[0].Period)
+}
+
+func TestCryptowatDownloader_DownloadCandlesRange(t *testing.T) {
+	d := &CryptowatDownloader{}
+
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Write([]byte(
+			`{
+          "result": {
+            "3600": [
+              [1481630400, 780.14, 782.14, 779.13, 781.13, 92.52],
+              [1481634000, 780.14, 782.14, 779.13, 781.13, 92.52],
+              [1481637600, 780.14, 782.14, 779.13, 781.13, 92.52]
+            ]
+          }
+        }
+        `))
+		return
+	}))
+
+	asset := &assets.Asset{
+		ID:      1,
+		URL:     server.URL + "/markets/kraken/btcusd/ohlc",
+		Periods: pq.Int64Array{60},
+	}
+	actual, err := d.DownloadCandlesRange(context.Background(), asset, Range{Period: 3600, After: 1481634000, Before: 1481637000})
+	assert.NoError(t, err)
+	assert.Equal(t, "1481634000", query.Get("after"))
+	assert.Equal(t, "1481637000", query.Get("before"))
+	assert.Equal(t, "3600", query.Get("periods"))
+	assert.Len(t, actual, 1)
+	assert.Equal(t, uint(3600), actual[0].Period)
+	assert.Equal(t, int64(1481634000), actual[0].CloseTime)
+}
+
+func TestCryptowatDownloader_DownloadCandlesRangeFailURL(t *testing.T) {
+	d := &CryptowatDownloader{}
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: "%",
+	}
+	actual, err := d.DownloadCandlesRange(context.Background(), asset, Range{After: 1481634000})
+	assert.Nil(t, actual)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Parse asset url fail")
+}
+
+func TestCryptowatDownloader_DownloadCandlesFailPeriodKey(t *testing.T) {
+	d := &CryptowatDownloader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"result": {"1m": [[1481634360, 782.14, 782.14, 781.13, 781.13, 1.92525]]}}`))
+		return
+	}))
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: server.URL,
+	}
+	actual, err := d.DownloadCandles(context.Background(), asset)
+	assert.Nil(t, actual)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Parse response period key fail")
 }
 
 func TestCryptowatDownloader_DownloadCandlesFailHttp(t *testing.T) {
@@ -68,12 +255,87 @@ func TestCryptowatDownloader_DownloadCandlesFailHttp(t *testing.T) {
 		ID:  1,
 		URL: "TEST_URL",
 	}
-	actual, err := d.DownloadCandles(asset)
+	actual, err := d.DownloadCandles(context.Background(), asset)
 	assert.Nil(t, actual)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "Get HTTP Request fail")
 }
 
+func TestCryptowatDownloader_DownloadCandlesFailStatus(t *testing.T) {
+	d := &CryptowatDownloader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("<html>Bad Request</html>"))
+	}))
+	defer server.Close()
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: server.URL,
+	}
+	actual, err := d.DownloadCandles(context.Background(), asset)
+	assert.Nil(t, actual)
+	assert.IsType(t, &StatusError{}, err)
+	assert.EqualError(t, err, "HTTP response status fail: 400 Bad Request")
+}
+
+func TestCryptowatDownloader_DownloadCandlesFailAllowance(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	d := NewCryptowatDownloader(nil, logger)
+	d.SetLimiter(nil)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: server.URL,
+	}
+	_, err := d.DownloadCandles(context.Background(), asset)
+	assert.EqualError(t, err, "HTTP response status fail: 429 Too Many Requests")
+
+	// Downloader is paused until allowance reset
+	err = d.CheckWaitTimer(context.Background())
+	assert.IsType(t, &AllowanceError{}, err)
+	assert.True(t, err.(*AllowanceError).ResetAt.After(time.Now().Add(59*time.Minute)))
+	assert.Contains(t, hook.LastEntry().Message, "Pause downloader: API allowance is exhausted until")
+}
+
+func TestCryptowatDownloader_CheckWaitTimer(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	d := NewCryptowatDownloader(nil, logger)
+	d.SetLimiter(nil)
+
+	// Unknown allowance
+	assert.NoError(t, d.CheckWaitTimer(context.Background()))
+
+	// Plenty of allowance is paced by less than elapsed time
+	d.allowance.update(1000, 1000*1000*1000)
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, d.CheckWaitTimer(context.Background()))
+	assert.Equal(t, "Check allowance", hook.LastEntry().Message)
+	assert.Equal(t, float64(1000*1000*1000), hook.LastEntry().Data["allowance_remaining"])
+
+	// Shrinking allowance slows down until context is done
+	d.allowance.update(1000, 10*1000)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, d.CheckWaitTimer(ctx))
+	assert.Contains(t, hook.LastEntry().Message, "Slow down by allowance")
+
+	// Exhausted allowance doesn't wait for rate limit
+	d.allowance.update(1000, 500)
+	d.SetLimiter(limiters.NewMemory())
+	d.SetRate(limiters.Every(time.Hour))
+	assert.IsType(t, &AllowanceError{}, d.CheckWaitTimer(context.Background()))
+	assert.IsType(t, &AllowanceError{}, d.CheckWaitTimer(context.Background()))
+}
+
 func TestCryptowatDownloader_DownloadCandlesFailReadBody(t *testing.T) {
 	d := &CryptowatDownloader{}
 
@@ -86,7 +348,7 @@ func TestCryptowatDownloader_DownloadCandlesFailReadBody(t *testing.T) {
 		ID:  1,
 		URL: server.URL,
 	}
-	actual, err := d.DownloadCandles(asset)
+	actual, err := d.DownloadCandles(context.Background(), asset)
 	assert.Nil(t, actual)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "Read response body fail")
@@ -104,7 +366,7 @@ func TestCryptowatDownloader_DownloadCandlesFailParse(t *testing.T) {
 		ID:  1,
 		URL: server.URL,
 	}
-	actual, err := d.DownloadCandles(asset)
+	actual, err := d.DownloadCandles(context.Background(), asset)
 	assert.Nil(t, actual)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "Parse response fail")
@@ -115,11 +377,11 @@ func TestCryptowatResponsePeriod_UnmarshalJSON_Success(t *testing.T) {
 	err := period.UnmarshalJSON([]byte("[1481634360, 781.14, 782.14, 781.13, 781.12, 1.92525]"))
 	assert.NoError(t, err)
 	assert.Equal(t, period.CloseTime, int64(1481634360))
-	assert.Equal(t, period.OpenPrice, float32(781.14))
-	assert.Equal(t, period.HighPrice, float32(782.14))
-	assert.Equal(t, period.LowPrice, float32(781.13))
-	assert.Equal(t, period.ClosePrice, float32(781.12))
-	assert.Equal(t, period.Volume, float32(1.92525))
+	assert.Equal(t, period.OpenPrice, candles.MustParseDecimal("781.14"))
+	assert.Equal(t, period.HighPrice, candles.MustParseDecimal("782.14"))
+	assert.Equal(t, period.LowPrice, candles.MustParseDecimal("781.13"))
+	assert.Equal(t, period.ClosePrice, candles.MustParseDecimal("781.12"))
+	assert.Equal(t, period.Volume, candles.MustParseDecimal("1.92525"))
 }
 
 func TestCryptowatResponsePeriod_UnmarshalJSON_Fail(t *testing.T) {
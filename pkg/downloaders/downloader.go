@@ -1,6 +1,9 @@
 package downloaders
 
 import (
+	"context"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -8,99 +11,446 @@ import (
 
 	"github.com/dneprix/ohlc/pkg/assets"
 	"github.com/dneprix/ohlc/pkg/candles"
+	"github.com/dneprix/ohlc/pkg/credentials"
+	"github.com/dneprix/ohlc/pkg/limiters"
+	"github.com/dneprix/ohlc/pkg/metrics"
+	"github.com/dneprix/ohlc/pkg/validators"
 )
 
-// Downloader interface
-type Downloader interface {
+// downloadTimeout limits downloading candles of one asset
+const downloadTimeout = 30 * time.Second
+
+// defaultInterval between downloader runs
+const defaultInterval = time.Minute
+
+// defaultLimiter shares rate limits of downloaders in process
+var defaultLimiter = limiters.NewMemory()
+
+// Worker interface is implemented by base downloader structure
+type Worker interface {
 	Queue() chan (bool)
 	Stop() chan (bool)
 	Logger() *logrus.Entry
 	Name() string
 	DB() *sqlx.DB
-	CheckWaitTimer()
+	CheckWaitTimer(context.Context) error
+	Limiter() limiters.Limiter
+	SetLimiter(limiters.Limiter)
+	LimitKey() string
+	SetLimitKey(string)
+	Rate() limiters.Rate
+	SetRate(limiters.Rate)
+	Timeout() time.Duration
+	SetTimeout(time.Duration)
+	Interval() time.Duration
+	SetInterval(time.Duration)
+	AssetDue(*assets.Asset, time.Time) bool
+	SetAssetRun(*assets.Asset, time.Time)
+	ConflictPolicy() candles.ConflictPolicy
+	SetConflictPolicy(candles.ConflictPolicy)
+	Timeframes() []candles.Timeframe
+	SetTimeframes([]candles.Timeframe)
+	Validator() *validators.Validator
+	SetValidator(*validators.Validator)
+	Publisher() Publisher
+	SetPublisher(Publisher)
+	Heartbeat() *Heartbeat
+	Concurrency() int
+	SetConcurrency(int)
+	HTTPClient() *HTTPClient
+	SetHTTPClient(*HTTPClient)
+	AuthDefaults() credentials.Credentials
+	SetCredentials(credentials.Credentials) error
+}
+
+// Downloader interface
+type Downloader interface {
+	Worker
+
+	DownloadCandles(context.Context, *assets.Asset) ([]*candles.Candle, error)
+}
+
+// LegacyDownloader interface for downloaders without context support
+type LegacyDownloader interface {
+	Worker
 
 	DownloadCandles(*assets.Asset) ([]*candles.Candle, error)
 }
 
+// FromLegacy adapts LegacyDownloader to Downloader interface
+func FromLegacy(d LegacyDownloader) Downloader {
+	return &legacyDownloader{d}
+}
+
+type legacyDownloader struct {
+	LegacyDownloader
+}
+
+// DownloadCandles returns when legacy download is finished or context is done.
+// Legacy download can't be cancelled and keeps running in background
+func (ld *legacyDownloader) DownloadCandles(ctx context.Context, asset *assets.Asset) ([]*candles.Candle, error) {
+	type result struct {
+		candles []*candles.Candle
+		err     error
+	}
+	done := make(chan (result), 1)
+	go func() {
+		candlesData, err := ld.LegacyDownloader.DownloadCandles(asset)
+		done <- result{candlesData, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.candles, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 type downloader struct {
 	db *sqlx.DB
 
-	name      string
-	queue     chan (bool)
-	stop      chan (bool)
-	wait      time.Duration
-	waitTimer *time.Timer
-	logger    *logrus.Entry
+	name    string
+	queue   chan (bool)
+	stop    chan (bool)
+	timeout time.Duration
+	logger  *logrus.Entry
+
+	// limiter of requests shared by downloaders with the same limit key
+	limiter  limiters.Limiter
+	limitKey string
+	rate     limiters.Rate
+
+	conflictPolicy candles.ConflictPolicy
+
+	// timeframes resampled from saved candles
+	timeframes []candles.Timeframe
+
+	// validator checks downloaded candles before saving
+	validator *validators.Validator
+
+	// publisher receives changed candles after saving
+	publisher Publisher
+
+	// interval between downloader runs and last run of assets with own interval
+	interval   time.Duration
+	assetsMu   sync.Mutex
+	assetsRuns map[uint]time.Time
+
+	// concurrency of asset downloads in one pass
+	concurrency int
+
+	// heartbeat of queue goroutine
+	heartbeat Heartbeat
+
+	// httpClient requests data source with retries
+	httpClient *HTTPClient
+
+	// authDefaults of data source API, e.g. name of API key header
+	authDefaults credentials.Credentials
 }
 
 func newDownloader(db *sqlx.DB, logger *logrus.Logger, name string, wait time.Duration) *downloader {
-	return &downloader{
-		db:        db,
-		name:      name,
-		queue:     make(chan (bool), 1),
-		stop:      make(chan (bool)),
-		wait:      wait,
-		waitTimer: time.NewTimer(0),
+	httpClient := NewHTTPClient(logger)
+	httpClient.SetLogger(logger.WithFields(logrus.Fields{
+		"downloader": name,
+	}))
+	dl := &downloader{
+		db:      db,
+		name:    name,
+		queue:   make(chan (bool), 1),
+		stop:    make(chan (bool)),
+		timeout: downloadTimeout,
 		logger: logger.WithFields(logrus.Fields{
 			"downloader": name,
 		}),
+		limiter:        defaultLimiter,
+		limitKey:       name,
+		rate:           limiters.Every(wait),
+		conflictPolicy: candles.DefaultConflictPolicy,
+		validator:      validators.Default(),
+		interval:       defaultInterval,
+		assetsRuns:     map[uint]time.Time{},
+		httpClient:     httpClient,
 	}
+	dl.syncHTTPLimit()
+	return dl
 }
 
 // ProcessQueue is a goroutine for processing downloader queue
-func ProcessQueue(d Downloader) {
+func ProcessQueue(ctx context.Context, d Downloader) {
+	d.Heartbeat().setAlive(true)
+	defer d.Heartbeat().setAlive(false)
+
 	for {
 		select {
 		case <-d.Queue():
 			d.Logger().Debugf("Process queue: size=%d", len(d.Queue()))
-			ProcessDownloader(d)
+			d.Heartbeat().beginPass()
+			ProcessDownloader(ctx, d)
+			d.Heartbeat().endPass()
 		case <-d.Stop():
 			d.Logger().Warn("Stop processing queue")
 			return
-		default:
-			time.Sleep(time.Second)
+		case <-ctx.Done():
+			d.Logger().Warnf("Abort processing queue: %s", ctx.Err())
+			return
 		}
 	}
 }
 
-// ProcessDownloader steps
-func ProcessDownloader(d Downloader) {
+// ProcessDownloader steps. Due assets are processed by up to downloader concurrency
+// workers; each request still waits for the shared rate limit. Every asset is
+// processed by one worker from download to resample, and the pass returns only
+// when all workers are finished, so downloads of the same asset never overlap
+func ProcessDownloader(ctx context.Context, d Downloader) (report PassReport) {
+	passStart := time.Now()
+	defer func() {
+		report.Duration = time.Since(passStart)
+		d.Logger().WithFields(report.Fields()).Info("Downloader pass report")
+	}()
+
 	// Get assets for downloader name
-	downloaderAssets, err := assets.GetListByDownloaderName(d.DB(), d.Name())
+	downloaderAssets, err := assets.GetListByDownloaderName(ctx, d.DB(), d.Name())
 	if err != nil {
 		d.Logger().Errorf("Get DB downloader assets fail: %s", err)
+		report.Aborted = true
 		return
 	}
 
 	// Process each downloader asset
+	runTime := time.Now()
+	workers := make(chan (struct{}), d.Concurrency())
+	var reportMu sync.Mutex
+	var wg sync.WaitGroup
+	// Started assets are finished before report
+	defer wg.Wait()
 	for _, asset := range downloaderAssets {
 		assetLogger := assets.Logger(d.Logger(), asset)
 
+		// Skip asset if its own interval has not passed yet
+		if !d.AssetDue(asset, runTime) {
+			assetLogger.Debugf("Skip downloading. Asset interval has not passed: interval=%s", asset.Interval())
+			reportMu.Lock()
+			report.add(outcomeSkipped, candles.SaveResult{})
+			reportMu.Unlock()
+			continue
+		}
+
+		// Do not start next asset if downloader is stopped, even if worker is free
+		if !acquireWorker(ctx, d, workers, assetLogger) {
+			reportMu.Lock()
+			report.Aborted = true
+			reportMu.Unlock()
+			return
+		}
+
 		// Check and wait timer since last downloading
-		d.CheckWaitTimer()
-		assetLogger.Warn("Start candles downloading")
+		if err := d.CheckWaitTimer(ctx); err != nil {
+			<-workers
+			assetLogger.Warnf("Abort waiting timer: %s", err)
+			reportMu.Lock()
+			report.Aborted = true
+			reportMu.Unlock()
+			return
+		}
 
-		// Download candles
-		candlesData, err := d.DownloadCandles(asset)
-		if err != nil {
-			assetLogger.Errorf("Download candles fail: %s", err)
-			continue
+		wg.Add(1)
+		go func(asset *assets.Asset, assetLogger *logrus.Entry) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			result, outcome := processAsset(ctx, d, asset, assetLogger)
+			// Failed asset is retried by the next run regardless of its interval
+			if outcome != outcomeFailed {
+				d.SetAssetRun(asset, runTime)
+			}
+			reportMu.Lock()
+			report.add(outcome, result)
+			reportMu.Unlock()
+		}(asset, assetLogger)
+	}
+	return
+}
+
+// acquireWorker of downloader pass. Returns false if downloader is stopped or
+// context is done; stop is checked first even if a worker is free
+func acquireWorker(ctx context.Context, d Downloader, workers chan (struct{}), assetLogger *logrus.Entry) bool {
+	select {
+	case <-d.Stop():
+	case <-ctx.Done():
+	default:
+		select {
+		case workers <- struct{}{}:
+			return true
+		case <-d.Stop():
+		case <-ctx.Done():
 		}
+	}
+	if err := ctx.Err(); err != nil {
+		assetLogger.Warnf("Abort processing downloader assets: %s", err)
+	} else {
+		assetLogger.Warn("Stop processing downloader assets")
+	}
+	return false
+}
+
+// processAsset downloads, validates, saves and resamples candles of one asset
+func processAsset(ctx context.Context, d Downloader, asset *assets.Asset, assetLogger *logrus.Entry) (candles.SaveResult, assetOutcome) {
+	assetLogger.Warn("Start candles downloading")
+
+	// Download candles
+	downloadStart := time.Now()
+	downloadCtx, cancel := context.WithTimeout(ctx, d.Timeout())
+	candlesData, err := downloadNewCandles(downloadCtx, d, asset, assetLogger)
+	cancel()
+	metrics.DownloadDuration.WithLabelValues(d.Name(), asset.Name()).Observe(time.Since(downloadStart).Seconds())
+	if err != nil {
+		metrics.DownloadFailures.WithLabelValues(d.Name(), asset.Name()).Inc()
+		assetLogger.Errorf("Download candles fail: %s", err)
+		return candles.SaveResult{}, outcomeFailed
+	}
+	metrics.CandlesReceived.WithLabelValues(d.Name(), asset.Name()).Add(float64(len(candlesData)))
+
+	// Validate candles
+	if len(candlesData) == 0 {
+		assetLogger.Warn("Download ZERO candles data: Nothing to save")
+		return candles.SaveResult{}, outcomeEmpty
+	}
+	candlesData, err = validateCandles(d, asset, candlesData, assetLogger)
+	if err != nil {
+		assetLogger.Errorf("Validate candles fail: %s", err)
+		return candles.SaveResult{}, outcomeFailed
+	}
+	if len(candlesData) == 0 {
+		assetLogger.Warn("No valid candles data: Nothing to save")
+		return candles.SaveResult{}, outcomeEmpty
+	}
+
+	// Save candles
+	assetLogger.Debugf("Try to save downloaded candles: %d", len(candlesData))
+	result, err := saveCandles(ctx, d, asset, candlesData)
+	if err != nil {
+		assetLogger.Errorf("Save candles data fail: %s", err)
+		return candles.SaveResult{}, outcomeFailed
+	}
+	assetLogger.Debugf(
+		"Candles data was successfull saved: inserted=%d updated=%d unchanged=%d",
+		result.Inserted, result.Updated, result.Unchanged,
+	)
+	publishCandles(d, result.Changed)
+
+	// Resample saved candles into higher timeframes
+	if result.Inserted+result.Updated > 0 {
+		resampleCandles(ctx, d, asset.ID, candlesData, assetLogger)
+	}
+	return result, outcomeSaved
+}
+
+// validateCandles by downloader validator and logs summary of violations
+func validateCandles(d Downloader, asset *assets.Asset, candlesData []*candles.Candle, logger *logrus.Entry) ([]*candles.Candle, error) {
+	valid, report, err := d.Validator().Validate(candlesData)
+	if report.Rejected {
+		metrics.ValidationRejects.WithLabelValues(d.Name(), asset.Name()).Inc()
+	}
+	if len(report.Violations) == 0 {
+		return valid, err
+	}
+	for _, v := range report.Violations {
+		metrics.ValidationViolations.WithLabelValues(d.Name(), asset.Name(), v.Rule, v.Action.String()).Inc()
+		logger.Debugf(
+			"Candle violates rule %s: action=%s period=%d close_time=%d: %s",
+			v.Rule, v.Action, v.Period, v.CloseTime, v.Err,
+		)
+	}
+	logger.WithFields(report.Fields()).Warn("Candles validation violations")
+	return valid, err
+}
+
+// saveCandles by downloader conflict policy and counts them by outcome
+func saveCandles(ctx context.Context, d Downloader, asset *assets.Asset, candlesData []*candles.Candle) (candles.SaveResult, error) {
+	result, err := candles.Save(ctx, d.DB(), candlesData, d.ConflictPolicy())
+	if err != nil {
+		metrics.SaveFailures.WithLabelValues(d.Name(), asset.Name()).Inc()
+		return result, err
+	}
+	metrics.CandlesSaved.WithLabelValues(d.Name(), asset.Name(), "inserted").Add(float64(result.Inserted))
+	metrics.CandlesSaved.WithLabelValues(d.Name(), asset.Name(), "updated").Add(float64(result.Updated))
+	metrics.CandlesSaved.WithLabelValues(d.Name(), asset.Name(), "unchanged").Add(float64(result.Unchanged))
+	for _, c := range candlesData {
+		metrics.NewestCandles.Observe(d.Name(), asset.Name(), c.Period, c.CloseTime)
+	}
+	return result, nil
+}
+
+// resampleCandles updates downloader timeframes candles which include saved candles
+func resampleCandles(ctx context.Context, d Downloader, assetID uint, candlesData []*candles.Candle, logger *logrus.Entry) {
+	// Range of saved close times by period
+	ranges := map[uint]Range{}
+	for _, c := range candlesData {
+		r, ok := ranges[c.Period]
+		if !ok {
+			r = Range{Period: c.Period, After: c.CloseTime, Before: c.CloseTime}
+		}
+		if c.CloseTime < r.After {
+			r.After = c.CloseTime
+		}
+		if c.CloseTime > r.Before {
+			r.Before = c.CloseTime
+		}
+		ranges[c.Period] = r
+	}
 
-		// Validate candles
-		if len(candlesData) == 0 {
-			assetLogger.Warn("Download ZERO candles data: Nothing to save")
+	for _, tf := range d.Timeframes() {
+		// Resample from the highest saved period which fits timeframe
+		source := uint(0)
+		for period := range ranges {
+			if tf.Supports(period) && period > source {
+				source = period
+			}
+		}
+		if source == 0 {
 			continue
 		}
 
-		// Save candles
-		assetLogger.Debugf("Try to save downloaded candles: %d", len(candlesData))
-		if err := candles.Save(d.DB(), candlesData); err != nil {
-			assetLogger.Errorf("Save candles data fail: %s", err)
+		r := ranges[source]
+		result, err := candles.ResampleStored(ctx, d.DB(), assetID, source, tf, r.After, r.Before, d.ConflictPolicy())
+		if err != nil {
+			logger.Errorf("Resample candles to %s fail: %s", tf, err)
 			continue
 		}
-		assetLogger.Debug("Candles data was successfull saved")
+		logger.Debugf(
+			"Candles were resampled to %s: inserted=%d updated=%d unchanged=%d",
+			tf, result.Inserted, result.Updated, result.Unchanged,
+		)
+		publishCandles(d, result.Changed)
+	}
+}
+
+// publishCandles to downloader publisher if it is set
+func publishCandles(d Downloader, candlesData []*candles.Candle) {
+	if p := d.Publisher(); p != nil && len(candlesData) > 0 {
+		p.Publish(candlesData)
+	}
+}
+
+// downloadNewCandles requests only candles newer than last stored candles
+// if downloader supports ranges. Whole source window is requested otherwise
+func downloadNewCandles(ctx context.Context, d Downloader, asset *assets.Asset, logger *logrus.Entry) ([]*candles.Candle, error) {
+	rd, ok := d.(RangeDownloader)
+	if !ok {
+		return d.DownloadCandles(ctx, asset)
+	}
+
+	closeTimes, err := candles.GetLastCloseTimes(ctx, d.DB(), asset.ID)
+	if err != nil {
+		logger.Warnf("Get DB last candles fail. Download whole window: %s", err)
+		return rd.DownloadCandles(ctx, asset)
 	}
+	r := incrementalRange(closeTimes, asset)
+	logger.Debugf("Download candles after last stored: after=%d", r.After)
+	return rd.DownloadCandlesRange(ctx, asset, r)
 }
 
 // Queue downloader channel
@@ -128,8 +478,200 @@ func (dl *downloader) Stop() chan (bool) {
 	return dl.stop
 }
 
-// CheckWaitTimer downloader
-func (dl *downloader) CheckWaitTimer() {
-	<-dl.waitTimer.C
-	dl.waitTimer.Reset(dl.wait)
+// ConflictPolicy for saving already stored candles
+func (dl *downloader) ConflictPolicy() candles.ConflictPolicy {
+	return dl.conflictPolicy
+}
+
+// SetConflictPolicy for saving already stored candles
+func (dl *downloader) SetConflictPolicy(policy candles.ConflictPolicy) {
+	dl.conflictPolicy = policy
+}
+
+// Timeframes resampled from saved candles
+func (dl *downloader) Timeframes() []candles.Timeframe {
+	return dl.timeframes
+}
+
+// SetTimeframes resampled from saved candles
+func (dl *downloader) SetTimeframes(timeframes []candles.Timeframe) {
+	dl.timeframes = timeframes
+}
+
+// Validator of downloaded candles. Nil validator keeps all candles
+func (dl *downloader) Validator() *validators.Validator {
+	return dl.validator
+}
+
+// SetValidator of downloaded candles
+func (dl *downloader) SetValidator(validator *validators.Validator) {
+	dl.validator = validator
+}
+
+// Publisher of changed candles. Nil publisher is not notified
+func (dl *downloader) Publisher() Publisher {
+	return dl.publisher
+}
+
+// SetPublisher of changed candles
+func (dl *downloader) SetPublisher(publisher Publisher) {
+	dl.publisher = publisher
+}
+
+// Heartbeat of downloader queue goroutine
+func (dl *downloader) Heartbeat() *Heartbeat {
+	return &dl.heartbeat
+}
+
+// Concurrency of asset downloads in one pass. Assets are processed serially by default
+func (dl *downloader) Concurrency() int {
+	if dl == nil || dl.concurrency < 1 {
+		return 1
+	}
+	return dl.concurrency
+}
+
+// SetConcurrency of asset downloads in one pass
+func (dl *downloader) SetConcurrency(concurrency int) {
+	dl.concurrency = concurrency
+}
+
+// HTTPClient of downloader. Default client is used if it is not set
+func (dl *downloader) HTTPClient() *HTTPClient {
+	if dl == nil || dl.httpClient == nil {
+		return defaultHTTPClient
+	}
+	return dl.httpClient
+}
+
+// SetHTTPClient of downloader
+func (dl *downloader) SetHTTPClient(client *HTTPClient) {
+	dl.httpClient = client
+	dl.syncHTTPLimit()
+}
+
+// syncHTTPLimit limits retry attempts of own HTTP client by downloader rate limit
+func (dl *downloader) syncHTTPLimit() {
+	if dl.httpClient != nil {
+		dl.httpClient.SetLimit(dl.limiter, dl.limitKey, dl.rate)
+	}
+}
+
+// AuthDefaults of data source API applied to credentials without auth type and name
+func (dl *downloader) AuthDefaults() credentials.Credentials {
+	return dl.authDefaults
+}
+
+// SetCredentials of data source API. Requests of downloader HTTP client are authorized
+func (dl *downloader) SetCredentials(c credentials.Credentials) error {
+	authorizer, err := c.WithDefaults(dl.authDefaults).Authorizer()
+	if err != nil {
+		return fmt.Errorf("%s credentials fail: %s", dl.name, err)
+	}
+	if dl.httpClient == nil {
+		// Default client is shared and never authorized
+		dl.httpClient = NewHTTPClient(logrus.StandardLogger())
+		dl.syncHTTPLimit()
+	}
+	dl.httpClient.SetAuthorizer(authorizer)
+	return nil
+}
+
+// Timeout for downloading candles of one asset
+func (dl *downloader) Timeout() time.Duration {
+	return dl.timeout
+}
+
+// SetTimeout for downloading candles of one asset
+func (dl *downloader) SetTimeout(timeout time.Duration) {
+	dl.timeout = timeout
+}
+
+// Interval between downloader runs
+func (dl *downloader) Interval() time.Duration {
+	return dl.interval
+}
+
+// SetInterval between downloader runs
+func (dl *downloader) SetInterval(interval time.Duration) {
+	dl.interval = interval
+}
+
+// AssetDue checks if asset should be downloaded by run started at runTime.
+// Assets run on each downloader run by default. Asset with own interval runs
+// when at least its interval passed since last successful run with tolerance
+// of half of downloader interval, so asset interval is effectively rounded to downloader runs
+func (dl *downloader) AssetDue(asset *assets.Asset, runTime time.Time) bool {
+	interval := asset.Interval()
+	if interval == 0 {
+		return true
+	}
+
+	dl.assetsMu.Lock()
+	defer dl.assetsMu.Unlock()
+	if lastRun, ok := dl.assetsRuns[asset.ID]; ok && runTime.Sub(lastRun) < interval-dl.interval/2 {
+		return false
+	}
+	return true
+}
+
+// SetAssetRun remembers runTime as last successful asset run
+func (dl *downloader) SetAssetRun(asset *assets.Asset, runTime time.Time) {
+	if asset.Interval() == 0 {
+		return
+	}
+
+	dl.assetsMu.Lock()
+	defer dl.assetsMu.Unlock()
+	if dl.assetsRuns == nil {
+		dl.assetsRuns = map[uint]time.Time{}
+	}
+	dl.assetsRuns[asset.ID] = runTime
+}
+
+// CheckWaitTimer waits for rate limit token of downloader limit key.
+// Returns context error if context is done while waiting. Requests are not limited without limiter
+func (dl *downloader) CheckWaitTimer(ctx context.Context) error {
+	start := time.Now()
+	defer func() {
+		metrics.WaitTimerBlocked.WithLabelValues(dl.name).Add(time.Since(start).Seconds())
+	}()
+
+	if dl.limiter == nil {
+		return ctx.Err()
+	}
+	return dl.limiter.Wait(ctx, dl.limitKey, dl.rate)
+}
+
+// Limiter of downloader requests
+func (dl *downloader) Limiter() limiters.Limiter {
+	return dl.limiter
+}
+
+// SetLimiter of downloader requests
+func (dl *downloader) SetLimiter(limiter limiters.Limiter) {
+	dl.limiter = limiter
+	dl.syncHTTPLimit()
+}
+
+// LimitKey of rate limit bucket. Downloaders with the same key share requests rate
+func (dl *downloader) LimitKey() string {
+	return dl.limitKey
+}
+
+// SetLimitKey of rate limit bucket, e.g. API host
+func (dl *downloader) SetLimitKey(key string) {
+	dl.limitKey = key
+	dl.syncHTTPLimit()
+}
+
+// Rate limit of downloader requests
+func (dl *downloader) Rate() limiters.Rate {
+	return dl.rate
+}
+
+// SetRate limit of downloader requests
+func (dl *downloader) SetRate(rate limiters.Rate) {
+	dl.rate = rate
+	dl.syncHTTPLimit()
 }
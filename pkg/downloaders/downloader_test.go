@@ -1,18 +1,24 @@
 package downloaders
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/dneprix/ohlc/pkg/assets"
 	"github.com/dneprix/ohlc/pkg/candles"
+	"github.com/dneprix/ohlc/pkg/limiters"
+	"github.com/dneprix/ohlc/pkg/metrics"
+	"github.com/dneprix/ohlc/pkg/validators"
 )
 
 type mockDownloader struct {
@@ -20,7 +26,7 @@ type mockDownloader struct {
 	TestDownloadCandles func() ([]*candles.Candle, error)
 }
 
-func (m *mockDownloader) DownloadCandles(asset *assets.Asset) ([]*candles.Candle, error) {
+func (m *mockDownloader) DownloadCandles(ctx context.Context, asset *assets.Asset) ([]*candles.Candle, error) {
 	return m.TestDownloadCandles()
 }
 
@@ -39,7 +45,15 @@ func Test_newDownloader(t *testing.T) {
 	assert.Equal(t, expectedLogger, actual.logger.Logger)
 	assert.Equal(t, expectedDB, actual.db)
 	assert.Equal(t, expectedName, actual.name)
-	assert.Equal(t, expectedWaitTime, actual.wait)
+	assert.Equal(t, defaultLimiter, actual.limiter)
+	assert.Equal(t, expectedName, actual.limitKey)
+	assert.Equal(t, limiters.Every(expectedWaitTime), actual.rate)
+	assert.Equal(t, candles.DefaultConflictPolicy, actual.conflictPolicy)
+	assert.Equal(t, downloadTimeout, actual.timeout)
+	assert.Equal(t, defaultInterval, actual.interval)
+	assert.NotNil(t, actual.validator)
+	assert.NotNil(t, actual.httpClient)
+	assert.Equal(t, expectedName, actual.httpClient.logger.Data["downloader"])
 }
 
 func TestProcessQueue(t *testing.T) {
@@ -52,12 +66,10 @@ func TestProcessQueue(t *testing.T) {
 
 	d := &mockDownloader{
 		downloader: &downloader{
-			db:        db,
-			name:      name,
-			queue:     make(chan (bool), 1),
-			stop:      make(chan (bool)),
-			wait:      time.Millisecond,
-			waitTimer: time.NewTimer(0),
+			db:    db,
+			name:  name,
+			queue: make(chan (bool), 1),
+			stop:  make(chan (bool)),
 			logger: logger.WithFields(logrus.Fields{
 				"downloader": name,
 			}),
@@ -69,7 +81,7 @@ func TestProcessQueue(t *testing.T) {
 		close(d.Stop())
 	}()
 	d.Queue() <- true
-	ProcessQueue(d)
+	ProcessQueue(context.Background(), d)
 }
 
 func TestProcessDownloaderSuccess(t *testing.T) {
@@ -82,12 +94,10 @@ func TestProcessDownloaderSuccess(t *testing.T) {
 
 	d := &mockDownloader{
 		downloader: &downloader{
-			db:        db,
-			name:      name,
-			queue:     make(chan (bool), 1),
-			stop:      make(chan (bool)),
-			wait:      time.Millisecond,
-			waitTimer: time.NewTimer(0),
+			db:    db,
+			name:  name,
+			queue: make(chan (bool), 1),
+			stop:  make(chan (bool)),
 			logger: logger.WithFields(logrus.Fields{
 				"downloader": name,
 			}),
@@ -98,11 +108,11 @@ func TestProcessDownloaderSuccess(t *testing.T) {
 					AssetID:    1,
 					Period:     60,
 					CloseTime:  1569563400,
-					OpenPrice:  7937.2001953125,
-					HighPrice:  7937.2001953125,
-					LowPrice:   7937.60009765625,
-					ClosePrice: 7937.60009765625,
-					Volume:     0.008394920267164707,
+					OpenPrice:  candles.MustParseDecimal("7937.2"),
+					HighPrice:  candles.MustParseDecimal("7937.2"),
+					LowPrice:   candles.MustParseDecimal("7937.6"),
+					ClosePrice: candles.MustParseDecimal("7937.6"),
+					Volume:     candles.MustParseDecimal("0.00839492"),
 				},
 			}, nil
 		},
@@ -131,10 +141,20 @@ func TestProcessDownloaderSuccess(t *testing.T) {
 			))
 	mock.ExpectBegin()
 	mock.ExpectPrepare("INSERT INTO candles")
-	mock.ExpectExec("INSERT INTO candles").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("INSERT INTO candles").WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
 	mock.ExpectCommit()
 
-	ProcessDownloader(d)
+	received := metrics.CandlesReceived.WithLabelValues(name, asset.Name())
+	inserted := metrics.CandlesSaved.WithLabelValues(name, asset.Name(), "inserted")
+	receivedBefore, insertedBefore := testutil.ToFloat64(received), testutil.ToFloat64(inserted)
+
+	report := ProcessDownloader(context.Background(), d)
+
+	assert.Equal(t, receivedBefore+1, testutil.ToFloat64(received))
+	assert.Equal(t, insertedBefore+1, testutil.ToFloat64(inserted))
+	assert.Equal(t, 1, report.Saved)
+	assert.Equal(t, 1, report.Inserted)
+	assert.False(t, report.Aborted)
 }
 
 func TestProcessDownloaderFailDownloadCandles(t *testing.T) {
@@ -147,12 +167,10 @@ func TestProcessDownloaderFailDownloadCandles(t *testing.T) {
 
 	d := &mockDownloader{
 		downloader: &downloader{
-			db:        db,
-			name:      name,
-			queue:     make(chan (bool), 1),
-			stop:      make(chan (bool)),
-			wait:      time.Millisecond,
-			waitTimer: time.NewTimer(0),
+			db:    db,
+			name:  name,
+			queue: make(chan (bool), 1),
+			stop:  make(chan (bool)),
 			logger: logger.WithFields(logrus.Fields{
 				"downloader": name,
 			}),
@@ -184,7 +202,7 @@ func TestProcessDownloaderFailDownloadCandles(t *testing.T) {
 				asset.URL,
 			))
 
-	ProcessDownloader(d)
+	ProcessDownloader(context.Background(), d)
 }
 
 func TestProcessDownloaderFailNoCandles(t *testing.T) {
@@ -197,12 +215,10 @@ func TestProcessDownloaderFailNoCandles(t *testing.T) {
 
 	d := &mockDownloader{
 		downloader: &downloader{
-			db:        db,
-			name:      name,
-			queue:     make(chan (bool), 1),
-			stop:      make(chan (bool)),
-			wait:      time.Millisecond,
-			waitTimer: time.NewTimer(0),
+			db:    db,
+			name:  name,
+			queue: make(chan (bool), 1),
+			stop:  make(chan (bool)),
 			logger: logger.WithFields(logrus.Fields{
 				"downloader": name,
 			}),
@@ -234,7 +250,7 @@ func TestProcessDownloaderFailNoCandles(t *testing.T) {
 				asset.URL,
 			))
 
-	ProcessDownloader(d)
+	ProcessDownloader(context.Background(), d)
 }
 
 func TestProcessDownloaderFailSaveCandles(t *testing.T) {
@@ -247,12 +263,10 @@ func TestProcessDownloaderFailSaveCandles(t *testing.T) {
 
 	d := &mockDownloader{
 		downloader: &downloader{
-			db:        db,
-			name:      name,
-			queue:     make(chan (bool), 1),
-			stop:      make(chan (bool)),
-			wait:      time.Millisecond,
-			waitTimer: time.NewTimer(0),
+			db:    db,
+			name:  name,
+			queue: make(chan (bool), 1),
+			stop:  make(chan (bool)),
 			logger: logger.WithFields(logrus.Fields{
 				"downloader": name,
 			}),
@@ -263,11 +277,11 @@ func TestProcessDownloaderFailSaveCandles(t *testing.T) {
 					AssetID:    1,
 					Period:     60,
 					CloseTime:  1569563400,
-					OpenPrice:  7937.2001953125,
-					HighPrice:  7937.2001953125,
-					LowPrice:   7937.60009765625,
-					ClosePrice: 7937.60009765625,
-					Volume:     0.008394920267164707,
+					OpenPrice:  candles.MustParseDecimal("7937.2"),
+					HighPrice:  candles.MustParseDecimal("7937.2"),
+					LowPrice:   candles.MustParseDecimal("7937.6"),
+					ClosePrice: candles.MustParseDecimal("7937.6"),
+					Volume:     candles.MustParseDecimal("0.00839492"),
 				},
 			}, nil
 		},
@@ -297,9 +311,197 @@ func TestProcessDownloaderFailSaveCandles(t *testing.T) {
 	expectedError := fmt.Errorf("DB error")
 	mock.ExpectBegin()
 	mock.ExpectPrepare("INSERT INTO candles")
-	mock.ExpectExec("INSERT INTO candles").WillReturnError(expectedError)
+	mock.ExpectQuery("INSERT INTO candles").WillReturnError(expectedError)
+	mock.ExpectRollback()
+
+	failures := metrics.SaveFailures.WithLabelValues(name, asset.Name())
+	failuresBefore := testutil.ToFloat64(failures)
+
+	ProcessDownloader(context.Background(), d)
+
+	assert.Equal(t, failuresBefore+1, testutil.ToFloat64(failures))
+}
+
+func TestProcessDownloaderStop(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+
+	db := sqlx.NewDb(mockDB, "sqlmock")
+	name := "TEST_DOWNLOADER"
+	logger, _ := test.NewNullLogger()
+
+	d := &mockDownloader{
+		downloader: &downloader{
+			db:    db,
+			name:  name,
+			queue: make(chan (bool), 1),
+			stop:  make(chan (bool)),
+			logger: logger.WithFields(logrus.Fields{
+				"downloader": name,
+			}),
+		},
+		TestDownloadCandles: func() ([]*candles.Candle, error) {
+			t.Error("Candles must not be downloaded by stopped downloader")
+			return nil, nil
+		},
+	}
+
+	mock.ExpectQuery(
+		"SELECT \\* FROM assets WHERE downloader=\\$1",
+	).WithArgs(name).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "coin_from", "coin_to", "exchange", "downloader", "url"}).
+			AddRow(1, "TEST_COIN_FROM", "TEST_COIN_TO", "TEST_EXCHANGE", name, "TEST_URL"))
+
+	close(d.Stop())
+	ProcessDownloader(context.Background(), d)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestProcessQueueContextDone(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	d := &mockDownloader{
+		downloader: &downloader{
+			queue:  make(chan (bool), 1),
+			stop:   make(chan (bool)),
+			logger: logrus.NewEntry(logger),
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ProcessQueue(ctx, d)
+}
+
+func TestProcessDownloaderContextDone(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+
+	db := sqlx.NewDb(mockDB, "sqlmock")
+	name := "TEST_DOWNLOADER"
+	logger, _ := test.NewNullLogger()
+
+	d := &mockDownloader{
+		downloader: &downloader{
+			db:      db,
+			name:    name,
+			queue:   make(chan (bool), 1),
+			stop:    make(chan (bool)),
+			timeout: time.Second,
+			logger: logger.WithFields(logrus.Fields{
+				"downloader": name,
+			}),
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.TestDownloadCandles = func() ([]*candles.Candle, error) {
+		// Cancel after first download so second asset is waiting timer
+		cancel()
+		return nil, context.Canceled
+	}
+
+	mock.ExpectQuery(
+		"SELECT \\* FROM assets WHERE downloader=\\$1",
+	).WithArgs(name).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "coin_from", "coin_to", "exchange", "downloader", "url"}).
+			AddRow(1, "BTC", "USD", "KRAKEN", name, "TEST_URL").
+			AddRow(2, "ETH", "USD", "KRAKEN", name, "TEST_URL"))
 
-	ProcessDownloader(d)
+	ProcessDownloader(ctx, d)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestProcessDownloaderTimeout(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+
+	db := sqlx.NewDb(mockDB, "sqlmock")
+	name := "TEST_DOWNLOADER"
+	logger, hook := test.NewNullLogger()
+
+	d := &timeoutDownloader{
+		downloader: &downloader{
+			db:      db,
+			name:    name,
+			queue:   make(chan (bool), 1),
+			stop:    make(chan (bool)),
+			timeout: time.Millisecond,
+			logger: logger.WithFields(logrus.Fields{
+				"downloader": name,
+			}),
+		},
+	}
+
+	mock.ExpectQuery(
+		"SELECT \\* FROM assets WHERE downloader=\\$1",
+	).WithArgs(name).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "coin_from", "coin_to", "exchange", "downloader", "url"}).
+			AddRow(1, "BTC", "USD", "KRAKEN", name, "TEST_URL"))
+
+	report := ProcessDownloader(context.Background(), d)
+
+	entries := hook.AllEntries()
+	assert.Equal(t, "Download candles fail: context deadline exceeded", entries[len(entries)-2].Message)
+	assert.Equal(t, 1, report.Failed)
+}
+
+type timeoutDownloader struct {
+	*downloader
+}
+
+func (td *timeoutDownloader) DownloadCandles(ctx context.Context, asset *assets.Asset) ([]*candles.Candle, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+type mockLegacyDownloader struct {
+	*downloader
+	TestDownloadCandles func() ([]*candles.Candle, error)
+}
+
+func (m *mockLegacyDownloader) DownloadCandles(asset *assets.Asset) ([]*candles.Candle, error) {
+	return m.TestDownloadCandles()
+}
+
+func TestFromLegacy(t *testing.T) {
+	expected := []*candles.Candle{{AssetID: 1}}
+	legacy := &mockLegacyDownloader{
+		downloader: &downloader{name: "LEGACY"},
+		TestDownloadCandles: func() ([]*candles.Candle, error) {
+			return expected, nil
+		},
+	}
+
+	d := FromLegacy(legacy)
+	assert.Equal(t, "LEGACY", d.Name())
+
+	actual, err := d.DownloadCandles(context.Background(), &assets.Asset{})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, actual)
+}
+
+func TestFromLegacyContextDone(t *testing.T) {
+	release := make(chan (bool))
+	defer close(release)
+	legacy := &mockLegacyDownloader{
+		downloader: &downloader{},
+		TestDownloadCandles: func() ([]*candles.Candle, error) {
+			<-release
+			return nil, nil
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	actual, err := FromLegacy(legacy).DownloadCandles(ctx, &assets.Asset{})
+	assert.Nil(t, actual)
+	assert.Equal(t, context.DeadlineExceeded, err)
 }
 
 func Test_downloader_Queue(t *testing.T) {
@@ -351,29 +553,613 @@ func Test_downloader_Stop(t *testing.T) {
 	assert.Equal(t, expected, actual)
 }
 
+func Test_downloader_ConflictPolicy(t *testing.T) {
+	dl := &downloader{}
+	dl.SetConflictPolicy(candles.ConflictOverwrite)
+	assert.Equal(t, candles.ConflictOverwrite, dl.ConflictPolicy())
+	dl.SetConflictPolicy(candles.ConflictIgnore)
+	assert.Equal(t, candles.ConflictIgnore, dl.ConflictPolicy())
+}
+
+func Test_downloader_Timeframes(t *testing.T) {
+	dl := &downloader{}
+	assert.Empty(t, dl.Timeframes())
+	dl.SetTimeframes([]candles.Timeframe{{Period: 300}})
+	assert.Equal(t, []candles.Timeframe{{Period: 300}}, dl.Timeframes())
+}
+
+func Test_downloader_Validator(t *testing.T) {
+	dl := &downloader{}
+	assert.Nil(t, dl.Validator())
+	validator := validators.New()
+	dl.SetValidator(validator)
+	assert.Equal(t, validator, dl.Validator())
+}
+
+type mockPublisher struct {
+	published [][]*candles.Candle
+}
+
+func (mp *mockPublisher) Publish(candlesData []*candles.Candle) {
+	mp.published = append(mp.published, candlesData)
+}
+
+func Test_downloader_Publisher(t *testing.T) {
+	dl := &downloader{}
+	assert.Nil(t, dl.Publisher())
+	publisher := &mockPublisher{}
+	dl.SetPublisher(publisher)
+	assert.Equal(t, publisher, dl.Publisher())
+}
+
+func Test_downloader_Timeout(t *testing.T) {
+	dl := &downloader{}
+	dl.SetTimeout(time.Second)
+	assert.Equal(t, time.Second, dl.Timeout())
+}
+
+func Test_downloader_Interval(t *testing.T) {
+	dl := &downloader{}
+	dl.SetInterval(time.Hour)
+	assert.Equal(t, time.Hour, dl.Interval())
+}
+
+func Test_downloader_AssetDue(t *testing.T) {
+	dl := &downloader{interval: time.Minute}
+	runTime := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	// Asset without own interval runs each time
+	asset := &assets.Asset{ID: 1}
+	assert.True(t, dl.AssetDue(asset, runTime))
+	assert.True(t, dl.AssetDue(asset, runTime))
+
+	// Asset with own interval
+	asset = &assets.Asset{ID: 2, ScheduleInterval: 300}
+	assert.True(t, dl.AssetDue(asset, runTime))
+	// Asset is due until its run is recorded
+	assert.True(t, dl.AssetDue(asset, runTime))
+	dl.SetAssetRun(asset, runTime)
+	assert.False(t, dl.AssetDue(asset, runTime.Add(time.Minute)))
+	assert.False(t, dl.AssetDue(asset, runTime.Add(4*time.Minute)))
+	// Late run of previous pass is tolerated
+	assert.True(t, dl.AssetDue(asset, runTime.Add(4*time.Minute+40*time.Second)))
+	dl.SetAssetRun(asset, runTime.Add(4*time.Minute+40*time.Second))
+	assert.False(t, dl.AssetDue(asset, runTime.Add(5*time.Minute)))
+	assert.True(t, dl.AssetDue(asset, runTime.Add(10*time.Minute)))
+}
+
+func TestProcessDownloaderAssetRunFailed(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+
+	db := sqlx.NewDb(mockDB, "sqlmock")
+	name := "TEST_DOWNLOADER"
+	logger, _ := test.NewNullLogger()
+
+	d := &mockDownloader{
+		downloader: &downloader{
+			db:       db,
+			name:     name,
+			queue:    make(chan (bool), 1),
+			stop:     make(chan (bool)),
+			interval: time.Minute,
+			logger: logger.WithFields(logrus.Fields{
+				"downloader": name,
+			}),
+		},
+		TestDownloadCandles: func() ([]*candles.Candle, error) {
+			return nil, fmt.Errorf("API error")
+		},
+	}
+	asset := &assets.Asset{ID: 1, ScheduleInterval: 86400}
+	assetRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "coin_from", "coin_to", "exchange", "downloader", "url", "schedule_interval"}).
+			AddRow(1, "BTC", "USD", "KRAKEN", name, "TEST_URL", 86400)
+	}
+
+	// Failed asset is due by the next run
+	mock.ExpectQuery("SELECT \\* FROM assets WHERE downloader=\\$1").WithArgs(name).WillReturnRows(assetRows())
+	report := ProcessDownloader(context.Background(), d)
+	assert.Equal(t, 1, report.Failed)
+	assert.True(t, d.AssetDue(asset, time.Now()))
+
+	// Successful run is recorded
+	d.TestDownloadCandles = func() ([]*candles.Candle, error) {
+		return []*candles.Candle{}, nil
+	}
+	mock.ExpectQuery("SELECT \\* FROM assets WHERE downloader=\\$1").WithArgs(name).WillReturnRows(assetRows())
+	report = ProcessDownloader(context.Background(), d)
+	assert.Equal(t, 1, report.Empty)
+	assert.False(t, d.AssetDue(asset, time.Now()))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestProcessDownloaderAssetRunAborted(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+
+	db := sqlx.NewDb(mockDB, "sqlmock")
+	name := "TEST_DOWNLOADER"
+	logger, _ := test.NewNullLogger()
+
+	d := &mockDownloader{
+		downloader: &downloader{
+			db:       db,
+			name:     name,
+			queue:    make(chan (bool), 1),
+			stop:     make(chan (bool)),
+			interval: time.Minute,
+			limiter:  limiters.NewMemory(),
+			rate:     limiters.Every(time.Hour),
+			logger: logger.WithFields(logrus.Fields{
+				"downloader": name,
+			}),
+		},
+		TestDownloadCandles: func() ([]*candles.Candle, error) {
+			t.Error("Candles must not be downloaded by aborted pass")
+			return nil, nil
+		},
+	}
+	asset := &assets.Asset{ID: 1, ScheduleInterval: 86400}
+	assetRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "coin_from", "coin_to", "exchange", "downloader", "url", "schedule_interval"}).
+			AddRow(1, "BTC", "USD", "KRAKEN", name, "TEST_URL", 86400)
+	}
+
+	// Pass aborted while waiting timer doesn't record asset run
+	assert.NoError(t, d.CheckWaitTimer(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	mock.ExpectQuery("SELECT \\* FROM assets WHERE downloader=\\$1").WithArgs(name).WillReturnRows(assetRows())
+	report := ProcessDownloader(ctx, d)
+	assert.True(t, report.Aborted)
+	assert.True(t, d.AssetDue(asset, time.Now()))
+
+	// Stopped pass doesn't record asset run
+	close(d.stop)
+	mock.ExpectQuery("SELECT \\* FROM assets WHERE downloader=\\$1").WithArgs(name).WillReturnRows(assetRows())
+	report = ProcessDownloader(context.Background(), d)
+	assert.True(t, report.Aborted)
+	assert.True(t, d.AssetDue(asset, time.Now()))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestProcessDownloaderAssetNotDue(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+
+	db := sqlx.NewDb(mockDB, "sqlmock")
+	name := "TEST_DOWNLOADER"
+	logger, _ := test.NewNullLogger()
+
+	d := &mockDownloader{
+		downloader: &downloader{
+			db:       db,
+			name:     name,
+			queue:    make(chan (bool), 1),
+			stop:     make(chan (bool)),
+			interval: time.Minute,
+			assetsRuns: map[uint]time.Time{
+				1: time.Now(),
+			},
+			logger: logger.WithFields(logrus.Fields{
+				"downloader": name,
+			}),
+		},
+		TestDownloadCandles: func() ([]*candles.Candle, error) {
+			t.Error("Candles must not be downloaded before asset interval")
+			return nil, nil
+		},
+	}
+
+	mock.ExpectQuery(
+		"SELECT \\* FROM assets WHERE downloader=\\$1",
+	).WithArgs(name).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "coin_from", "coin_to", "exchange", "downloader", "url", "schedule_interval"}).
+			AddRow(1, "BTC", "USD", "KRAKEN", name, "TEST_URL", 86400))
+
+	ProcessDownloader(context.Background(), d)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_downloader_CheckWaitTimerContextDone(t *testing.T) {
+	dl := &downloader{
+		limiter: limiters.NewMemory(),
+		rate:    limiters.Every(time.Hour),
+	}
+	assert.NoError(t, dl.CheckWaitTimer(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-time.After(time.Millisecond)
+		cancel()
+	}()
+	assert.Equal(t, context.Canceled, dl.CheckWaitTimer(ctx))
+
+	// Without limiter only context is checked
+	dl = &downloader{}
+	assert.Equal(t, context.Canceled, dl.CheckWaitTimer(ctx))
+	assert.NoError(t, dl.CheckWaitTimer(context.Background()))
+}
+
 func Test_downloader_CheckWaitTimer(t *testing.T) {
-	expected := time.Duration(time.Millisecond)
+	expected := 10 * time.Millisecond
 	dl := &downloader{
-		wait:      expected,
-		waitTimer: time.NewTimer(0),
+		limiter:  limiters.NewMemory(),
+		limitKey: "TEST_HOST",
+		rate:     limiters.Every(expected),
 	}
 
 	// Check zero wait time
 	startTime := time.Now()
-	dl.CheckWaitTimer()
-	endTime := time.Now()
-	assert.Equal(t, time.Duration(0), endTime.Sub(startTime).Truncate(time.Millisecond))
+	assert.NoError(t, dl.CheckWaitTimer(context.Background()))
+	assert.True(t, time.Since(startTime) < expected)
 
 	// Check wait time
 	startTime = time.Now()
-	dl.CheckWaitTimer()
-	endTime = time.Now()
-	assert.Equal(t, expected, endTime.Sub(startTime).Truncate(time.Millisecond))
+	assert.NoError(t, dl.CheckWaitTimer(context.Background()))
+	elapsed := time.Since(startTime)
+	assert.True(t, elapsed >= expected-time.Millisecond && elapsed < 2*expected, "elapsed %s", elapsed)
 
 	// Check wait time + expected process
 	startTime = time.Now()
 	time.Sleep(expected)
-	dl.CheckWaitTimer()
-	endTime = time.Now()
-	assert.Equal(t, expected, endTime.Sub(startTime).Truncate(time.Millisecond))
+	assert.NoError(t, dl.CheckWaitTimer(context.Background()))
+	elapsed = time.Since(startTime)
+	assert.True(t, elapsed >= expected && elapsed < 2*expected, "elapsed %s", elapsed)
+
+	// Downloader with the same limit key shares rate
+	other := &downloader{
+		limiter:  dl.limiter,
+		limitKey: "TEST_HOST",
+		rate:     limiters.Every(expected),
+	}
+	startTime = time.Now()
+	assert.NoError(t, other.CheckWaitTimer(context.Background()))
+	elapsed = time.Since(startTime)
+	assert.True(t, elapsed >= expected-time.Millisecond, "elapsed %s", elapsed)
+}
+
+func Test_downloader_Limiter(t *testing.T) {
+	dl := &downloader{}
+	assert.Nil(t, dl.Limiter())
+	limiter := limiters.NewMemory()
+	dl.SetLimiter(limiter)
+	assert.Equal(t, limiter, dl.Limiter())
+
+	dl.SetLimitKey("TEST_HOST")
+	assert.Equal(t, "TEST_HOST", dl.LimitKey())
+
+	dl.SetRate(limiters.Rate{Every: time.Second, Burst: 5})
+	assert.Equal(t, limiters.Rate{Every: time.Second, Burst: 5}, dl.Rate())
+}
+
+func TestProcessDownloaderIncremental(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	db := sqlx.NewDb(mockDB, "sqlmock")
+
+	d := newMockRangeDownloader(db, func(r Range) ([]*candles.Candle, error) {
+		return []*candles.Candle{}, nil
+	})
+
+	mock.ExpectQuery(
+		"SELECT \\* FROM assets WHERE downloader=\\$1",
+	).WithArgs(d.Name()).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "coin_from", "coin_to", "exchange", "downloader", "url"}).
+			AddRow(1, "BTC", "USD", "KRAKEN", d.Name(), "TEST_URL"))
+	mock.ExpectQuery("SELECT period, extract").WithArgs(1).WillReturnRows(
+		sqlmock.NewRows([]string{"period", "close_time"}).AddRow(60, 1569563400))
+
+	ProcessDownloader(context.Background(), d)
+
+	assert.Equal(t, []Range{{After: 1569563400}}, d.ranges)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestProcessDownloaderIncrementalFailLastCloseTimes(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	db := sqlx.NewDb(mockDB, "sqlmock")
+
+	d := newMockRangeDownloader(db, func(r Range) ([]*candles.Candle, error) {
+		return []*candles.Candle{}, nil
+	})
+
+	mock.ExpectQuery(
+		"SELECT \\* FROM assets WHERE downloader=\\$1",
+	).WithArgs(d.Name()).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "coin_from", "coin_to", "exchange", "downloader", "url"}).
+			AddRow(1, "BTC", "USD", "KRAKEN", d.Name(), "TEST_URL"))
+	mock.ExpectQuery("SELECT period, extract").WithArgs(1).WillReturnError(fmt.Errorf("DB error"))
+
+	ProcessDownloader(context.Background(), d)
+
+	// Whole window is requested
+	assert.Equal(t, []Range{{}}, d.ranges)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestProcessDownloaderResample(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	db := sqlx.NewDb(mockDB, "sqlmock")
+	logger, _ := test.NewNullLogger()
+
+	d := &mockDownloader{
+		downloader: &downloader{
+			db:      db,
+			name:    "TEST_DOWNLOADER",
+			timeout: time.Second,
+			logger:  logrus.NewEntry(logger),
+			// 120s is not supported by 3600s candles
+			timeframes: []candles.Timeframe{{Period: 120}, {Period: 7200}},
+		},
+		TestDownloadCandles: func() ([]*candles.Candle, error) {
+			return []*candles.Candle{
+				{AssetID: 1, Period: 60, CloseTime: 1569564000},
+				{AssetID: 1, Period: 3600, CloseTime: 1569560400},
+				{AssetID: 1, Period: 3600, CloseTime: 1569564000},
+			}, nil
+		},
+	}
+
+	mock.ExpectQuery(
+		"SELECT \\* FROM assets WHERE downloader=\\$1",
+	).WithArgs(d.Name()).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "coin_from", "coin_to", "exchange", "downloader", "url"}).
+			AddRow(1, "BTC", "USD", "KRAKEN", d.Name(), "TEST_URL"))
+	mock.ExpectBegin()
+	mock.ExpectPrepare("INSERT INTO candles")
+	for i := 0; i < 3; i++ {
+		mock.ExpectQuery("INSERT INTO candles").WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+	}
+	mock.ExpectCommit()
+	// 120s timeframe from 60s candles
+	mock.ExpectQuery("SELECT .+ FROM candles").
+		WithArgs(1, 60, 1569563880, 1569564000).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	// 7200s timeframe from 3600s candles
+	mock.ExpectQuery("SELECT .+ FROM candles").
+		WithArgs(1, 3600, 1569556800, 1569564000).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	ProcessDownloader(context.Background(), d)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestProcessDownloaderValidation(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		candle   *candles.Candle
+		expected string
+	}{
+		{
+			name:     "drop",
+			candle:   &candles.Candle{AssetID: 1, Period: 60, CloseTime: 1569563400},
+			expected: "No valid candles data: Nothing to save",
+		},
+		{
+			name:     "reject",
+			candle:   &candles.Candle{AssetID: 1, Period: 60, CloseTime: 1569563401},
+			expected: "Validate candles fail: Candles batch is rejected by rule aligned-close-time: close_time=1569563401 period=60: close time 1569563401 is not aligned to period 60",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, _ := sqlmock.New()
+			defer mockDB.Close()
+			db := sqlx.NewDb(mockDB, "sqlmock")
+			logger, hook := test.NewNullLogger()
+
+			d := &mockDownloader{
+				downloader: &downloader{
+					db:      db,
+					name:    "TEST_DOWNLOADER",
+					timeout: time.Second,
+					logger:  logrus.NewEntry(logger),
+					validator: validators.New().
+						Add(validators.PositivePrices, validators.ActionDrop).
+						Add(validators.AlignedCloseTime, validators.ActionReject),
+				},
+				TestDownloadCandles: func() ([]*candles.Candle, error) {
+					return []*candles.Candle{tt.candle}, nil
+				},
+			}
+
+			mock.ExpectQuery(
+				"SELECT \\* FROM assets WHERE downloader=\\$1",
+			).WithArgs(d.Name()).WillReturnRows(
+				sqlmock.NewRows([]string{"id", "coin_from", "coin_to", "exchange", "downloader", "url"}).
+					AddRow(1, "BTC", "USD", "KRAKEN", d.Name(), "TEST_URL"))
+
+			ProcessDownloader(context.Background(), d)
+
+			entries := hook.AllEntries()
+			assert.Equal(t, tt.expected, entries[len(entries)-2].Message)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestProcessDownloaderPublish(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	db := sqlx.NewDb(mockDB, "sqlmock")
+	logger, _ := test.NewNullLogger()
+	publisher := &mockPublisher{}
+
+	candlesData := []*candles.Candle{
+		{AssetID: 1, Period: 60, CloseTime: 1569563400},
+		{AssetID: 1, Period: 60, CloseTime: 1569563460},
+		{AssetID: 1, Period: 60, CloseTime: 1569563520},
+	}
+	d := &mockDownloader{
+		downloader: &downloader{
+			db:        db,
+			name:      "TEST_DOWNLOADER",
+			timeout:   time.Second,
+			logger:    logrus.NewEntry(logger),
+			publisher: publisher,
+		},
+		TestDownloadCandles: func() ([]*candles.Candle, error) {
+			return candlesData, nil
+		},
+	}
+
+	mock.ExpectQuery(
+		"SELECT \\* FROM assets WHERE downloader=\\$1",
+	).WithArgs(d.Name()).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "coin_from", "coin_to", "exchange", "downloader", "url"}).
+			AddRow(1, "BTC", "USD", "KRAKEN", d.Name(), "TEST_URL"))
+	mock.ExpectBegin()
+	mock.ExpectPrepare("INSERT INTO candles")
+	mock.ExpectQuery("INSERT INTO candles").WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+	mock.ExpectQuery("INSERT INTO candles").WillReturnRows(sqlmock.NewRows([]string{"inserted"}))
+	mock.ExpectQuery("INSERT INTO candles").WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(false))
+	mock.ExpectCommit()
+
+	ProcessDownloader(context.Background(), d)
+
+	// Unchanged candle is not published
+	assert.Equal(t, [][]*candles.Candle{{candlesData[0], candlesData[2]}}, publisher.published)
+}
+
+type concurrentDownloader struct {
+	*downloader
+
+	mu        sync.Mutex
+	running   int
+	maxActive int
+	assets    map[uint]int
+}
+
+func (cd *concurrentDownloader) DownloadCandles(ctx context.Context, asset *assets.Asset) ([]*candles.Candle, error) {
+	cd.mu.Lock()
+	cd.running++
+	if cd.running > cd.maxActive {
+		cd.maxActive = cd.running
+	}
+	cd.assets[asset.ID]++
+	cd.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	cd.mu.Lock()
+	cd.running--
+	cd.mu.Unlock()
+	if asset.ID%2 == 0 {
+		return nil, fmt.Errorf("TEST_ERROR")
+	}
+	return nil, nil
+}
+
+func TestProcessDownloaderConcurrency(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		concurrency int
+		expected    int
+	}{
+		{"serial", 0, 1},
+		{"pool", 3, 3},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, _ := sqlmock.New()
+			defer mockDB.Close()
+			logger, hook := test.NewNullLogger()
+
+			d := &concurrentDownloader{
+				downloader: &downloader{
+					db:          sqlx.NewDb(mockDB, "sqlmock"),
+					name:        "TEST_DOWNLOADER",
+					stop:        make(chan (bool)),
+					timeout:     time.Second,
+					logger:      logrus.NewEntry(logger),
+					limiter:     limiters.NewMemory(),
+					rate:        limiters.Rate{Every: time.Millisecond, Burst: 1},
+					concurrency: tt.concurrency,
+				},
+				assets: map[uint]int{},
+			}
+			rows := sqlmock.NewRows([]string{"id", "coin_from", "coin_to", "exchange", "downloader", "url"})
+			for id := 1; id <= 6; id++ {
+				rows.AddRow(id, "BTC", "USD", "KRAKEN", d.Name(), "TEST_URL")
+			}
+			mock.ExpectQuery("SELECT \\* FROM assets WHERE downloader=\\$1").WithArgs(d.Name()).WillReturnRows(rows)
+
+			report := ProcessDownloader(context.Background(), d)
+
+			// Every asset is downloaded once by bounded workers
+			assert.Equal(t, tt.expected, d.maxActive)
+			assert.Equal(t, map[uint]int{1: 1, 2: 1, 3: 1, 4: 1, 5: 1, 6: 1}, d.assets)
+			assert.Equal(t, 6, report.Processed)
+			assert.Equal(t, 3, report.Failed)
+			assert.Equal(t, 3, report.Empty)
+
+			// Report is logged after all assets
+			assert.Equal(t, "Downloader pass report", hook.LastEntry().Message)
+			assert.Equal(t, 3, hook.LastEntry().Data["pass_failed"])
+		})
+	}
+}
+
+func TestProcessDownloaderConcurrencyStop(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	logger, _ := test.NewNullLogger()
+
+	d := &concurrentDownloader{
+		downloader: &downloader{
+			db:          sqlx.NewDb(mockDB, "sqlmock"),
+			name:        "TEST_DOWNLOADER",
+			stop:        make(chan (bool)),
+			timeout:     time.Second,
+			logger:      logrus.NewEntry(logger),
+			concurrency: 2,
+		},
+		assets: map[uint]int{},
+	}
+	rows := sqlmock.NewRows([]string{"id", "coin_from", "coin_to", "exchange", "downloader", "url"})
+	for id := 1; id <= 4; id++ {
+		rows.AddRow(id, "BTC", "USD", "KRAKEN", d.Name(), "TEST_URL")
+	}
+	mock.ExpectQuery("SELECT \\* FROM assets WHERE downloader=\\$1").WithArgs(d.Name()).WillReturnRows(rows)
+
+	// Downloader is stopped while the first workers are busy
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		close(d.Stop())
+	}()
+	report := ProcessDownloader(context.Background(), d)
+
+	// Started assets are finished before report
+	assert.True(t, report.Aborted)
+	assert.Equal(t, 2, report.Processed)
+	assert.Equal(t, 0, d.running)
+	assert.Len(t, d.assets, 2)
+}
+
+func Test_downloader_Concurrency(t *testing.T) {
+	dl := &downloader{}
+	assert.Equal(t, 1, dl.Concurrency())
+	dl.SetConcurrency(4)
+	assert.Equal(t, 4, dl.Concurrency())
+	assert.Equal(t, 1, (&KrakenDownloader{}).Concurrency())
 }
@@ -0,0 +1,56 @@
+package downloaders
+
+import (
+	"sync"
+	"time"
+)
+
+// Heartbeat of downloader queue goroutine. Zero value is ready to use
+type Heartbeat struct {
+	mu          sync.RWMutex
+	alive       bool
+	passStarted time.Time
+	lastPass    time.Time
+}
+
+// HeartbeatStatus is a snapshot of heartbeat.
+// PassStarted is zero when downloader is idle, LastPass is zero before the first completed pass
+type HeartbeatStatus struct {
+	Alive       bool
+	PassStarted time.Time
+	LastPass    time.Time
+}
+
+// Status snapshot
+func (h *Heartbeat) Status() HeartbeatStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return HeartbeatStatus{
+		Alive:       h.alive,
+		PassStarted: h.passStarted,
+		LastPass:    h.lastPass,
+	}
+}
+
+// setAlive marks queue goroutine as started or finished
+func (h *Heartbeat) setAlive(alive bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.alive = alive
+	h.passStarted = time.Time{}
+}
+
+// beginPass of ProcessDownloader
+func (h *Heartbeat) beginPass() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.passStarted = time.Now()
+}
+
+// endPass of ProcessDownloader
+func (h *Heartbeat) endPass() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.passStarted = time.Time{}
+	h.lastPass = time.Now()
+}
@@ -0,0 +1,74 @@
+package downloaders
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeartbeat(t *testing.T) {
+	h := &Heartbeat{}
+	assert.Equal(t, HeartbeatStatus{}, h.Status())
+
+	h.setAlive(true)
+	h.beginPass()
+	status := h.Status()
+	assert.True(t, status.Alive)
+	assert.False(t, status.PassStarted.IsZero())
+	assert.True(t, status.LastPass.IsZero())
+
+	h.endPass()
+	status = h.Status()
+	assert.True(t, status.PassStarted.IsZero())
+	assert.False(t, status.LastPass.IsZero())
+
+	h.setAlive(false)
+	assert.False(t, h.Status().Alive)
+	assert.Equal(t, status.LastPass, h.Status().LastPass)
+}
+
+func TestProcessQueueHeartbeat(t *testing.T) {
+	mockDB, _, _ := sqlmock.New()
+	defer mockDB.Close()
+	logger, _ := test.NewNullLogger()
+
+	d := &mockDownloader{
+		downloader: &downloader{
+			db:     sqlx.NewDb(mockDB, "sqlmock"),
+			name:   "TEST_DOWNLOADER",
+			queue:  make(chan (bool), 1),
+			stop:   make(chan (bool)),
+			logger: logrus.NewEntry(logger),
+		},
+	}
+
+	done := make(chan (bool))
+	go func() {
+		ProcessQueue(context.Background(), d)
+		close(done)
+	}()
+
+	// Pass is completed even if assets are not available
+	d.Queue() <- true
+	deadline := time.Now().Add(time.Second)
+	for d.Heartbeat().Status().LastPass.IsZero() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.False(t, d.Heartbeat().Status().LastPass.IsZero())
+	assert.True(t, d.Heartbeat().Status().Alive)
+
+	close(d.Stop())
+	<-done
+	assert.False(t, d.Heartbeat().Status().Alive)
+}
+
+func Test_downloader_Heartbeat(t *testing.T) {
+	dl := &downloader{}
+	assert.Equal(t, &dl.heartbeat, dl.Heartbeat())
+}
@@ -0,0 +1,286 @@
+package downloaders
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/dneprix/ohlc/pkg/credentials"
+	"github.com/dneprix/ohlc/pkg/limiters"
+	"github.com/dneprix/ohlc/pkg/metrics"
+)
+
+const (
+	// defaultHTTPTimeout limits one HTTP request attempt
+	defaultHTTPTimeout = 10 * time.Second
+
+	// defaultHTTPRetries after the first failed attempt
+	defaultHTTPRetries = 3
+
+	// defaultMinBackoff and defaultMaxBackoff bound waiting between attempts
+	defaultMinBackoff = 500 * time.Millisecond
+	defaultMaxBackoff = 10 * time.Second
+
+	// errorBodyLimit is a number of response body bytes kept in StatusError
+	errorBodyLimit = 256
+)
+
+// defaultHTTPClient is used by downloaders without own client
+var defaultHTTPClient = NewHTTPClient(logrus.StandardLogger())
+
+// HTTPClient requests data sources with timeout. Failed attempts with
+// retryable errors are repeated with exponential backoff and jitter.
+// Retry-After header of response is honoured up to max backoff.
+// Retry attempts wait for rate limit token like the first request
+type HTTPClient struct {
+	client     *http.Client
+	logger     *logrus.Entry
+	retries    int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	// authorizer adds API credentials to each request attempt
+	authorizer credentials.Authorizer
+
+	// limiter of retry attempts. The first attempt is limited by downloader
+	limiter  limiters.Limiter
+	limitKey string
+	rate     limiters.Rate
+}
+
+// NewHTTPClient constructor with default timeout, retries and backoff
+func NewHTTPClient(logger *logrus.Logger) *HTTPClient {
+	return &HTTPClient{
+		client:     &http.Client{Timeout: defaultHTTPTimeout},
+		logger:     logrus.NewEntry(logger),
+		retries:    defaultHTTPRetries,
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+	}
+}
+
+// Timeout of one request attempt
+func (c *HTTPClient) Timeout() time.Duration {
+	return c.client.Timeout
+}
+
+// SetTimeout of one request attempt
+func (c *HTTPClient) SetTimeout(timeout time.Duration) {
+	c.client.Timeout = timeout
+}
+
+// Retries after the first failed attempt
+func (c *HTTPClient) Retries() int {
+	return c.retries
+}
+
+// SetRetries after the first failed attempt. Zero disables retries
+func (c *HTTPClient) SetRetries(retries int) {
+	c.retries = retries
+}
+
+// SetBackoff bounds of waiting between attempts
+func (c *HTTPClient) SetBackoff(min, max time.Duration) {
+	c.minBackoff, c.maxBackoff = min, max
+}
+
+// SetLogger of retries
+func (c *HTTPClient) SetLogger(logger *logrus.Entry) {
+	c.logger = logger
+}
+
+// Authorizer of requests. Nil authorizer sends anonymous requests
+func (c *HTTPClient) Authorizer() credentials.Authorizer {
+	return c.authorizer
+}
+
+// SetAuthorizer of requests
+func (c *HTTPClient) SetAuthorizer(authorizer credentials.Authorizer) {
+	c.authorizer = authorizer
+}
+
+// SetLimit of retry attempts by limiter bucket key and rate. Nil limiter doesn't limit retries
+func (c *HTTPClient) SetLimit(limiter limiters.Limiter, key string, rate limiters.Rate) {
+	c.limiter, c.limitKey, c.rate = limiter, key, rate
+}
+
+// Get response body of url. Returns *StatusError for non-2xx response
+// and *RequestError if response is not received
+func (c *HTTPClient) Get(ctx context.Context, rawURL string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		data, err := c.get(ctx, rawURL)
+		if err == nil {
+			return data, nil
+		}
+		if attempt >= c.retries || !isTemporary(err) || ctx.Err() != nil {
+			return nil, err
+		}
+
+		wait := c.backoff(attempt)
+		if se, ok := err.(*StatusError); ok && se.RetryAfter > wait {
+			if se.RetryAfter > c.maxBackoff {
+				return nil, err
+			}
+			wait = se.RetryAfter
+		}
+
+		host := ""
+		if u, err := url.Parse(rawURL); err == nil {
+			host = u.Host
+		}
+		metrics.HTTPRetries.WithLabelValues(host).Inc()
+		c.logger.WithFields(logrus.Fields{
+			"host":    host,
+			"attempt": attempt + 1,
+		}).Warnf("Retry HTTP request in %s: %s", wait, err)
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, err
+		}
+		if c.limiter != nil {
+			if c.limiter.Wait(ctx, c.limitKey, c.rate) != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// get does one request attempt
+func (c *HTTPClient) get(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, &RequestError{URL: rawURL, Err: err}
+	}
+	if c.authorizer != nil {
+		if err := c.authorizer.Authorize(req); err != nil {
+			return nil, &RequestError{URL: rawURL, Err: fmt.Errorf("Authorize request fail: %s", err)}
+		}
+	}
+	res, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		// Authorized url may contain API key and is hidden from logs
+		if ue, ok := err.(*url.Error); ok {
+			ue.URL = rawURL
+		}
+		return nil, &RequestError{URL: rawURL, Err: err}
+	}
+	defer res.Body.Close()
+	metrics.HTTPResponses.WithLabelValues(req.URL.Host, strconv.Itoa(res.StatusCode)).Inc()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, errorBodyLimit))
+		return nil, &StatusError{
+			URL:        rawURL,
+			StatusCode: res.StatusCode,
+			RetryAfter: parseRetryAfter(res.Header.Get("Retry-After"), time.Now()),
+			Body:       string(body),
+		}
+	}
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, &RequestError{URL: rawURL, Err: fmt.Errorf("Read response body fail: %s", err)}
+	}
+	return data, nil
+}
+
+// backoff before next attempt: exponential from min to max backoff with
+// random jitter in the upper half
+func (c *HTTPClient) backoff(attempt int) time.Duration {
+	wait := c.maxBackoff
+	if attempt < 32 && c.minBackoff<<uint(attempt) < c.maxBackoff {
+		wait = c.minBackoff << uint(attempt)
+	}
+	if wait <= 1 {
+		return wait
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)))
+}
+
+// parseRetryAfter header in seconds or HTTP date. Returns zero if header is invalid
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// temporary error can be retried
+type temporary interface {
+	Temporary() bool
+}
+
+// isTemporary checks typed HTTP errors
+func isTemporary(err error) bool {
+	te, ok := err.(temporary)
+	return ok && te.Temporary()
+}
+
+// StatusError is a non-2xx response of data source
+type StatusError struct {
+	URL        string
+	StatusCode int
+	RetryAfter time.Duration
+	Body       string
+}
+
+// Error implements error interface
+func (se *StatusError) Error() string {
+	return fmt.Sprintf("HTTP response status fail: %d %s", se.StatusCode, http.StatusText(se.StatusCode))
+}
+
+// Temporary is true for rate limit, timeout and server errors except 501
+func (se *StatusError) Temporary() bool {
+	switch se.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	case http.StatusNotImplemented:
+		return false
+	}
+	return se.StatusCode >= 500
+}
+
+// RequestError is a failed request without response
+type RequestError struct {
+	URL string
+	Err error
+}
+
+// Error implements error interface
+func (re *RequestError) Error() string {
+	return fmt.Sprintf("Get HTTP Request fail: %s", re.Err)
+}
+
+// Temporary is true for network errors, e.g. timeout or refused connection.
+// Invalid url and cancelled context are not temporary
+func (re *RequestError) Temporary() bool {
+	ue, ok := re.Err.(*url.Error)
+	if !ok {
+		return false
+	}
+	if ue.Err == context.Canceled || ue.Err == context.DeadlineExceeded {
+		return false
+	}
+	if ue.Err == io.EOF || ue.Err == io.ErrUnexpectedEOF {
+		return true
+	}
+	_, ok = ue.Err.(net.Error)
+	return ok
+}
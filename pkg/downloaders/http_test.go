@@ -0,0 +1,346 @@
+package downloaders
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dneprix/ohlc/pkg/credentials"
+	"github.com/dneprix/ohlc/pkg/limiters"
+)
+
+func newTestHTTPClient() *HTTPClient {
+	logger, _ := test.NewNullLogger()
+	c := NewHTTPClient(logger)
+	c.SetBackoff(time.Millisecond, 10*time.Millisecond)
+	return c
+}
+
+// newStatusServer responds with statuses one by one and then with 200
+func newStatusServer(statuses ...int) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= len(statuses) {
+			w.WriteHeader(statuses[requests-1])
+			w.Write([]byte("<html>error</html>"))
+			return
+		}
+		w.Write([]byte(`{"result":{}}`))
+	}))
+	return server, &requests
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	c := NewHTTPClient(logger)
+	assert.Equal(t, defaultHTTPTimeout, c.Timeout())
+	assert.Equal(t, defaultHTTPRetries, c.Retries())
+	assert.Equal(t, defaultMinBackoff, c.minBackoff)
+	assert.Equal(t, defaultMaxBackoff, c.maxBackoff)
+
+	c.SetTimeout(time.Second)
+	assert.Equal(t, time.Second, c.Timeout())
+	c.SetRetries(0)
+	assert.Equal(t, 0, c.Retries())
+}
+
+func TestHTTPClient_Get(t *testing.T) {
+	server, requests := newStatusServer()
+	defer server.Close()
+
+	data, err := newTestHTTPClient().Get(context.Background(), server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"result":{}}`, string(data))
+	assert.Equal(t, 1, *requests)
+}
+
+func TestHTTPClient_GetRetry(t *testing.T) {
+	server, requests := newStatusServer(http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusBadGateway)
+	defer server.Close()
+
+	data, err := newTestHTTPClient().Get(context.Background(), server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"result":{}}`, string(data))
+	assert.Equal(t, 4, *requests)
+}
+
+func TestHTTPClient_GetRetriesExhausted(t *testing.T) {
+	server, requests := newStatusServer(500, 500, 500, 500, 500)
+	defer server.Close()
+
+	c := newTestHTTPClient()
+	c.SetRetries(2)
+	data, err := c.Get(context.Background(), server.URL)
+	assert.Nil(t, data)
+	assert.EqualError(t, err, "HTTP response status fail: 500 Internal Server Error")
+	assert.IsType(t, &StatusError{}, err)
+	assert.Equal(t, "<html>error</html>", err.(*StatusError).Body)
+	assert.Equal(t, 3, *requests)
+}
+
+func TestHTTPClient_GetFatalStatus(t *testing.T) {
+	server, requests := newStatusServer(http.StatusNotFound)
+	defer server.Close()
+
+	_, err := newTestHTTPClient().Get(context.Background(), server.URL)
+	assert.EqualError(t, err, "HTTP response status fail: 404 Not Found")
+	assert.Equal(t, 1, *requests)
+}
+
+func TestHTTPClient_GetRetryAfter(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	// Retry-After exceeds max backoff
+	_, err := newTestHTTPClient().Get(context.Background(), server.URL)
+	assert.IsType(t, &StatusError{}, err)
+	assert.Equal(t, time.Second, err.(*StatusError).RetryAfter)
+	assert.Equal(t, 1, requests)
+
+	// Retry-After is waited instead of shorter backoff
+	c := newTestHTTPClient()
+	c.SetBackoff(time.Millisecond, 2*time.Second)
+	c.SetRetries(1)
+	start := time.Now()
+	_, err = c.Get(context.Background(), server.URL)
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) >= time.Second)
+	assert.Equal(t, 3, requests)
+}
+
+func TestHTTPClient_GetContextDone(t *testing.T) {
+	server, requests := newStatusServer(500, 500)
+	defer server.Close()
+
+	c := newTestHTTPClient()
+	c.SetBackoff(time.Hour, time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := c.Get(ctx, server.URL)
+	assert.EqualError(t, err, "HTTP response status fail: 500 Internal Server Error")
+	assert.Equal(t, 1, *requests)
+}
+
+func TestHTTPClient_GetRequestError(t *testing.T) {
+	c := newTestHTTPClient()
+
+	// Invalid url is not retried
+	_, err := c.Get(context.Background(), "TEST_URL")
+	assert.IsType(t, &RequestError{}, err)
+	assert.Contains(t, err.Error(), "Get HTTP Request fail")
+	assert.False(t, err.(*RequestError).Temporary())
+
+	// Refused connection is retried
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+	_, err = c.Get(context.Background(), server.URL)
+	assert.IsType(t, &RequestError{}, err)
+	assert.True(t, err.(*RequestError).Temporary())
+}
+
+func TestHTTPClient_GetTimeout(t *testing.T) {
+	requests := int32(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	c := newTestHTTPClient()
+	c.SetTimeout(time.Millisecond)
+	c.SetRetries(1)
+	_, err := c.Get(context.Background(), server.URL)
+	assert.IsType(t, &RequestError{}, err)
+	assert.True(t, err.(*RequestError).Temporary())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestHTTPClient_backoff(t *testing.T) {
+	c := newTestHTTPClient()
+	c.SetBackoff(100*time.Millisecond, time.Second)
+	for attempt, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		max *= time.Millisecond
+		for i := 0; i < 10; i++ {
+			wait := c.backoff(attempt)
+			assert.True(t, wait >= max/2 && wait < max, "attempt %d: %s", attempt, wait)
+		}
+	}
+	assert.True(t, c.backoff(100) <= time.Second)
+
+	c.SetBackoff(0, 0)
+	assert.Equal(t, time.Duration(0), c.backoff(0))
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Date(2019, 9, 27, 6, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(t, 120*time.Second, parseRetryAfter("120", now))
+	assert.Equal(t, 30*time.Second, parseRetryAfter("Fri, 27 Sep 2019 06:00:30 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("Fri, 27 Sep 2019 05:00:00 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("-1", now))
+}
+
+func TestStatusError_Temporary(t *testing.T) {
+	tests := map[int]bool{
+		http.StatusBadRequest:          false,
+		http.StatusUnauthorized:        false,
+		http.StatusNotFound:            false,
+		http.StatusRequestTimeout:      true,
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusNotImplemented:      false,
+		http.StatusBadGateway:          true,
+		http.StatusServiceUnavailable:  true,
+		http.StatusGatewayTimeout:      true,
+	}
+	for code, expected := range tests {
+		assert.Equal(t, expected, (&StatusError{StatusCode: code}).Temporary(), "status %d", code)
+	}
+}
+
+func TestRequestError_Temporary(t *testing.T) {
+	assert.False(t, (&RequestError{Err: fmt.Errorf("error")}).Temporary())
+	assert.False(t, (&RequestError{Err: &url.Error{Err: context.Canceled}}).Temporary())
+	assert.False(t, (&RequestError{Err: &url.Error{Err: context.DeadlineExceeded}}).Temporary())
+	assert.True(t, (&RequestError{Err: &url.Error{Err: io.EOF}}).Temporary())
+}
+
+func Test_downloader_HTTPClient(t *testing.T) {
+	dl := &downloader{}
+	assert.Equal(t, defaultHTTPClient, dl.HTTPClient())
+	c := newTestHTTPClient()
+	dl.SetHTTPClient(c)
+	assert.Equal(t, c, dl.HTTPClient())
+
+	// Downloader without base structure uses default client
+	assert.Equal(t, defaultHTTPClient, (&KrakenDownloader{}).HTTPClient())
+}
+
+func TestHTTPClient_GetAuthorizer(t *testing.T) {
+	keys := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.URL.Query().Get("api_key"))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	c := newTestHTTPClient()
+	c.SetRetries(1)
+	assert.Nil(t, c.Authorizer())
+	c.SetAuthorizer(&credentials.QueryAuthorizer{Name: "api_key", Key: "TEST_KEY"})
+
+	// Each attempt is authorized
+	_, err := c.Get(context.Background(), server.URL+"?after=1")
+	assert.IsType(t, &StatusError{}, err)
+	assert.Equal(t, []string{"TEST_KEY", "TEST_KEY"}, keys)
+	assert.Equal(t, server.URL+"?after=1", err.(*StatusError).URL)
+
+	// API key is not leaked by request error
+	server.Close()
+	_, err = c.Get(context.Background(), server.URL+"?after=1")
+	assert.IsType(t, &RequestError{}, err)
+	assert.NotContains(t, err.Error(), "TEST_KEY")
+}
+
+type failAuthorizer struct{}
+
+func (failAuthorizer) Authorize(req *http.Request) error {
+	return fmt.Errorf("TEST_ERROR")
+}
+
+func TestHTTPClient_GetAuthorizerFail(t *testing.T) {
+	server, requests := newStatusServer()
+	defer server.Close()
+
+	c := newTestHTTPClient()
+	c.SetAuthorizer(failAuthorizer{})
+	_, err := c.Get(context.Background(), server.URL)
+	assert.EqualError(t, err, "Get HTTP Request fail: Authorize request fail: TEST_ERROR")
+	assert.Equal(t, 0, *requests)
+}
+
+func Test_downloader_SetCredentials(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	d := NewCryptowatDownloader(nil, logger)
+	assert.Equal(t, cryptowatAuth, d.AuthDefaults())
+	assert.NoError(t, d.SetCredentials(credentials.Credentials{Key: "TEST_KEY"}))
+	assert.Equal(t, &credentials.HeaderAuthorizer{Name: "X-CW-API-Key", Key: "TEST_KEY"}, d.HTTPClient().Authorizer())
+
+	err := d.SetCredentials(credentials.Credentials{Auth: "TEST_AUTH", Key: "TEST_KEY"})
+	assert.EqualError(t, err, `CRYPTOWAT credentials fail: Unknown auth type: "TEST_AUTH"`)
+
+	// Default client is not authorized
+	dl := &downloader{name: "TEST"}
+	assert.NoError(t, dl.SetCredentials(credentials.Credentials{Token: "TEST_TOKEN"}))
+	assert.NotEqual(t, defaultHTTPClient, dl.HTTPClient())
+	assert.Nil(t, defaultHTTPClient.Authorizer())
+	assert.Equal(t, &credentials.BearerAuthorizer{Token: "TEST_TOKEN"}, dl.HTTPClient().Authorizer())
+}
+
+type countLimiter struct {
+	keys []string
+	err  error
+}
+
+func (cl *countLimiter) Wait(ctx context.Context, key string, rate limiters.Rate) error {
+	cl.keys = append(cl.keys, key)
+	return cl.err
+}
+
+func TestHTTPClient_GetRetryLimit(t *testing.T) {
+	server, requests := newStatusServer(http.StatusTooManyRequests, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	// Each retry waits for rate limit token, the first attempt is limited by downloader
+	limiter := &countLimiter{}
+	c := newTestHTTPClient()
+	c.SetLimit(limiter, "TEST_KEY", limiters.Every(time.Second))
+	_, err := c.Get(context.Background(), server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, *requests)
+	assert.Equal(t, []string{"TEST_KEY", "TEST_KEY"}, limiter.keys)
+
+	// Retry is not sent without token
+	server, requests = newStatusServer(http.StatusServiceUnavailable)
+	defer server.Close()
+	c.SetLimit(&countLimiter{err: context.Canceled}, "TEST_KEY", limiters.Every(time.Second))
+	_, err = c.Get(context.Background(), server.URL)
+	assert.EqualError(t, err, "HTTP response status fail: 503 Service Unavailable")
+	assert.Equal(t, 1, *requests)
+}
+
+func Test_downloader_syncHTTPLimit(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	d := NewCryptowatDownloader(nil, logger)
+	assert.Equal(t, defaultLimiter, d.HTTPClient().limiter)
+	assert.Equal(t, cryptowatHost, d.HTTPClient().limitKey)
+	assert.Equal(t, limiters.Every(cryptowatWaitTime), d.HTTPClient().rate)
+
+	limiter := limiters.NewMemory()
+	d.SetLimiter(limiter)
+	d.SetLimitKey("TEST_KEY")
+	d.SetRate(limiters.Rate{Every: time.Second, Burst: 2})
+	assert.Equal(t, limiter, d.HTTPClient().limiter)
+	assert.Equal(t, "TEST_KEY", d.HTTPClient().limitKey)
+	assert.Equal(t, limiters.Rate{Every: time.Second, Burst: 2}, d.HTTPClient().rate)
+
+	c := newTestHTTPClient()
+	d.SetHTTPClient(c)
+	assert.Equal(t, "TEST_KEY", c.limitKey)
+}
@@ -1,6 +1,12 @@
 package downloaders
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -12,6 +18,15 @@ import (
 
 const krakenWaitTime = 10 * time.Second
 
+// krakenHost is a rate limit key of Kraken API
+const krakenHost = "api.kraken.com"
+
+// krakenMaxCandles is a number of the latest candles returned by Kraken
+const krakenMaxCandles = 720
+
+// krakenDefaultInterval is used when asset URL has no interval param (minutes)
+const krakenDefaultInterval = 1
+
 // KrakenDownloader structure
 type KrakenDownloader struct {
 	*downloader
@@ -19,13 +34,144 @@ type KrakenDownloader struct {
 
 // NewKrakenDownloader constructor
 func NewKrakenDownloader(db *sqlx.DB, logger *logrus.Logger) *KrakenDownloader {
-	return &KrakenDownloader{
+	d := &KrakenDownloader{
 		newDownloader(db, logger, "KRAKEN", krakenWaitTime),
 	}
+	d.SetLimitKey(krakenHost)
+	return d
+}
+
+// OldestCloseTime of period candles returned by Kraken at now, including forming candle
+func (kd *KrakenDownloader) OldestCloseTime(period uint, now time.Time) int64 {
+	p := int64(period)
+	return (now.Unix()/p + 1 - (krakenMaxCandles - 1)) * p
 }
 
 // DownloadCandles function
-func (kd *KrakenDownloader) DownloadCandles(asset *assets.Asset) ([]*candles.Candle, error) {
-	// TODO: Implement DownloadCandles for KrakenDownloader
-	return nil, nil
+func (kd *KrakenDownloader) DownloadCandles(ctx context.Context, asset *assets.Asset) ([]*candles.Candle, error) {
+	return kd.DownloadCandlesRange(ctx, asset, Range{})
+}
+
+// DownloadCandlesRange function. Range start is requested by since param.
+// Kraken returns only last 720 candles, so older history is not available
+func (kd *KrakenDownloader) DownloadCandlesRange(ctx context.Context, asset *assets.Asset, r Range) ([]*candles.Candle, error) {
+	period, err := krakenPeriod(asset.URL)
+	if err != nil {
+		return nil, err
+	}
+	if r.Period != 0 && r.Period != period {
+		return nil, fmt.Errorf("Unsupported period for asset url: %d", r.Period)
+	}
+
+	params := url.Values{}
+	if r.After != 0 {
+		// since is compared with candle open time
+		params.Set("since", strconv.FormatInt(r.After-int64(period)-1, 10))
+	}
+	requestURL, err := withQuery(asset.URL, params)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := kd.HTTPClient().Get(ctx, requestURL)
+	if err != nil {
+		return nil, err
+	}
+
+	candlesResponse := KrakenResponse{}
+	if err := json.Unmarshal(data, &candlesResponse); err != nil {
+		return nil, fmt.Errorf("Parse response fail: %s", err)
+	}
+	if len(candlesResponse.Error) > 0 {
+		return nil, &KrakenError{Messages: candlesResponse.Error}
+	}
+
+	candlesData := []*candles.Candle{}
+	for pair, result := range candlesResponse.Result {
+		// "last" is an id for polling new data, not a pair
+		if pair == "last" {
+			continue
+		}
+		periods := []KrakenResponsePeriod{}
+		if err := json.Unmarshal(result, &periods); err != nil {
+			return nil, fmt.Errorf("Parse response pair %s fail: %s", pair, err)
+		}
+		for _, p := range periods {
+			candlesData = append(candlesData, &candles.Candle{
+				AssetID:    asset.ID,
+				Period:     period,
+				CloseTime:  p.OpenTime + int64(period),
+				OpenPrice:  p.OpenPrice,
+				HighPrice:  p.HighPrice,
+				LowPrice:   p.LowPrice,
+				ClosePrice: p.ClosePrice,
+				Volume:     p.Volume,
+			})
+		}
+	}
+
+	return r.Filter(candlesData), nil
+}
+
+// krakenPeriod returns candle period in seconds from interval param of url
+func krakenPeriod(rawURL string) (uint, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0, fmt.Errorf("Parse asset url fail: %s", err)
+	}
+	interval := u.Query().Get("interval")
+	if interval == "" {
+		return krakenDefaultInterval * 60, nil
+	}
+	minutes, err := strconv.ParseUint(interval, 10, 32)
+	if err != nil || minutes == 0 {
+		return 0, fmt.Errorf("Parse asset url interval fail: %q", interval)
+	}
+	return uint(minutes) * 60, nil
+}
+
+// KrakenError is an error list returned by Kraken API
+type KrakenError struct {
+	Messages []string
+}
+
+// Error implements error interface
+func (ke *KrakenError) Error() string {
+	return fmt.Sprintf("Kraken response error: %s", strings.Join(ke.Messages, "; "))
+}
+
+// KrakenResponse structure
+type KrakenResponse struct {
+	Error  []string                   `json:"error"`
+	Result map[string]json.RawMessage `json:"result"`
+}
+
+// KrakenResponsePeriod structure
+type KrakenResponsePeriod struct {
+	OpenTime   int64
+	OpenPrice  candles.Decimal
+	HighPrice  candles.Decimal
+	LowPrice   candles.Decimal
+	ClosePrice candles.Decimal
+	VWAP       candles.Decimal
+	Volume     candles.Decimal
+	Count      int64
+}
+
+// UnmarshalJSON for KrakenResponsePeriod. Kraken sends prices and volume as decimal strings
+func (krp *KrakenResponsePeriod) UnmarshalJSON(buf []byte) error {
+	tmp := []interface{}{
+		&krp.OpenTime,
+		&krp.OpenPrice,
+		&krp.HighPrice,
+		&krp.LowPrice,
+		&krp.ClosePrice,
+		&krp.VWAP,
+		&krp.Volume,
+		&krp.Count,
+	}
+	if err := json.Unmarshal(buf, &tmp); err != nil {
+		return fmt.Errorf("Parse response period fail: %s", err)
+	}
+	return nil
 }
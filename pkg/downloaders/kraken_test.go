@@ -1,7 +1,12 @@
 package downloaders
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
@@ -9,6 +14,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/dneprix/ohlc/pkg/assets"
+	"github.com/dneprix/ohlc/pkg/candles"
 )
 
 func TestNewKrakenDownloader(t *testing.T) {
@@ -24,13 +30,232 @@ func TestNewKrakenDownloader(t *testing.T) {
 	assert.Equal(t, expectedLogger, actual.logger.Logger)
 	assert.Equal(t, expectedDB, actual.db)
 	assert.Equal(t, expectedName, actual.name)
-	assert.Equal(t, expectedWaitTime, actual.wait)
+	assert.Equal(t, expectedWaitTime, actual.rate.Every)
+	assert.Equal(t, krakenHost, actual.limitKey)
 }
 
-func TestKrakenDownloader_DownloadCandles(t *testing.T) {
+func TestKrakenDownloader_DownloadCandlesSuccess(t *testing.T) {
 	d := &KrakenDownloader{}
-	asset := &assets.Asset{}
-	actual, err := d.DownloadCandles(asset)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(
+			`{
+          "error": [],
+          "result": {
+            "XXBTZUSD": [
+              [1569563340, "7937.2", "7937.9", "7937.1", "7937.6", "7937.5", "0.00839492", 3],
+              [1569563400, "7937.6", "7940.0", "7936.0", "7939.9", "7938.1", "1.20000000", 12]
+            ],
+            "last": 1569563400
+          }
+        }
+        `))
+		return
+	}))
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: server.URL + "?pair=XBTUSD&interval=5",
+	}
+	actual, err := d.DownloadCandles(context.Background(), asset)
+	assert.NoError(t, err)
+	assert.Len(t, actual, 2)
+	assert.Equal(t, uint(1), actual[0].AssetID)
+	assert.Equal(t, uint(300), actual[0].Period)
+	assert.Equal(t, int64(1569563640), actual[0].CloseTime)
+	assert.Equal(t, candles.MustParseDecimal("7937.2"), actual[0].OpenPrice)
+	assert.Equal(t, candles.MustParseDecimal("7937.9"), actual[0].HighPrice)
+	assert.Equal(t, candles.MustParseDecimal("7937.1"), actual[0].LowPrice)
+	assert.Equal(t, candles.MustParseDecimal("7937.6"), actual[0].ClosePrice)
+	assert.Equal(t, candles.MustParseDecimal("0.00839492"), actual[0].Volume)
+	assert.Equal(t, "1.20000000", actual[1].Volume.String())
+}
+
+func TestKrakenDownloader_DownloadCandlesDefaultInterval(t *testing.T) {
+	d := &KrakenDownloader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":[[1569563340,"1","1","1","1","1","1",1]],"last":1569563340}}`))
+		return
+	}))
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: server.URL + "?pair=XBTUSD",
+	}
+	actual, err := d.DownloadCandles(context.Background(), asset)
+	assert.NoError(t, err)
+	assert.Len(t, actual, 1)
+	assert.Equal(t, uint(60), actual[0].Period)
+	assert.Equal(t, int64(1569563400), actual[0].CloseTime)
+}
+
+func TestKrakenDownloader_DownloadCandlesRange(t *testing.T) {
+	d := &KrakenDownloader{}
+
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":[
+          [1569563280,"1","1","1","1","1","1",1],
+          [1569563340,"1","1","1","1","1","1",1],
+          [1569563400,"1","1","1","1","1","1",1]
+        ],"last":1569563400}}`))
+		return
+	}))
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: server.URL + "?pair=XBTUSD&interval=1",
+	}
+	actual, err := d.DownloadCandlesRange(context.Background(), asset, Range{Period: 60, After: 1569563400, Before: 1569563400})
+	assert.NoError(t, err)
+	assert.Equal(t, "XBTUSD", query.Get("pair"))
+	assert.Equal(t, "1569563339", query.Get("since"))
+	assert.Len(t, actual, 1)
+	assert.Equal(t, int64(1569563400), actual[0].CloseTime)
+}
+
+func TestKrakenDownloader_DownloadCandlesRangeFailPeriod(t *testing.T) {
+	d := &KrakenDownloader{}
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: "http://localhost?pair=XBTUSD&interval=1",
+	}
+	actual, err := d.DownloadCandlesRange(context.Background(), asset, Range{Period: 3600})
+	assert.Nil(t, actual)
+	assert.Error(t, err)
+	assert.EqualError(t, err, "Unsupported period for asset url: 3600")
+}
+
+func TestKrakenDownloader_DownloadCandlesFailInterval(t *testing.T) {
+	d := &KrakenDownloader{}
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: "http://localhost?pair=XBTUSD&interval=minute",
+	}
+	actual, err := d.DownloadCandles(context.Background(), asset)
 	assert.Nil(t, actual)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Parse asset url interval fail")
+}
+
+func TestKrakenDownloader_DownloadCandlesFailURL(t *testing.T) {
+	d := &KrakenDownloader{}
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: "%",
+	}
+	actual, err := d.DownloadCandles(context.Background(), asset)
+	assert.Nil(t, actual)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Parse asset url fail")
+}
+
+func TestKrakenDownloader_DownloadCandlesFailHttp(t *testing.T) {
+	d := &KrakenDownloader{}
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: "TEST_URL",
+	}
+	actual, err := d.DownloadCandles(context.Background(), asset)
+	assert.Nil(t, actual)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Get HTTP Request fail")
+}
+
+func TestKrakenDownloader_DownloadCandlesFailParse(t *testing.T) {
+	d := &KrakenDownloader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<>"))
+		return
+	}))
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: server.URL,
+	}
+	actual, err := d.DownloadCandles(context.Background(), asset)
+	assert.Nil(t, actual)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Parse response fail")
+}
+
+func TestKrakenDownloader_DownloadCandlesFailParsePair(t *testing.T) {
+	d := &KrakenDownloader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":[[1569563340,"price","1","1","1","1","1",1]]}}`))
+		return
+	}))
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: server.URL,
+	}
+	actual, err := d.DownloadCandles(context.Background(), asset)
+	assert.Nil(t, actual)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Parse response pair XXBTZUSD fail")
+}
+
+func TestKrakenDownloader_DownloadCandlesFailResponseError(t *testing.T) {
+	d := &KrakenDownloader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"error":["EQuery:Unknown asset pair","EGeneral:Invalid arguments"]}`))
+		return
+	}))
+
+	asset := &assets.Asset{
+		ID:  1,
+		URL: server.URL,
+	}
+	actual, err := d.DownloadCandles(context.Background(), asset)
+	assert.Nil(t, actual)
+	assert.Error(t, err)
+	assert.IsType(t, &KrakenError{}, err)
+	assert.Equal(t, []string{"EQuery:Unknown asset pair", "EGeneral:Invalid arguments"}, err.(*KrakenError).Messages)
+	assert.EqualError(t, err, "Kraken response error: EQuery:Unknown asset pair; EGeneral:Invalid arguments")
+}
+
+func TestKrakenResponsePeriod_UnmarshalJSON_Success(t *testing.T) {
+	period := &KrakenResponsePeriod{}
+	err := period.UnmarshalJSON([]byte(`[1481634360, "781.14", "782.14", "781.13", "781.12", "781.5", "1.92525", 7]`))
 	assert.NoError(t, err)
+	assert.Equal(t, period.OpenTime, int64(1481634360))
+	assert.Equal(t, period.OpenPrice, candles.MustParseDecimal("781.14"))
+	assert.Equal(t, period.HighPrice, candles.MustParseDecimal("782.14"))
+	assert.Equal(t, period.LowPrice, candles.MustParseDecimal("781.13"))
+	assert.Equal(t, period.ClosePrice, candles.MustParseDecimal("781.12"))
+	assert.Equal(t, period.VWAP, candles.MustParseDecimal("781.5"))
+	assert.Equal(t, period.Volume, candles.MustParseDecimal("1.92525"))
+	assert.Equal(t, period.Count, int64(7))
+}
+
+func TestKrakenResponsePeriod_UnmarshalJSON_Fail(t *testing.T) {
+	period := &KrakenResponsePeriod{}
+	err := period.UnmarshalJSON([]byte("<>"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Parse response period fail")
+}
+
+func TestKrakenResponsePeriod_UnmarshalJSON_FailPrice(t *testing.T) {
+	period := &KrakenResponsePeriod{}
+	err := period.UnmarshalJSON([]byte(`[1481634360, "781.14", "high", "781.13", "781.12", "781.5", "1.92525", 7]`))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Parse response period fail")
+}
+
+func TestKrakenDownloader_OldestCloseTime(t *testing.T) {
+	// Forming candle closes at 1569563460, the oldest of 720 candles 719 periods before
+	now := time.Unix(1569563430, 0)
+	assert.Equal(t, int64(1569563460-719*60), (&KrakenDownloader{}).OldestCloseTime(60, now))
+
+	var _ HistoryDownloader = &KrakenDownloader{}
 }
@@ -0,0 +1,11 @@
+package downloaders
+
+import (
+	"github.com/dneprix/ohlc/pkg/candles"
+)
+
+// Publisher receives candles which were inserted or updated by downloader.
+// Publish must not block downloader
+type Publisher interface {
+	Publish(candlesData []*candles.Candle)
+}
@@ -0,0 +1,105 @@
+package downloaders
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/dneprix/ohlc/pkg/assets"
+	"github.com/dneprix/ohlc/pkg/candles"
+)
+
+// Range limits downloaded candles. Zero fields are not limited
+type Range struct {
+	// Period of candles in seconds
+	Period uint
+	// After is the earliest close time (inclusive)
+	After int64
+	// Before is the latest close time (inclusive)
+	Before int64
+}
+
+// RangeDownloader is implemented by downloaders which can request candles
+// for a range of close times instead of source default window
+type RangeDownloader interface {
+	Downloader
+
+	DownloadCandlesRange(context.Context, *assets.Asset, Range) ([]*candles.Candle, error)
+}
+
+// HistoryDownloader is implemented by downloaders which serve only recent history
+type HistoryDownloader interface {
+	// OldestCloseTime of period candles which can be downloaded at now
+	OldestCloseTime(period uint, now time.Time) int64
+}
+
+// Contains checks if candle is inside range
+func (r Range) Contains(c *candles.Candle) bool {
+	if r.Period != 0 && c.Period != r.Period {
+		return false
+	}
+	if r.After != 0 && c.CloseTime < r.After {
+		return false
+	}
+	if r.Before != 0 && c.CloseTime > r.Before {
+		return false
+	}
+	return true
+}
+
+// Filter candles inside range
+func (r Range) Filter(candlesData []*candles.Candle) []*candles.Candle {
+	filtered := make([]*candles.Candle, 0, len(candlesData))
+	for _, c := range candlesData {
+		if r.Contains(c) {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
+// incrementalRange starts from the earliest of last stored close times of
+// asset periods. Last stored candle is downloaded again because it could be
+// saved before its period was closed. Empty range is returned if any asset
+// period has no stored candles
+func incrementalRange(closeTimes map[uint]int64, asset *assets.Asset) Range {
+	periods := make([]uint, 0, len(asset.Periods))
+	for _, p := range asset.Periods {
+		periods = append(periods, uint(p))
+	}
+	if len(periods) == 0 {
+		for p := range closeTimes {
+			periods = append(periods, p)
+		}
+	}
+
+	r := Range{}
+	for _, p := range periods {
+		closeTime, ok := closeTimes[p]
+		if !ok {
+			return Range{}
+		}
+		if r.After == 0 || closeTime < r.After {
+			r.After = closeTime
+		}
+	}
+	return r
+}
+
+// withQuery returns url with query params replaced by params
+func withQuery(rawURL string, params url.Values) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("Parse asset url fail: %s", err)
+	}
+	if len(params) == 0 {
+		return rawURL, nil
+	}
+	q := u.Query()
+	for key, values := range params {
+		q[key] = values
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
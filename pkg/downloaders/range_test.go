@@ -0,0 +1,71 @@
+package downloaders
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dneprix/ohlc/pkg/assets"
+	"github.com/dneprix/ohlc/pkg/candles"
+)
+
+func TestRange_Contains(t *testing.T) {
+	c := &candles.Candle{Period: 60, CloseTime: 1569563400}
+
+	assert.True(t, Range{}.Contains(c))
+	assert.True(t, Range{Period: 60}.Contains(c))
+	assert.False(t, Range{Period: 3600}.Contains(c))
+	assert.True(t, Range{After: 1569563400}.Contains(c))
+	assert.False(t, Range{After: 1569563460}.Contains(c))
+	assert.True(t, Range{Before: 1569563400}.Contains(c))
+	assert.False(t, Range{Before: 1569563340}.Contains(c))
+	assert.True(t, Range{Period: 60, After: 1569563340, Before: 1569563460}.Contains(c))
+}
+
+func TestRange_Filter(t *testing.T) {
+	candlesData := []*candles.Candle{
+		{Period: 60, CloseTime: 1569563340},
+		{Period: 60, CloseTime: 1569563400},
+		{Period: 3600, CloseTime: 1569563400},
+		{Period: 60, CloseTime: 1569563460},
+	}
+
+	actual := Range{Period: 60, After: 1569563400}.Filter(candlesData)
+	assert.Equal(t, []*candles.Candle{candlesData[1], candlesData[3]}, actual)
+
+	actual = Range{}.Filter(candlesData)
+	assert.Equal(t, candlesData, actual)
+}
+
+func Test_withQuery(t *testing.T) {
+	actual, err := withQuery("https://api.kraken.com/0/public/OHLC?pair=XBTUSD", url.Values{})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://api.kraken.com/0/public/OHLC?pair=XBTUSD", actual)
+
+	actual, err = withQuery("https://api.kraken.com/0/public/OHLC?pair=XBTUSD&since=1", url.Values{"since": {"1569563400"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://api.kraken.com/0/public/OHLC?pair=XBTUSD&since=1569563400", actual)
+
+	actual, err = withQuery("%", url.Values{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Parse asset url fail")
+	assert.Empty(t, actual)
+}
+
+func Test_incrementalRange(t *testing.T) {
+	closeTimes := map[uint]int64{60: 1569563400, 3600: 1569560400}
+
+	// All stored periods
+	assert.Equal(t, Range{After: 1569560400}, incrementalRange(closeTimes, &assets.Asset{}))
+
+	// Asset periods only
+	assert.Equal(t, Range{After: 1569563400}, incrementalRange(closeTimes, &assets.Asset{Periods: pq.Int64Array{60}}))
+
+	// Asset period without stored candles
+	assert.Equal(t, Range{}, incrementalRange(closeTimes, &assets.Asset{Periods: pq.Int64Array{60, 86400}}))
+
+	// No stored candles
+	assert.Equal(t, Range{}, incrementalRange(map[uint]int64{}, &assets.Asset{}))
+}
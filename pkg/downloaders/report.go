@@ -0,0 +1,74 @@
+package downloaders
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/dneprix/ohlc/pkg/candles"
+)
+
+// assetOutcome of processing one asset in downloader pass
+type assetOutcome int
+
+const (
+	outcomeSkipped assetOutcome = iota
+	outcomeFailed
+	outcomeEmpty
+	outcomeSaved
+)
+
+// PassReport aggregates outcomes of downloader assets in one pass
+type PassReport struct {
+	// Processed assets by outcome. Skipped assets are not due by their own interval,
+	// empty assets have no new or valid candles
+	Processed int
+	Skipped   int
+	Failed    int
+	Empty     int
+	Saved     int
+
+	// Candles of saved assets by outcome
+	Inserted  int
+	Updated   int
+	Unchanged int
+
+	// Aborted pass didn't start all due assets, e.g. on stop or exhausted allowance
+	Aborted  bool
+	Duration time.Duration
+}
+
+// add asset outcome to report
+func (pr *PassReport) add(outcome assetOutcome, result candles.SaveResult) {
+	switch outcome {
+	case outcomeSkipped:
+		pr.Skipped++
+		return
+	case outcomeFailed:
+		pr.Failed++
+	case outcomeEmpty:
+		pr.Empty++
+	case outcomeSaved:
+		pr.Saved++
+	}
+	pr.Processed++
+	pr.Inserted += result.Inserted
+	pr.Updated += result.Updated
+	pr.Unchanged += result.Unchanged
+}
+
+// Fields of report for logging
+func (pr PassReport) Fields() logrus.Fields {
+	return logrus.Fields{
+		"pass_processed": pr.Processed,
+		"pass_skipped":   pr.Skipped,
+		"pass_failed":    pr.Failed,
+		"pass_empty":     pr.Empty,
+		"pass_saved":     pr.Saved,
+		"pass_inserted":  pr.Inserted,
+		"pass_updated":   pr.Updated,
+		"pass_unchanged": pr.Unchanged,
+		"pass_aborted":   pr.Aborted,
+		"pass_duration":  pr.Duration.String(),
+	}
+}
@@ -0,0 +1,47 @@
+package downloaders
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dneprix/ohlc/pkg/candles"
+)
+
+func TestPassReport_add(t *testing.T) {
+	report := PassReport{}
+	report.add(outcomeSkipped, candles.SaveResult{})
+	report.add(outcomeFailed, candles.SaveResult{})
+	report.add(outcomeEmpty, candles.SaveResult{})
+	report.add(outcomeSaved, candles.SaveResult{Inserted: 2, Updated: 1})
+	report.add(outcomeSaved, candles.SaveResult{Unchanged: 3})
+
+	assert.Equal(t, PassReport{
+		Processed: 4,
+		Skipped:   1,
+		Failed:    1,
+		Empty:     1,
+		Saved:     2,
+		Inserted:  2,
+		Updated:   1,
+		Unchanged: 3,
+	}, report)
+}
+
+func TestPassReport_Fields(t *testing.T) {
+	report := PassReport{Processed: 2, Saved: 1, Failed: 1, Inserted: 5, Aborted: true, Duration: 1500 * time.Millisecond}
+	assert.Equal(t, logrus.Fields{
+		"pass_processed": 2,
+		"pass_skipped":   0,
+		"pass_failed":    1,
+		"pass_empty":     0,
+		"pass_saved":     1,
+		"pass_inserted":  5,
+		"pass_updated":   0,
+		"pass_unchanged": 0,
+		"pass_aborted":   true,
+		"pass_duration":  "1.5s",
+	}, report.Fields())
+}
@@ -0,0 +1,73 @@
+package limiters
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limiter of requests by key, e.g. API host or API key.
+// Callers with the same key share one token bucket and should use the same rate
+type Limiter interface {
+	// Wait for token of key bucket. Returns context error if context is done while waiting
+	Wait(ctx context.Context, key string, rate Rate) error
+}
+
+// Rate of token bucket. One token is added every Every duration up to Burst tokens.
+// Zero Every disables limiting
+type Rate struct {
+	Every time.Duration
+	Burst int
+}
+
+// Every rate with one token burst, e.g. Every(5 * time.Second) is one request per 5 sec
+func Every(interval time.Duration) Rate {
+	return Rate{Every: interval, Burst: 1}
+}
+
+// burst of rate. At least one token is available
+func (r Rate) burst() float64 {
+	if r.Burst < 1 {
+		return 1
+	}
+	return float64(r.Burst)
+}
+
+// String of rate, e.g. "1/5s burst 1"
+func (r Rate) String() string {
+	return fmt.Sprintf("1/%s burst %d", r.Every, int(r.burst()))
+}
+
+// ParseRate of sustained requests number per duration, e.g. "10/1m". Burst is 1
+func ParseRate(s string) (Rate, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return Rate{}, fmt.Errorf("Parse rate fail: %q", s)
+	}
+	n, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil || n == 0 {
+		return Rate{}, fmt.Errorf("Parse rate requests fail: %q", s)
+	}
+	d, err := time.ParseDuration(parts[1])
+	if err != nil || d <= 0 {
+		return Rate{}, fmt.Errorf("Parse rate duration fail: %q", s)
+	}
+	return Every(d / time.Duration(n)), nil
+}
+
+// sleep until wait is passed or context is done
+func sleep(ctx context.Context, wait time.Duration) error {
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,39 @@
+package limiters
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvery(t *testing.T) {
+	assert.Equal(t, Rate{Every: time.Second, Burst: 1}, Every(time.Second))
+}
+
+func TestRate_String(t *testing.T) {
+	assert.Equal(t, "1/5s burst 1", Every(5*time.Second).String())
+	assert.Equal(t, "1/1s burst 10", Rate{Every: time.Second, Burst: 10}.String())
+	assert.Equal(t, "1/1s burst 1", Rate{Every: time.Second}.String())
+}
+
+func TestParseRate(t *testing.T) {
+	rate, err := ParseRate("10/1m")
+	assert.NoError(t, err)
+	assert.Equal(t, Every(6*time.Second), rate)
+
+	rate, err = ParseRate("1/5s")
+	assert.NoError(t, err)
+	assert.Equal(t, Every(5*time.Second), rate)
+
+	_, err = ParseRate("5s")
+	assert.EqualError(t, err, `Parse rate fail: "5s"`)
+	_, err = ParseRate("0/1m")
+	assert.EqualError(t, err, `Parse rate requests fail: "0/1m"`)
+	_, err = ParseRate("x/1m")
+	assert.EqualError(t, err, `Parse rate requests fail: "x/1m"`)
+	_, err = ParseRate("10/m")
+	assert.EqualError(t, err, `Parse rate duration fail: "10/m"`)
+	_, err = ParseRate("10/-1m")
+	assert.EqualError(t, err, `Parse rate duration fail: "10/-1m"`)
+}
@@ -0,0 +1,74 @@
+package limiters
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// bucket of tokens. Negative tokens are reserved by waiting callers
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Memory limiter shares token buckets inside one process
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+// NewMemory constructor
+func NewMemory() *Memory {
+	return &Memory{
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+// Wait implements Limiter interface. Token is reserved immediately, so
+// callers are served in order of calls
+func (m *Memory) Wait(ctx context.Context, key string, rate Rate) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if rate.Every <= 0 {
+		return nil
+	}
+	if err := sleep(ctx, m.reserve(key, rate)); err != nil {
+		m.cancel(key)
+		return err
+	}
+	return nil
+}
+
+// reserve token and returns waiting time until it is available
+func (m *Memory) reserve(key string, rate Rate) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: rate.burst(), updated: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(rate.burst(), b.tokens+float64(now.Sub(b.updated))/float64(rate.Every))
+	b.updated = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens * float64(rate.Every))
+}
+
+// cancel reservation of token which was not used
+func (m *Memory) cancel(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if b, ok := m.buckets[key]; ok {
+		b.tokens++
+	}
+}
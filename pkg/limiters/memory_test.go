@@ -0,0 +1,76 @@
+package limiters
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory_reserve(t *testing.T) {
+	now := time.Unix(1569564000, 0)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	rate := Rate{Every: time.Second, Burst: 3}
+
+	// Burst is available immediately
+	assert.Equal(t, time.Duration(0), m.reserve("HOST", rate))
+	assert.Equal(t, time.Duration(0), m.reserve("HOST", rate))
+	assert.Equal(t, time.Duration(0), m.reserve("HOST", rate))
+
+	// Waiting callers reserve next tokens in order
+	assert.Equal(t, time.Second, m.reserve("HOST", rate))
+	assert.Equal(t, 2*time.Second, m.reserve("HOST", rate))
+
+	// Other key has own bucket
+	assert.Equal(t, time.Duration(0), m.reserve("OTHER_HOST", rate))
+
+	// Tokens are refilled by time
+	now = now.Add(2500 * time.Millisecond)
+	assert.Equal(t, 500*time.Millisecond, m.reserve("HOST", rate))
+
+	// Refill is limited by burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, time.Duration(0), m.reserve("HOST", rate))
+	}
+	assert.Equal(t, time.Second, m.reserve("HOST", rate))
+
+	// Cancelled reservation returns token
+	m.cancel("HOST")
+	assert.Equal(t, time.Second, m.reserve("HOST", rate))
+	m.cancel("UNKNOWN")
+}
+
+func TestMemory_Wait(t *testing.T) {
+	m := NewMemory()
+	rate := Every(10 * time.Millisecond)
+
+	start := time.Now()
+	assert.NoError(t, m.Wait(context.Background(), "HOST", rate))
+	assert.NoError(t, m.Wait(context.Background(), "HOST", rate))
+	assert.True(t, time.Since(start) >= 9*time.Millisecond)
+
+	// Zero rate is not limited
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, m.Wait(context.Background(), "HOST", Rate{}))
+	}
+}
+
+func TestMemory_WaitContextDone(t *testing.T) {
+	m := NewMemory()
+	rate := Every(time.Hour)
+	assert.NoError(t, m.Wait(context.Background(), "HOST", rate))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, m.Wait(ctx, "HOST", rate))
+
+	// Reservation of cancelled waiting is returned
+	m.now = func() time.Time { return time.Now().Add(time.Hour) }
+	assert.Equal(t, time.Duration(0), m.reserve("HOST", rate))
+
+	// Done context is not waiting
+	assert.Equal(t, context.DeadlineExceeded, m.Wait(ctx, "OTHER_HOST", rate))
+}
@@ -0,0 +1,54 @@
+package limiters
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Postgres limiter shares token buckets between service instances by rate_limits table.
+// DB clock is used for refilling, so instances clocks don't need to be synchronized
+type Postgres struct {
+	db *sqlx.DB
+}
+
+// NewPostgres constructor
+func NewPostgres(db *sqlx.DB) *Postgres {
+	return &Postgres{db: db}
+}
+
+// Wait implements Limiter interface. Token is reserved by one atomic statement
+func (p *Postgres) Wait(ctx context.Context, key string, rate Rate) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if rate.Every <= 0 {
+		return nil
+	}
+
+	tokens := 0.0
+	sqls := `INSERT INTO rate_limits(key, tokens, updated_at)
+      VALUES($1, $2 - 1, now())
+      ON CONFLICT (key) DO UPDATE SET
+        tokens = least($2, rate_limits.tokens + extract(epoch FROM now() - rate_limits.updated_at) / $3) - 1,
+        updated_at = now()
+      RETURNING tokens;
+      `
+	if err := p.db.GetContext(ctx, &tokens, sqls, key, rate.burst(), rate.Every.Seconds()); err != nil {
+		return fmt.Errorf("Reserve rate limit token fail: %s", err)
+	}
+	if tokens >= 0 {
+		return nil
+	}
+
+	if err := sleep(ctx, time.Duration(-tokens*float64(rate.Every))); err != nil {
+		// Context is done, so reservation is cancelled without it
+		if _, cancelErr := p.db.Exec(`UPDATE rate_limits SET tokens = tokens + 1 WHERE key=$1;`, key); cancelErr != nil {
+			return fmt.Errorf("Cancel rate limit token fail: %s", cancelErr)
+		}
+		return err
+	}
+	return nil
+}
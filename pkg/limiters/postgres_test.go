@@ -0,0 +1,87 @@
+package limiters
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPostgres(t *testing.T) (*Postgres, sqlmock.Sqlmock, func()) {
+	t.Helper()
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewPostgres(sqlx.NewDb(mockDB, "sqlmock")), mock, func() { mockDB.Close() }
+}
+
+func TestPostgres_Wait(t *testing.T) {
+	p, mock, closeDB := newTestPostgres(t)
+	defer closeDB()
+
+	mock.ExpectQuery("INSERT INTO rate_limits.+ON CONFLICT \\(key\\) DO UPDATE SET.+RETURNING tokens").
+		WithArgs("HOST", float64(3), float64(0.01)).
+		WillReturnRows(sqlmock.NewRows([]string{"tokens"}).AddRow(2))
+	mock.ExpectQuery("INSERT INTO rate_limits").
+		WithArgs("HOST", float64(3), float64(0.01)).
+		WillReturnRows(sqlmock.NewRows([]string{"tokens"}).AddRow(-1))
+
+	rate := Rate{Every: 10 * time.Millisecond, Burst: 3}
+	assert.NoError(t, p.Wait(context.Background(), "HOST", rate))
+
+	// Negative tokens are waited
+	start := time.Now()
+	assert.NoError(t, p.Wait(context.Background(), "HOST", rate))
+	assert.True(t, time.Since(start) >= 9*time.Millisecond)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Zero rate is not limited
+	assert.NoError(t, p.Wait(context.Background(), "HOST", Rate{}))
+}
+
+func TestPostgres_WaitContextDone(t *testing.T) {
+	p, mock, closeDB := newTestPostgres(t)
+	defer closeDB()
+
+	mock.ExpectQuery("INSERT INTO rate_limits").
+		WillReturnRows(sqlmock.NewRows([]string{"tokens"}).AddRow(-1))
+	mock.ExpectExec("UPDATE rate_limits SET tokens = tokens \\+ 1 WHERE key=\\$1").
+		WithArgs("HOST").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, p.Wait(ctx, "HOST", Every(time.Hour)))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Done context is not waiting
+	assert.Equal(t, context.DeadlineExceeded, p.Wait(ctx, "HOST", Every(time.Hour)))
+}
+
+func TestPostgres_WaitFail(t *testing.T) {
+	p, mock, closeDB := newTestPostgres(t)
+	defer closeDB()
+
+	mock.ExpectQuery("INSERT INTO rate_limits").WillReturnError(fmt.Errorf("DB error"))
+	err := p.Wait(context.Background(), "HOST", Every(time.Second))
+	assert.EqualError(t, err, "Reserve rate limit token fail: DB error")
+}
+
+func TestPostgres_WaitCancelFail(t *testing.T) {
+	p, mock, closeDB := newTestPostgres(t)
+	defer closeDB()
+
+	mock.ExpectQuery("INSERT INTO rate_limits").
+		WillReturnRows(sqlmock.NewRows([]string{"tokens"}).AddRow(-1))
+	mock.ExpectExec("UPDATE rate_limits").WillReturnError(fmt.Errorf("DB error"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	err := p.Wait(ctx, "HOST", Every(time.Hour))
+	assert.EqualError(t, err, "Cancel rate limit token fail: DB error")
+}
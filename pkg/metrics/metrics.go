@@ -0,0 +1,201 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ohlc"
+
+// Registry of service metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	// DownloadDuration of asset candles by downloader
+	DownloadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "download_duration_seconds",
+		Help:      "Duration of asset candles download.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"downloader", "asset"})
+
+	// DownloadFailures of asset candles
+	DownloadFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "download_failures_total",
+		Help:      "Number of failed asset candles downloads.",
+	}, []string{"downloader", "asset"})
+
+	// HTTPResponses of data sources by status code
+	HTTPResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_responses_total",
+		Help:      "Number of data source HTTP responses by status code.",
+	}, []string{"host", "code"})
+
+	// HTTPRetries of data source requests
+	HTTPRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_retries_total",
+		Help:      "Number of retried data source HTTP requests.",
+	}, []string{"host"})
+
+	// CandlesReceived from data sources
+	CandlesReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "candles_received_total",
+		Help:      "Number of downloaded candles.",
+	}, []string{"downloader", "asset"})
+
+	// CandlesSaved by outcome: inserted, updated or unchanged
+	CandlesSaved = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "candles_saved_total",
+		Help:      "Number of saved candles by outcome: inserted, updated or unchanged (duplicated).",
+	}, []string{"downloader", "asset", "outcome"})
+
+	// ValidationViolations of candles by rule and action
+	ValidationViolations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "validation_violations_total",
+		Help:      "Number of candles validation violations by rule and action.",
+	}, []string{"downloader", "asset", "rule", "action"})
+
+	// ValidationRejects of candles batches
+	ValidationRejects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "validation_rejects_total",
+		Help:      "Number of candles batches rejected by validation.",
+	}, []string{"downloader", "asset"})
+
+	// SaveFailures of candles batches
+	SaveFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "save_failures_total",
+		Help:      "Number of failed candles batch saves.",
+	}, []string{"downloader", "asset"})
+
+	// QueueFullSkips of scheduler pushes
+	QueueFullSkips = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_full_skips_total",
+		Help:      "Number of scheduler runs skipped because downloader queue is full.",
+	}, []string{"downloader"})
+
+	// WaitTimerBlocked time in CheckWaitTimer
+	WaitTimerBlocked = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "wait_timer_blocked_seconds_total",
+		Help:      "Time spent blocked waiting for downloader rate limit.",
+	}, []string{"downloader"})
+
+	// AllowanceRemaining of data source API budget
+	AllowanceRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "api_allowance_remaining",
+		Help:      "Remaining data source API allowance reported by the last response.",
+	}, []string{"downloader"})
+
+	// AllowanceCost of the last data source request
+	AllowanceCost = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "api_allowance_cost",
+		Help:      "Data source API allowance cost of the last request.",
+	}, []string{"downloader"})
+
+	// NewestCandles tracks close time of newest saved candle by asset and period
+	NewestCandles = newNewestCandlesCollector()
+)
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		DownloadDuration,
+		DownloadFailures,
+		HTTPResponses,
+		HTTPRetries,
+		CandlesReceived,
+		CandlesSaved,
+		ValidationViolations,
+		ValidationRejects,
+		SaveFailures,
+		QueueFullSkips,
+		WaitTimerBlocked,
+		AllowanceRemaining,
+		AllowanceCost,
+		NewestCandles,
+	)
+}
+
+// Handler exposes registry metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// newestCandlesKey of asset period
+type newestCandlesKey struct {
+	downloader string
+	asset      string
+	period     uint
+}
+
+// NewestCandlesCollector reports age of newest saved candle at scrape time
+type NewestCandlesCollector struct {
+	desc *prometheus.Desc
+	now  func() time.Time
+
+	mu         sync.Mutex
+	closeTimes map[newestCandlesKey]int64
+}
+
+func newNewestCandlesCollector() *NewestCandlesCollector {
+	return &NewestCandlesCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "newest_candle_age_seconds"),
+			"Age of newest saved candle close time.",
+			[]string{"downloader", "asset", "period"},
+			nil,
+		),
+		now:        time.Now,
+		closeTimes: map[newestCandlesKey]int64{},
+	}
+}
+
+// Observe close time of saved candle. Older close times and forming candle
+// with close time in the future are ignored, so age is never negative
+func (nc *NewestCandlesCollector) Observe(downloader, asset string, period uint, closeTime int64) {
+	if closeTime > nc.now().Unix() {
+		return
+	}
+	key := newestCandlesKey{downloader, asset, period}
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	if closeTime > nc.closeTimes[key] {
+		nc.closeTimes[key] = closeTime
+	}
+}
+
+// Describe implements prometheus.Collector interface
+func (nc *NewestCandlesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- nc.desc
+}
+
+// Collect implements prometheus.Collector interface
+func (nc *NewestCandlesCollector) Collect(ch chan<- prometheus.Metric) {
+	now := nc.now()
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	for key, closeTime := range nc.closeTimes {
+		age := now.Sub(time.Unix(closeTime, 0)).Seconds()
+		ch <- prometheus.MustNewConstMetric(
+			nc.desc, prometheus.GaugeValue, age,
+			key.downloader, key.asset, strconv.FormatUint(uint64(key.period), 10),
+		)
+	}
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewestCandlesCollector(t *testing.T) {
+	nc := newNewestCandlesCollector()
+	nc.now = func() time.Time { return time.Unix(1569564600, 0) }
+
+	nc.Observe("MOCK", "BTC/USD/MOCK", 60, 1569564000)
+	// Older close time is ignored
+	nc.Observe("MOCK", "BTC/USD/MOCK", 60, 1569563000)
+	nc.Observe("MOCK", "BTC/USD/MOCK", 3600, 1569564000)
+	nc.Observe("MOCK", "ETH/USD/MOCK", 60, 1569564540)
+	// Forming candle closes in the future
+	nc.Observe("MOCK", "ETH/USD/MOCK", 60, 1569564660)
+
+	expected := `
+# HELP ohlc_newest_candle_age_seconds Age of newest saved candle close time.
+# TYPE ohlc_newest_candle_age_seconds gauge
+ohlc_newest_candle_age_seconds{asset="BTC/USD/MOCK",downloader="MOCK",period="60"} 600
+ohlc_newest_candle_age_seconds{asset="BTC/USD/MOCK",downloader="MOCK",period="3600"} 600
+ohlc_newest_candle_age_seconds{asset="ETH/USD/MOCK",downloader="MOCK",period="60"} 60
+`
+	assert.NoError(t, testutil.CollectAndCompare(nc, strings.NewReader(expected)))
+}
+
+func TestNewestCandlesCollector_Empty(t *testing.T) {
+	nc := newNewestCandlesCollector()
+	assert.NoError(t, testutil.CollectAndCompare(nc, strings.NewReader("")))
+}
+
+func TestHandler(t *testing.T) {
+	QueueFullSkips.WithLabelValues("HANDLER").Inc()
+	assert.Equal(t, float64(1), testutil.ToFloat64(QueueFullSkips.WithLabelValues("HANDLER")))
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `ohlc_queue_full_skips_total{downloader="HANDLER"} 1`)
+	assert.Contains(t, w.Body.String(), "process_start_time_seconds")
+}
@@ -0,0 +1,160 @@
+package queries
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/dneprix/ohlc/pkg/candles"
+)
+
+// DefaultLimit of candles in one page
+const DefaultLimit = 500
+
+// MaxLimit of candles in one page
+const MaxLimit = 5000
+
+// CandlesQuery selects stored candles of asset period ordered by close time
+type CandlesQuery struct {
+	CoinFrom string
+	CoinTo   string
+	Exchange string
+	Period   uint
+	// From is the earliest close time (inclusive). Zero is not limited
+	From int64
+	// To is the latest close time (inclusive). Zero is not limited
+	To int64
+	// Limit of candles in page. Zero is DefaultLimit
+	Limit int
+	// Cursor from previous page
+	Cursor string
+}
+
+// CandlesPage is a page of candles. NextCursor is empty on the last page
+type CandlesPage struct {
+	Candles    []*candles.Candle `json:"candles"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+// EncodeCursor returns opaque cursor of page after close time
+func EncodeCursor(closeTime int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(closeTime, 10)))
+}
+
+// DecodeCursor returns close time of cursor
+func DecodeCursor(cursor string) (int64, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, fmt.Errorf("Parse cursor fail: %q", cursor)
+	}
+	closeTime, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Parse cursor fail: %q", cursor)
+	}
+	return closeTime, nil
+}
+
+// Candles returns page of candles selected by query
+func Candles(ctx context.Context, db *sqlx.DB, q CandlesQuery) (*CandlesPage, error) {
+	if q.CoinFrom == "" || q.CoinTo == "" || q.Exchange == "" {
+		return nil, fmt.Errorf("Asset coin_from, coin_to and exchange are required")
+	}
+	if q.Period == 0 {
+		return nil, fmt.Errorf("Period is required")
+	}
+	limit := q.Limit
+	switch {
+	case limit == 0:
+		limit = DefaultLimit
+	case limit < 0 || limit > MaxLimit:
+		return nil, fmt.Errorf("Limit is out of range 1..%d: %d", MaxLimit, limit)
+	}
+
+	conditions := []string{
+		"a.coin_from = $1",
+		"a.coin_to = $2",
+		"a.exchange = $3",
+		"c.period = $4",
+	}
+	args := []interface{}{q.CoinFrom, q.CoinTo, q.Exchange, q.Period}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if q.From != 0 {
+		addCondition("c.close_time >= to_timestamp($%d)", q.From)
+	}
+	if q.To != 0 {
+		addCondition("c.close_time <= to_timestamp($%d)", q.To)
+	}
+	if q.Cursor != "" {
+		after, err := DecodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		addCondition("c.close_time > to_timestamp($%d)", after)
+	}
+	// One more candle shows that next page exists
+	args = append(args, limit+1)
+
+	sqls := `SELECT
+        c.id,
+        c.asset_id,
+        c.period,
+        extract(epoch FROM c.close_time::timestamptz)::bigint AS close_time,
+        c.open_price,
+        c.high_price,
+        c.low_price,
+        c.close_price,
+        c.volume,
+        c.derived
+      FROM candles c
+      JOIN assets a ON a.id = c.asset_id
+      WHERE ` + strings.Join(conditions, " AND ") + `
+      ORDER BY c.close_time
+      LIMIT $` + strconv.Itoa(len(args)) + `;
+      `
+	candlesData := []*candles.Candle{}
+	if err := db.SelectContext(ctx, &candlesData, sqls, args...); err != nil {
+		return nil, err
+	}
+
+	page := &CandlesPage{Candles: candlesData}
+	if len(candlesData) > limit {
+		page.Candles = candlesData[:limit]
+		page.NextCursor = EncodeCursor(page.Candles[limit-1].CloseTime)
+	}
+	return page, nil
+}
+
+// LastCandles returns up to limit latest stored candles of asset period ordered by close time
+func LastCandles(ctx context.Context, db *sqlx.DB, assetID, period uint, limit int) ([]*candles.Candle, error) {
+	sqls := `SELECT
+        id,
+        asset_id,
+        period,
+        extract(epoch FROM close_time::timestamptz)::bigint AS close_time,
+        open_price,
+        high_price,
+        low_price,
+        close_price,
+        volume,
+        derived
+      FROM candles
+      WHERE asset_id=$1 AND period=$2
+      ORDER BY close_time DESC
+      LIMIT $3;
+      `
+	candlesData := []*candles.Candle{}
+	if err := db.SelectContext(ctx, &candlesData, sqls, assetID, period, limit); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(candlesData)-1; i < j; i, j = i+1, j-1 {
+		candlesData[i], candlesData[j] = candlesData[j], candlesData[i]
+	}
+	return candlesData, nil
+}
@@ -0,0 +1,142 @@
+package queries
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dneprix/ohlc/pkg/candles"
+)
+
+var candlesColumns = []string{"id", "asset_id", "period", "close_time", "open_price", "high_price", "low_price", "close_price", "volume", "derived"}
+
+func TestCursor(t *testing.T) {
+	cursor := EncodeCursor(1569563400)
+	actual, err := DecodeCursor(cursor)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1569563400), actual)
+
+	_, err = DecodeCursor("%")
+	assert.EqualError(t, err, `Parse cursor fail: "%"`)
+
+	_, err = DecodeCursor("YWJj")
+	assert.EqualError(t, err, `Parse cursor fail: "YWJj"`)
+}
+
+func TestCandlesSuccess(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	mock.ExpectQuery(
+		"SELECT .+ extract\\(epoch FROM c.close_time::timestamptz\\)::bigint AS close_time, .+ FROM candles c JOIN assets a ON a.id = c.asset_id "+
+			"WHERE a.coin_from = \\$1 AND a.coin_to = \\$2 AND a.exchange = \\$3 AND c.period = \\$4 "+
+			"AND c.close_time >= to_timestamp\\(\\$5\\) AND c.close_time <= to_timestamp\\(\\$6\\) AND c.close_time > to_timestamp\\(\\$7\\) "+
+			"ORDER BY c.close_time LIMIT \\$8",
+	).WithArgs("BTC", "USD", "KRAKEN", 60, 1569560400, 1569564000, 1569563340, 3).
+		WillReturnRows(sqlmock.NewRows(candlesColumns).
+			AddRow(1, 1, 60, 1569563400, "1.0", "2.0", "0.5", "1.5", "10", false).
+			AddRow(2, 1, 60, 1569563460, "1.5", "2.0", "1.5", "2.0", "11", false).
+			AddRow(3, 1, 60, 1569563520, "2.0", "2.0", "2.0", "2.0", "12", false))
+
+	actual, err := Candles(context.Background(), sqlxDB, CandlesQuery{
+		CoinFrom: "BTC",
+		CoinTo:   "USD",
+		Exchange: "KRAKEN",
+		Period:   60,
+		From:     1569560400,
+		To:       1569564000,
+		Limit:    2,
+		Cursor:   EncodeCursor(1569563340),
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, actual.Candles, 2)
+	assert.Equal(t, int64(1569563460), actual.Candles[1].CloseTime)
+	assert.Equal(t, candles.MustParseDecimal("1.5"), actual.Candles[1].OpenPrice)
+	assert.Equal(t, EncodeCursor(1569563460), actual.NextCursor)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCandlesLastPage(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	mock.ExpectQuery(
+		"SELECT .+ WHERE a.coin_from = \\$1 AND a.coin_to = \\$2 AND a.exchange = \\$3 AND c.period = \\$4 ORDER BY c.close_time LIMIT \\$5",
+	).WithArgs("BTC", "USD", "KRAKEN", 60, DefaultLimit+1).
+		WillReturnRows(sqlmock.NewRows(candlesColumns).
+			AddRow(1, 1, 60, 1569563400, "1.0", "2.0", "0.5", "1.5", "10", false))
+
+	actual, err := Candles(context.Background(), sqlxDB, CandlesQuery{CoinFrom: "BTC", CoinTo: "USD", Exchange: "KRAKEN", Period: 60})
+
+	assert.NoError(t, err)
+	assert.Len(t, actual.Candles, 1)
+	assert.Empty(t, actual.NextCursor)
+}
+
+func TestCandlesFail(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	for _, tt := range []struct {
+		query    CandlesQuery
+		expected string
+	}{
+		{CandlesQuery{CoinFrom: "BTC", Period: 60}, "Asset coin_from, coin_to and exchange are required"},
+		{CandlesQuery{CoinFrom: "BTC", CoinTo: "USD", Exchange: "KRAKEN"}, "Period is required"},
+		{CandlesQuery{CoinFrom: "BTC", CoinTo: "USD", Exchange: "KRAKEN", Period: 60, Limit: MaxLimit + 1}, "Limit is out of range 1..5000: 5001"},
+		{CandlesQuery{CoinFrom: "BTC", CoinTo: "USD", Exchange: "KRAKEN", Period: 60, Cursor: "%"}, `Parse cursor fail: "%"`},
+	} {
+		actual, err := Candles(context.Background(), sqlxDB, tt.query)
+		assert.Nil(t, actual)
+		assert.EqualError(t, err, tt.expected)
+	}
+
+	expectedError := fmt.Errorf("DB error")
+	mock.ExpectQuery("SELECT").WillReturnError(expectedError)
+	actual, err := Candles(context.Background(), sqlxDB, CandlesQuery{CoinFrom: "BTC", CoinTo: "USD", Exchange: "KRAKEN", Period: 60})
+	assert.Nil(t, actual)
+	assert.EqualError(t, err, expectedError.Error())
+}
+
+func TestLastCandlesSuccess(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	mock.ExpectQuery("SELECT .+ extract\\(epoch FROM close_time::timestamptz\\)::bigint AS close_time, .+ FROM candles WHERE asset_id=\\$1 AND period=\\$2 ORDER BY close_time DESC LIMIT \\$3").
+		WithArgs(1, 60, 2).
+		WillReturnRows(sqlmock.NewRows(candlesColumns).
+			AddRow(2, 1, 60, 1569563460, "1", "1", "1", "1", "1", false).
+			AddRow(1, 1, 60, 1569563400, "1", "1", "1", "1", "1", false))
+
+	actual, err := LastCandles(context.Background(), sqlxDB, 1, 60, 2)
+
+	assert.NoError(t, err)
+	assert.Len(t, actual, 2)
+	assert.Equal(t, int64(1569563400), actual[0].CloseTime)
+	assert.Equal(t, int64(1569563460), actual[1].CloseTime)
+}
+
+func TestLastCandlesFail(t *testing.T) {
+	mockDB, mock, _ := sqlmock.New()
+	defer mockDB.Close()
+	sqlxDB := sqlx.NewDb(mockDB, "sqlmock")
+
+	expectedError := fmt.Errorf("DB error")
+	mock.ExpectQuery("SELECT").WillReturnError(expectedError)
+
+	actual, err := LastCandles(context.Background(), sqlxDB, 1, 60, 2)
+
+	assert.Nil(t, actual)
+	assert.EqualError(t, err, expectedError.Error())
+}
@@ -0,0 +1,48 @@
+package schedulers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// cronParser accepts expressions with optional seconds field and descriptors like @daily
+var cronParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// Schedule describes when downloader should be pushed
+type Schedule interface {
+	// Next activation time later than given time
+	Next(time.Time) time.Time
+}
+
+// intervalSchedule activates with constant interval
+type intervalSchedule time.Duration
+
+// Every returns schedule with constant interval between activations.
+// Non-positive interval is replaced by one minute
+func Every(interval time.Duration) Schedule {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return intervalSchedule(interval)
+}
+
+// Next activation time
+func (is intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(is))
+}
+
+// ParseCron returns wall-clock aligned schedule for cron expression.
+// Seconds field is optional and timezone is set by CRON_TZ prefix, e.g.
+// "5 * * * * *" runs every minute at second 5 and
+// "CRON_TZ=UTC 0 2 0 * * *" runs daily at 00:02 UTC
+func ParseCron(spec string) (Schedule, error) {
+	schedule, err := cronParser.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("Parse cron expression fail: %s", err)
+	}
+	return schedule, nil
+}
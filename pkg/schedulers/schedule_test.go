@@ -0,0 +1,50 @@
+package schedulers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvery(t *testing.T) {
+	now := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, now.Add(time.Hour), Every(time.Hour).Next(now))
+	assert.Equal(t, now.Add(time.Minute), Every(0).Next(now))
+	assert.Equal(t, now.Add(time.Minute), Every(-time.Hour).Next(now))
+}
+
+func TestParseCron(t *testing.T) {
+	now := time.Date(2019, 10, 1, 10, 30, 7, 0, time.UTC)
+
+	schedule, err := ParseCron("5 * * * * *")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2019, 10, 1, 10, 31, 5, 0, time.UTC), schedule.Next(now))
+
+	schedule, err = ParseCron("CRON_TZ=UTC 0 2 0 * * *")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2019, 10, 2, 0, 2, 0, 0, time.UTC), schedule.Next(now).UTC())
+
+	schedule, err = ParseCron("CRON_TZ=Europe/Kiev 0 0 3 * * *")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2019, 10, 2, 0, 0, 0, 0, time.UTC), schedule.Next(now).UTC())
+
+	schedule, err = ParseCron("*/15 * * * *")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2019, 10, 1, 10, 45, 0, 0, time.UTC), schedule.Next(now).UTC())
+
+	schedule, err = ParseCron("@hourly")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2019, 10, 1, 11, 0, 0, 0, time.UTC), schedule.Next(now).UTC())
+}
+
+func TestParseCronFail(t *testing.T) {
+	schedule, err := ParseCron("every minute")
+	assert.Nil(t, schedule)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Parse cron expression fail")
+
+	schedule, err = ParseCron("CRON_TZ=Mars/Olympus 0 * * * * *")
+	assert.Nil(t, schedule)
+	assert.Error(t, err)
+}
@@ -1,58 +1,180 @@
 package schedulers
 
 import (
+	"context"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/dneprix/ohlc/pkg/downloaders"
+	"github.com/dneprix/ohlc/pkg/metrics"
 )
 
-var timerDuration = time.Minute
-
 // Scheduler structure
 type Scheduler struct {
-	downloaders []downloaders.Downloader
-	logger      *logrus.Logger
-	stop        chan (bool)
+	entries []*entry
+	logger  *logrus.Logger
+	stop    chan (bool)
+
+	// ctx is cancelled to abort running downloads
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// mu guards stopped flag and start of queue goroutines
+	mu      sync.Mutex
+	stopped bool
+	queues  sync.WaitGroup
+}
+
+// entry is a scheduled downloader with its next run time
+type entry struct {
+	downloader downloaders.Downloader
+	schedule   Schedule
+	next       time.Time
 }
 
 // NewSheduler constructor
 func NewSheduler(logger *logrus.Logger) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Scheduler{
 		logger: logger,
 		stop:   make(chan (bool)),
+		ctx:    ctx,
+		cancel: cancel,
 	}
 }
 
-// Add downloader to scheduler
+// Add downloader to scheduler with downloader interval
 func (s *Scheduler) Add(d downloaders.Downloader) {
-	s.downloaders = append(s.downloaders, d)
+	s.AddWithSchedule(d, Every(d.Interval()))
+}
+
+// AddWithSchedule adds downloader to scheduler with custom schedule
+func (s *Scheduler) AddWithSchedule(d downloaders.Downloader, schedule Schedule) {
+	s.entries = append(s.entries, &entry{
+		downloader: d,
+		schedule:   schedule,
+	})
 }
 
-// Run scheduler
+// Run scheduler. Blocks until Shutdown is called
 func (s *Scheduler) Run() {
 	s.logger.Info("Run Scheduler")
 
 	// Start processing downloaders queues
-	for _, d := range s.downloaders {
-		go downloaders.ProcessQueue(d)
-	}
-
-	// Push each downloader queue by timer
-	// Only 1 slot available for waiting in queue. Skip if queue is full
-	for range time.Tick(timerDuration) {
-		s.logger.Info("Run All Downloaders")
-		for _, d := range s.downloaders {
-			select {
-			case d.Queue() <- true:
-				d.Logger().Debugf("Add to downloader queue: size=%d", len(d.Queue()))
-			case <-s.stop:
-				d.Logger().Warn("Stop scheduler")
-				return
-			default:
-				d.Logger().Warnf("Skip adding. Downloader queue is full: size=%d", len(d.Queue()))
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	for _, e := range s.entries {
+		s.queues.Add(1)
+		go func(d downloaders.Downloader) {
+			defer s.queues.Done()
+			downloaders.ProcessQueue(s.ctx, d)
+		}(e.downloader)
+	}
+	s.mu.Unlock()
+
+	now := time.Now()
+	for _, e := range s.entries {
+		e.next = e.schedule.Next(now)
+		if e.next.IsZero() {
+			e.downloader.Logger().Error("Schedule has no next run. Downloader will not run")
+			continue
+		}
+		e.downloader.Logger().Infof("Next run: %s", e.next.Format(time.RFC3339))
+	}
+
+	// Push each downloader queue by its schedule
+	for {
+		timer := time.NewTimer(s.nextRun().Sub(time.Now()))
+		select {
+		case <-s.stop:
+			timer.Stop()
+			s.logger.Warn("Stop scheduler")
+			return
+		case now := <-timer.C:
+			for _, e := range s.entries {
+				if e.next.IsZero() || e.next.After(now) {
+					continue
+				}
+				s.push(e.downloader)
+
+				// Skip activations which were missed
+				next := e.schedule.Next(e.next)
+				if !next.After(now) {
+					next = e.schedule.Next(now)
+				}
+				e.next = next
+				e.downloader.Logger().Debugf("Next run: %s", e.next.Format(time.RFC3339))
 			}
 		}
 	}
 }
+
+// nextRun is the earliest next run time of downloaders
+func (s *Scheduler) nextRun() time.Time {
+	next := time.Time{}
+	for _, e := range s.entries {
+		if e.next.IsZero() {
+			continue
+		}
+		if next.IsZero() || e.next.Before(next) {
+			next = e.next
+		}
+	}
+	if next.IsZero() {
+		// Nothing to run, only wait for stop
+		return time.Now().Add(time.Hour)
+	}
+	return next
+}
+
+// push downloader queue.
+// Only 1 slot available for waiting in queue. Skip if queue is full
+func (s *Scheduler) push(d downloaders.Downloader) {
+	select {
+	case d.Queue() <- true:
+		d.Logger().Debugf("Add to downloader queue: size=%d", len(d.Queue()))
+	default:
+		metrics.QueueFullSkips.WithLabelValues(d.Name()).Inc()
+		d.Logger().Warnf("Skip adding. Downloader queue is full: size=%d", len(d.Queue()))
+	}
+}
+
+// Shutdown stops scheduling, signals every downloader to stop and waits
+// for in-flight downloads to finish. Running downloads are aborted when
+// context is done and context error is returned
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	s.logger.Warn("Shutdown Scheduler")
+
+	s.mu.Lock()
+	if !s.stopped {
+		s.stopped = true
+		close(s.stop)
+		for _, e := range s.entries {
+			close(e.downloader.Stop())
+		}
+	}
+	s.mu.Unlock()
+
+	done := make(chan (bool))
+	go func() {
+		s.queues.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.logger.Info("All downloaders are stopped")
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.logger.Errorf("Abort running downloaders: %s", ctx.Err())
+		s.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
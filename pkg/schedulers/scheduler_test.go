@@ -1,10 +1,13 @@
 package schedulers
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/dneprix/ohlc/pkg/downloaders"
+	"github.com/jmoiron/sqlx"
 	"github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
@@ -12,9 +15,25 @@ import (
 
 type mockDownloader struct {
 	downloaders.Downloader
-	queue  chan (bool)
-	stop   chan (bool)
-	logger *logrus.Entry
+	queue    chan (bool)
+	stop     chan (bool)
+	logger   *logrus.Entry
+	db       *sqlx.DB
+	interval time.Duration
+
+	heartbeat downloaders.Heartbeat
+}
+
+func (m *mockDownloader) Interval() time.Duration {
+	return m.interval
+}
+
+func (m *mockDownloader) Name() string {
+	return "MOCK"
+}
+
+func (m *mockDownloader) DB() *sqlx.DB {
+	return m.db
 }
 
 func (m *mockDownloader) Queue() chan (bool) {
@@ -29,42 +48,192 @@ func (m *mockDownloader) Stop() chan (bool) {
 	return m.stop
 }
 
+func (m *mockDownloader) Heartbeat() *downloaders.Heartbeat {
+	return &m.heartbeat
+}
+
 func TestNewSheduler(t *testing.T) {
 	logger, _ := test.NewNullLogger()
 	s := NewSheduler(logger)
-	assert.Len(t, s.downloaders, 0)
+	assert.Len(t, s.entries, 0)
 	assert.NotNil(t, s.logger)
 	assert.Equal(t, s.logger, logger)
 }
 
 func TestScheduler_Add(t *testing.T) {
 	s := &Scheduler{}
-	assert.Len(t, s.downloaders, 0)
-	s.Add(&mockDownloader{})
-	assert.Len(t, s.downloaders, 1)
-	s.Add(&mockDownloader{})
-	assert.Len(t, s.downloaders, 2)
+	assert.Len(t, s.entries, 0)
+	s.Add(&mockDownloader{interval: time.Hour})
+	assert.Len(t, s.entries, 1)
+	assert.Equal(t, Every(time.Hour), s.entries[0].schedule)
+	s.Add(&mockDownloader{interval: time.Minute})
+	assert.Len(t, s.entries, 2)
+	assert.Equal(t, Every(time.Minute), s.entries[1].schedule)
+}
+
+func TestScheduler_AddWithSchedule(t *testing.T) {
+	s := &Scheduler{}
+	d := &mockDownloader{interval: time.Hour}
+	s.AddWithSchedule(d, Every(time.Second))
+	assert.Len(t, s.entries, 1)
+	assert.Equal(t, d, s.entries[0].downloader)
+	assert.Equal(t, Every(time.Second), s.entries[0].schedule)
 }
 
 func TestScheduler_Run(t *testing.T) {
 	logger, _ := test.NewNullLogger()
+	mockDB, _, _ := sqlmock.New()
+	defer mockDB.Close()
+	db := sqlx.NewDb(mockDB, "sqlmock")
+
 	s := &Scheduler{
 		logger: logger,
 		stop:   make(chan (bool)),
-		downloaders: []downloaders.Downloader{
-			&mockDownloader{
-				queue:  make(chan (bool), 1),
-				logger: logrus.NewEntry(logger),
-				stop:   make(chan (bool)),
-			},
+		ctx:    context.Background(),
+	}
+	fast := &mockDownloader{
+		queue:    make(chan (bool), 1),
+		logger:   logrus.NewEntry(logger),
+		stop:     make(chan (bool)),
+		db:       db,
+		interval: time.Millisecond,
+	}
+	slow := &mockDownloader{
+		queue:    make(chan (bool), 1),
+		logger:   logrus.NewEntry(logger),
+		stop:     make(chan (bool)),
+		db:       db,
+		interval: time.Hour,
+	}
+	s.Add(fast)
+	s.Add(slow)
+
+	close(fast.Stop())
+	close(slow.Stop())
+	go func() {
+		<-time.After(20 * time.Millisecond)
+		close(s.stop)
+	}()
+	s.Run()
+
+	assert.Len(t, fast.Queue(), 1)
+	assert.Len(t, slow.Queue(), 0)
+	assert.True(t, s.entries[0].next.After(time.Now().Add(-time.Second)))
+	assert.True(t, s.entries[1].next.After(time.Now().Add(time.Minute)))
+}
+
+func TestScheduler_RunWithoutDownloaders(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	s := NewSheduler(logger)
+	go func() {
+		<-time.After(time.Millisecond)
+		s.Shutdown(context.Background())
+	}()
+	s.Run()
+}
+
+func TestScheduler_nextRun(t *testing.T) {
+	now := time.Now()
+	s := &Scheduler{
+		entries: []*entry{
+			{next: now.Add(time.Hour)},
+			{next: time.Time{}},
+			{next: now.Add(time.Second)},
+			{next: now.Add(time.Minute)},
 		},
 	}
+	assert.Equal(t, now.Add(time.Second), s.nextRun())
+
+	// Schedules without next run are ignored
+	s = &Scheduler{entries: []*entry{{next: time.Time{}}}}
+	assert.True(t, s.nextRun().After(now.Add(time.Minute)))
+}
+
+func TestScheduler_RunNeverSchedule(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	mockDB, _, _ := sqlmock.New()
+	defer mockDB.Close()
+
+	s := NewSheduler(logger)
+	d := &mockDownloader{
+		queue:  make(chan (bool), 1),
+		logger: logrus.NewEntry(logger),
+		stop:   make(chan (bool)),
+		db:     sqlx.NewDb(mockDB, "sqlmock"),
+	}
+	schedule, err := ParseCron("0 0 0 30 2 *")
+	assert.NoError(t, err)
+	s.AddWithSchedule(d, schedule)
 
-	close(s.downloaders[0].Stop())
 	go func() {
 		<-time.After(10 * time.Millisecond)
-		close(s.stop)
+		s.Shutdown(context.Background())
+	}()
+	s.Run()
+	assert.True(t, s.entries[0].next.IsZero())
+	assert.Len(t, d.Queue(), 0)
+}
+
+func TestScheduler_Shutdown(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	s := NewSheduler(logger)
+	mockDB, _, _ := sqlmock.New()
+	defer mockDB.Close()
+	d := &mockDownloader{
+		queue:    make(chan (bool), 1),
+		logger:   logrus.NewEntry(logger),
+		stop:     make(chan (bool)),
+		db:       sqlx.NewDb(mockDB, "sqlmock"),
+		interval: time.Millisecond,
+	}
+	s.Add(d)
+
+	runDone := make(chan (bool))
+	go func() {
+		s.Run()
+		close(runDone)
 	}()
-	timerDuration = time.Millisecond
+
+	<-time.After(10 * time.Millisecond)
+	err := s.Shutdown(context.Background())
+	assert.NoError(t, err)
+
+	select {
+	case <-runDone:
+	case <-time.After(time.Second):
+		t.Fatal("Run was not stopped")
+	}
+	_, open := <-d.Stop()
+	assert.False(t, open)
+
+	// Repeated shutdown is allowed
+	assert.NoError(t, s.Shutdown(context.Background()))
+}
+
+func TestScheduler_ShutdownTimeout(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	s := NewSheduler(logger)
+
+	// Simulate queue goroutine which is processing until abort
+	s.queues.Add(1)
+	aborted := false
+	go func() {
+		defer s.queues.Done()
+		<-s.ctx.Done()
+		aborted = true
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	err := s.Shutdown(ctx)
+	assert.Error(t, err)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, aborted)
+}
+
+func TestScheduler_RunAfterShutdown(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	s := NewSheduler(logger)
+	assert.NoError(t, s.Shutdown(context.Background()))
 	s.Run()
 }
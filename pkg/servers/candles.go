@@ -0,0 +1,92 @@
+package servers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/dneprix/ohlc/pkg/queries"
+)
+
+// handleCandles returns page of stored candles, e.g.
+// GET /candles?coin_from=BTC&coin_to=USD&exchange=KRAKEN&period=60&from=2019-09-27T00:00:00Z&limit=100
+func (s *Server) handleCandles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		s.writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method is not allowed: %s", r.Method))
+		return
+	}
+
+	q, err := parseCandlesQuery(r.URL.Query())
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := queries.Candles(r.Context(), s.db, q)
+	if err != nil {
+		s.logger.Errorf("Query candles fail: %s", err)
+		s.writeError(w, http.StatusInternalServerError, fmt.Errorf("Query candles fail"))
+		return
+	}
+	s.writeJSON(w, http.StatusOK, page)
+}
+
+// parseCandlesQuery from request params
+func parseCandlesQuery(params url.Values) (queries.CandlesQuery, error) {
+	q := queries.CandlesQuery{
+		CoinFrom: params.Get("coin_from"),
+		CoinTo:   params.Get("coin_to"),
+		Exchange: params.Get("exchange"),
+		Cursor:   params.Get("cursor"),
+	}
+	if q.CoinFrom == "" || q.CoinTo == "" || q.Exchange == "" {
+		return q, fmt.Errorf("Params coin_from, coin_to and exchange are required")
+	}
+
+	period, err := strconv.ParseUint(params.Get("period"), 10, 32)
+	if err != nil || period == 0 {
+		return q, fmt.Errorf("Param period must be positive number of seconds: %q", params.Get("period"))
+	}
+	q.Period = uint(period)
+
+	if q.From, err = parseTimeParam(params, "from"); err != nil {
+		return q, err
+	}
+	if q.To, err = parseTimeParam(params, "to"); err != nil {
+		return q, err
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > queries.MaxLimit {
+			return q, fmt.Errorf("Param limit must be in range 1..%d: %q", queries.MaxLimit, limit)
+		}
+		q.Limit = n
+	}
+
+	if q.Cursor != "" {
+		if _, err := queries.DecodeCursor(q.Cursor); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// parseTimeParam from unix seconds or RFC3339 time. Empty param is zero
+func parseTimeParam(params url.Values, name string) (int64, error) {
+	value := params.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return unix, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, fmt.Errorf("Param %s must be unix seconds or RFC3339 time: %q", name, value)
+	}
+	return t.Unix(), nil
+}
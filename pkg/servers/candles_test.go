@@ -0,0 +1,106 @@
+package servers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dneprix/ohlc/pkg/queries"
+)
+
+func newTestServer(t *testing.T) (*Server, sqlmock.Sqlmock, func()) {
+	t.Helper()
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger, _ := test.NewNullLogger()
+	return NewServer(":0", sqlx.NewDb(mockDB, "sqlmock"), logger), mock, func() { mockDB.Close() }
+}
+
+func TestServer_handleCandlesSuccess(t *testing.T) {
+	s, mock, closeDB := newTestServer(t)
+	defer closeDB()
+
+	mock.ExpectQuery("SELECT .+ FROM candles").
+		WithArgs("BTC", "USD", "KRAKEN", 60, 1569542400, 1569564000, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "asset_id", "period", "close_time", "open_price", "high_price", "low_price", "close_price", "volume", "derived"}).
+			AddRow(1, 1, 60, 1569563400, "7937.2", "7940.10", "7930.5", "7937.6", "0.00839492", false).
+			AddRow(2, 1, 60, 1569563460, "7937.6", "7937.6", "7937.6", "7937.6", "0", false))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/candles?coin_from=BTC&coin_to=USD&exchange=KRAKEN&period=60&from=2019-09-27T00:00:00Z&to=1569564000&limit=1", nil)
+	s.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+      "candles": [{
+        "id": 1,
+        "asset_id": 1,
+        "period": 60,
+        "close_time": 1569563400,
+        "open_price": "7937.2",
+        "high_price": "7940.10",
+        "low_price": "7930.5",
+        "close_price": "7937.6",
+        "volume": "0.00839492",
+        "derived": false
+      }],
+      "next_cursor": "`+queries.EncodeCursor(1569563400)+`"
+    }`, w.Body.String())
+}
+
+func TestServer_handleCandlesBadRequest(t *testing.T) {
+	s, _, closeDB := newTestServer(t)
+	defer closeDB()
+
+	for query, expected := range map[string]string{
+		"":                      "Params coin_from, coin_to and exchange are required",
+		"&period=x":             `Param period must be positive number of seconds: "x"`,
+		"&period=60&from=x":     `Param from must be unix seconds or RFC3339 time: "x"`,
+		"&period=60&to=x":       `Param to must be unix seconds or RFC3339 time: "x"`,
+		"&period=60&limit=0":    `Param limit must be in range 1..5000: "0"`,
+		"&period=60&cursor=%25": `Parse cursor fail: "%"`,
+	} {
+		w := httptest.NewRecorder()
+		url := "/candles?coin_from=BTC&coin_to=USD&exchange=KRAKEN" + query
+		if query == "" {
+			url = "/candles"
+		}
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		assert.JSONEq(t, fmt.Sprintf(`{"error": %q}`, expected), w.Body.String(), query)
+	}
+}
+
+func TestServer_handleCandlesFailQuery(t *testing.T) {
+	s, mock, closeDB := newTestServer(t)
+	defer closeDB()
+
+	mock.ExpectQuery("SELECT").WillReturnError(fmt.Errorf("DB error"))
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/candles?coin_from=BTC&coin_to=USD&exchange=KRAKEN&period=60", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"error": "Query candles fail"}`, w.Body.String())
+}
+
+func TestServer_handleCandlesMethodNotAllowed(t *testing.T) {
+	s, _, closeDB := newTestServer(t)
+	defer closeDB()
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/candles", nil))
+
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, http.MethodGet, w.Header().Get("Allow"))
+}
@@ -0,0 +1,50 @@
+package servers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/dneprix/ohlc/pkg/watchdogs"
+)
+
+// freshnessResponse is a JSON body of freshness status
+type freshnessResponse struct {
+	CheckedAt int64              `json:"checked_at"`
+	Stale     int                `json:"stale"`
+	Assets    []watchdogs.Status `json:"assets"`
+}
+
+// handleFreshness returns statuses of the last watchdog check.
+// Status is 503 if any asset period is stale or there was no check yet
+func (s *Server) handleFreshness(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		s.writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method is not allowed: %s", r.Method))
+		return
+	}
+	if s.watchdog == nil {
+		s.writeError(w, http.StatusNotFound, fmt.Errorf("Watchdog is disabled"))
+		return
+	}
+
+	statuses, checkedAt := s.watchdog.Statuses()
+	if checkedAt.IsZero() {
+		s.writeError(w, http.StatusServiceUnavailable, fmt.Errorf("Freshness is not checked yet"))
+		return
+	}
+
+	res := freshnessResponse{
+		CheckedAt: checkedAt.Unix(),
+		Assets:    statuses,
+	}
+	for _, status := range statuses {
+		if status.Stale {
+			res.Stale++
+		}
+	}
+	code := http.StatusOK
+	if res.Stale > 0 {
+		code = http.StatusServiceUnavailable
+	}
+	s.writeJSON(w, code, res)
+}
@@ -0,0 +1,87 @@
+package servers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dneprix/ohlc/pkg/watchdogs"
+)
+
+func newTestWatchdog(t *testing.T, s *Server, mock sqlmock.Sqlmock, closeTimes ...int64) {
+	logger, _ := test.NewNullLogger()
+	w := watchdogs.NewWatchdog(s.db, logger, time.Minute)
+	rows := sqlmock.NewRows([]string{"asset_id", "coin_from", "coin_to", "exchange", "period", "close_time"})
+	for i, closeTime := range closeTimes {
+		rows.AddRow(i+1, "BTC", "USD", "KRAKEN", 60, closeTime)
+	}
+	mock.ExpectQuery("SELECT .+ FROM assets").WillReturnRows(rows)
+	assert.NoError(t, w.Check(context.Background()))
+	s.SetWatchdog(w)
+}
+
+func TestServer_handleFreshness(t *testing.T) {
+	s, mock, closeDB := newTestServer(t)
+	defer closeDB()
+	newTestWatchdog(t, s, mock, time.Now().Unix())
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/freshness", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"stale":0`)
+	assert.Contains(t, w.Body.String(), `"coin_from":"BTC"`)
+}
+
+func TestServer_handleFreshnessStale(t *testing.T) {
+	s, mock, closeDB := newTestServer(t)
+	defer closeDB()
+	newTestWatchdog(t, s, mock, time.Now().Unix(), 1569563400)
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/freshness", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), `"stale":1`)
+}
+
+func TestServer_handleFreshnessNotChecked(t *testing.T) {
+	s, _, closeDB := newTestServer(t)
+	defer closeDB()
+	logger, _ := test.NewNullLogger()
+	s.SetWatchdog(watchdogs.NewWatchdog(s.db, logger, time.Minute))
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/freshness", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"error": "Freshness is not checked yet"}`, w.Body.String())
+}
+
+func TestServer_handleFreshnessDisabled(t *testing.T) {
+	s, _, closeDB := newTestServer(t)
+	defer closeDB()
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/freshness", nil))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error": "Watchdog is disabled"}`, w.Body.String())
+}
+
+func TestServer_handleFreshnessMethodNotAllowed(t *testing.T) {
+	s, _, closeDB := newTestServer(t)
+	defer closeDB()
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/freshness", nil))
+
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, http.MethodGet, w.Header().Get("Allow"))
+}
@@ -0,0 +1,152 @@
+package servers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/dneprix/ohlc/pkg/downloaders"
+)
+
+// healthTimeout limits DB checks of one health request
+const healthTimeout = 5 * time.Second
+
+// defaultPassTimeout after which running ProcessDownloader pass is considered stuck.
+// Stuck pass fails readiness only, so long passes don't restart service
+const defaultPassTimeout = 15 * time.Minute
+
+// healthResponse is a JSON body of health and readiness checks
+type healthResponse struct {
+	Status      string             `json:"status"`
+	DB          dbHealth           `json:"db"`
+	Migration   *migrationHealth   `json:"migration,omitempty"`
+	Downloaders []downloaderHealth `json:"downloaders"`
+}
+
+// dbHealth is a result of DB ping
+type dbHealth struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// migrationHealth is an applied migration version
+type migrationHealth struct {
+	Version uint64 `json:"version" db:"version"`
+	Dirty   bool   `json:"dirty" db:"dirty"`
+}
+
+// downloaderHealth is a heartbeat of downloader queue goroutine.
+// Times are unix seconds, zero values are omitted
+type downloaderHealth struct {
+	Name        string `json:"name"`
+	Alive       bool   `json:"alive"`
+	Stuck       bool   `json:"stuck"`
+	PassStarted int64  `json:"pass_started,omitempty"`
+	LastPass    int64  `json:"last_pass,omitempty"`
+}
+
+// SetDownloaders which heartbeats are checked by /healthz and /readyz
+func (s *Server) SetDownloaders(list []downloaders.Downloader) {
+	s.downloaders = list
+}
+
+// SetPassTimeout after which running downloader pass is considered stuck
+func (s *Server) SetPassTimeout(timeout time.Duration) {
+	s.passTimeout = timeout
+}
+
+// handleHealthz is a liveness check. Fails if any downloader goroutine is dead
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	res := s.checkHealth(r.Context())
+	ok := downloadersAlive(res.Downloaders)
+	s.writeHealth(w, res, ok)
+}
+
+// handleReadyz is a readiness check. Fails if DB is not available,
+// migration is dirty or any downloader goroutine is dead or stuck
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	res := s.checkHealth(r.Context())
+	ok := res.DB.OK && res.Migration != nil && !res.Migration.Dirty && downloadersHealthy(res.Downloaders)
+	s.writeHealth(w, res, ok)
+}
+
+// writeHealth response with 503 status if check is failed
+func (s *Server) writeHealth(w http.ResponseWriter, res healthResponse, ok bool) {
+	if !ok {
+		res.Status = "fail"
+		s.writeJSON(w, http.StatusServiceUnavailable, res)
+		return
+	}
+	res.Status = "ok"
+	s.writeJSON(w, http.StatusOK, res)
+}
+
+// checkHealth of DB, migration and downloaders
+func (s *Server) checkHealth(ctx context.Context) healthResponse {
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+
+	res := healthResponse{
+		Downloaders: make([]downloaderHealth, 0, len(s.downloaders)),
+	}
+	if err := s.db.PingContext(ctx); err != nil {
+		res.DB.Error = err.Error()
+	} else {
+		res.DB.OK = true
+		migration, err := getMigration(ctx, s.db)
+		if err != nil {
+			s.logger.Errorf("Get migration version fail: %s", err)
+		}
+		res.Migration = migration
+	}
+
+	now := time.Now()
+	for _, d := range s.downloaders {
+		status := d.Heartbeat().Status()
+		dh := downloaderHealth{
+			Name:  d.Name(),
+			Alive: status.Alive,
+		}
+		if !status.PassStarted.IsZero() {
+			dh.PassStarted = status.PassStarted.Unix()
+			dh.Stuck = now.Sub(status.PassStarted) > s.passTimeout
+		}
+		if !status.LastPass.IsZero() {
+			dh.LastPass = status.LastPass.Unix()
+		}
+		res.Downloaders = append(res.Downloaders, dh)
+	}
+	return res
+}
+
+// downloadersAlive if all goroutines are alive
+func downloadersAlive(list []downloaderHealth) bool {
+	for _, dh := range list {
+		if !dh.Alive {
+			return false
+		}
+	}
+	return true
+}
+
+// downloadersHealthy if all goroutines are alive and not stuck
+func downloadersHealthy(list []downloaderHealth) bool {
+	for _, dh := range list {
+		if dh.Stuck {
+			return false
+		}
+	}
+	return downloadersAlive(list)
+}
+
+// getMigration version applied by migrate tool
+func getMigration(ctx context.Context, db *sqlx.DB) (*migrationHealth, error) {
+	migration := &migrationHealth{}
+	if err := db.GetContext(ctx, migration, `SELECT version, dirty FROM schema_migrations LIMIT 1;`); err != nil {
+		return nil, fmt.Errorf("Query schema_migrations fail: %s", err)
+	}
+	return migration, nil
+}
@@ -0,0 +1,167 @@
+package servers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dneprix/ohlc/pkg/downloaders"
+)
+
+// runTestDownloader queue goroutine until returned stop func is called
+func runTestDownloader(t *testing.T, s *Server) (downloaders.Downloader, func()) {
+	logger, _ := test.NewNullLogger()
+	d := downloaders.NewKrakenDownloader(s.db, logger)
+	done := make(chan (bool))
+	go func() {
+		downloaders.ProcessQueue(context.Background(), d)
+		close(done)
+	}()
+	for !d.Heartbeat().Status().Alive {
+		time.Sleep(time.Millisecond)
+	}
+	return d, func() {
+		close(d.Stop())
+		<-done
+	}
+}
+
+func TestServer_handleHealthz(t *testing.T) {
+	s, mock, closeDB := newTestServer(t)
+	defer closeDB()
+	d, stop := runTestDownloader(t, s)
+	defer stop()
+	s.SetDownloaders([]downloaders.Downloader{d})
+
+	mock.ExpectQuery("SELECT version, dirty FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(201910061200, false))
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+      "status": "ok",
+      "db": {"ok": true},
+      "migration": {"version": 201910061200, "dirty": false},
+      "downloaders": [{"name": "KRAKEN", "alive": true, "stuck": false}]
+    }`, w.Body.String())
+}
+
+func TestServer_handleHealthzDeadDownloader(t *testing.T) {
+	s, mock, closeDB := newTestServer(t)
+	defer closeDB()
+	d, stop := runTestDownloader(t, s)
+	stop()
+	s.SetDownloaders([]downloaders.Downloader{d})
+
+	mock.ExpectQuery("SELECT version, dirty FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(201910061200, false))
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"fail"`)
+	assert.Contains(t, w.Body.String(), `{"name":"KRAKEN","alive":false,"stuck":false}`)
+}
+
+func TestServer_handleReadyzStuckDownloader(t *testing.T) {
+	s, mock, closeDB := newTestServer(t)
+	defer closeDB()
+	d, stop := runTestDownloader(t, s)
+	defer stop()
+	s.SetDownloaders([]downloaders.Downloader{d})
+	s.SetPassTimeout(time.Nanosecond)
+
+	// Pass is blocked by slow assets query, health checks may query DB before it
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectQuery("SELECT \\* FROM assets").WillDelayFor(100 * time.Millisecond).WillReturnError(fmt.Errorf("DB error"))
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery("SELECT version, dirty FROM schema_migrations").
+			WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(201910061200, false))
+	}
+	d.Queue() <- true
+	for d.Heartbeat().Status().PassStarted.IsZero() {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Long pass doesn't fail liveness
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"alive":true,"stuck":true`)
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), `"alive":true,"stuck":true`)
+}
+
+func TestServer_handleReadyz(t *testing.T) {
+	s, mock, closeDB := newTestServer(t)
+	defer closeDB()
+
+	mock.ExpectQuery("SELECT version, dirty FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(201910061200, false))
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"ok"`)
+}
+
+func TestServer_handleReadyzDirtyMigration(t *testing.T) {
+	s, mock, closeDB := newTestServer(t)
+	defer closeDB()
+
+	mock.ExpectQuery("SELECT version, dirty FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(201910061200, true))
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), `"migration":{"version":201910061200,"dirty":true}`)
+}
+
+func TestServer_handleReadyzMigrationFail(t *testing.T) {
+	s, mock, closeDB := newTestServer(t)
+	defer closeDB()
+
+	mock.ExpectQuery("SELECT version, dirty FROM schema_migrations").WillReturnError(fmt.Errorf("DB error"))
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotContains(t, w.Body.String(), `"migration"`)
+}
+
+func TestServer_handleReadyzDBFail(t *testing.T) {
+	s, _, closeDB := newTestServer(t)
+	closeDB()
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{
+      "status": "fail",
+      "db": {"ok": false, "error": "sql: database is closed"},
+      "downloaders": []
+    }`, w.Body.String())
+
+	// Liveness doesn't depend on DB
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
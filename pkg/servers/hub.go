@@ -0,0 +1,418 @@
+package servers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dneprix/ohlc/pkg/assets"
+	"github.com/dneprix/ohlc/pkg/candles"
+	"github.com/dneprix/ohlc/pkg/queries"
+)
+
+const (
+	// clientBufferSize of messages waiting for slow client. Client is dropped when buffer is full
+	clientBufferSize = 256
+	// maxSubscribeBackfill limits candles sent on subscribe
+	maxSubscribeBackfill = 1000
+	// writeWait limits writing of one message
+	writeWait = 10 * time.Second
+	// pongWait limits waiting for client pong
+	pongWait = 60 * time.Second
+	// pingPeriod is less than pongWait
+	pingPeriod = pongWait * 9 / 10
+	// maxMessageSize of client message
+	maxMessageSize = 1024
+)
+
+// Hub pushes changed candles to WebSocket clients subscribed to
+// channels in FROM/TO/EXCHANGE/PERIOD format
+type Hub struct {
+	db       *sqlx.DB
+	logger   *logrus.Entry
+	upgrader websocket.Upgrader
+
+	mu       sync.RWMutex
+	channels map[channelKey]*channel
+	clients  map[*client]bool
+	closed   bool
+}
+
+// channelKey of asset period
+type channelKey struct {
+	assetID uint
+	period  uint
+}
+
+// channel with subscribed clients
+type channel struct {
+	clients map[*client]*subscription
+}
+
+// subscription of client to channel by its own channel name. Live messages
+// are held until subscribe backfill is sent, so revised candle never comes
+// before its stale backfilled copy
+type subscription struct {
+	name string
+	// held live messages, nil when backfill is sent
+	held [][]byte
+}
+
+// client is a WebSocket connection with buffered outgoing messages.
+// Subscribe backfill is written through unbuffered channel, so it never fills live buffer
+type client struct {
+	conn      *websocket.Conn
+	send      chan ([]byte)
+	backfill  chan ([]byte)
+	closeOnce sync.Once
+	done      chan (bool)
+}
+
+// close connection once
+func (c *client) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// write message to connection with write deadline
+func (c *client) write(messageType int, data []byte) error {
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.conn.WriteMessage(messageType, data)
+}
+
+// clientMessage is a request of client
+type clientMessage struct {
+	// Action is "subscribe" or "unsubscribe"
+	Action  string `json:"action"`
+	Channel string `json:"channel"`
+	// Backfill is a number of last stored candles sent on subscribe
+	Backfill int `json:"backfill"`
+}
+
+// hubMessage is a message to client
+type hubMessage struct {
+	// Type is "candle", "subscribed", "unsubscribed" or "error"
+	Type    string          `json:"type"`
+	Channel string          `json:"channel,omitempty"`
+	Candle  *candles.Candle `json:"candle,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// NewHub constructor
+func NewHub(db *sqlx.DB, logger *logrus.Entry) *Hub {
+	return &Hub{
+		db:     db,
+		logger: logger,
+		upgrader: websocket.Upgrader{
+			// Read API is public
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		channels: map[channelKey]*channel{},
+		clients:  map[*client]bool{},
+	}
+}
+
+// Publish candles to subscribed clients. Never blocks: client which
+// can't receive message is dropped
+func (h *Hub) Publish(candlesData []*candles.Candle) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, c := range candlesData {
+		ch, ok := h.channels[channelKey{c.AssetID, c.Period}]
+		if !ok {
+			continue
+		}
+		// Message is marshaled once for each channel name of clients
+		messages := map[string][]byte{}
+		for cl, sub := range ch.clients {
+			message, ok := messages[sub.name]
+			if !ok {
+				var err error
+				message, err = json.Marshal(hubMessage{Type: "candle", Channel: sub.name, Candle: c})
+				if err != nil {
+					h.logger.Errorf("Marshal candle message fail: %s", err)
+					continue
+				}
+				messages[sub.name] = message
+			}
+			h.hold(cl, sub, message)
+		}
+	}
+}
+
+// hold live message until subscribe backfill is sent or push it to client.
+// Client with more held messages than its buffer is dropped as slow
+func (h *Hub) hold(cl *client, sub *subscription, message []byte) {
+	if sub.held == nil {
+		h.push(cl, message)
+		return
+	}
+	if len(sub.held) >= clientBufferSize {
+		h.logger.Warnf("Drop slow WebSocket client: %s", cl.conn.RemoteAddr())
+		cl.close()
+		return
+	}
+	sub.held = append(sub.held, message)
+}
+
+// push message to client buffer or drop slow client
+func (h *Hub) push(cl *client, message []byte) {
+	select {
+	case cl.send <- message:
+	case <-cl.done:
+	default:
+		h.logger.Warnf("Drop slow WebSocket client: %s", cl.conn.RemoteAddr())
+		cl.close()
+	}
+}
+
+// ServeHTTP upgrades connection to WebSocket
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrader has already responded with error
+		h.logger.Warnf("Upgrade WebSocket connection fail: %s", err)
+		return
+	}
+
+	cl := &client{
+		conn:     conn,
+		send:     make(chan ([]byte), clientBufferSize),
+		backfill: make(chan ([]byte)),
+		done:     make(chan (bool)),
+	}
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		cl.close()
+		return
+	}
+	h.clients[cl] = true
+	h.mu.Unlock()
+
+	go h.writeLoop(cl)
+	h.readLoop(cl)
+}
+
+// Close all client connections
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for cl := range h.clients {
+		cl.close()
+	}
+}
+
+// readLoop handles client messages until connection is closed
+func (h *Hub) readLoop(cl *client) {
+	defer h.remove(cl)
+
+	cl.conn.SetReadLimit(maxMessageSize)
+	cl.conn.SetReadDeadline(time.Now().Add(pongWait))
+	cl.conn.SetPongHandler(func(string) error {
+		return cl.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		message := clientMessage{}
+		if err := cl.conn.ReadJSON(&message); err != nil {
+			switch err.(type) {
+			case *json.SyntaxError, *json.UnmarshalTypeError:
+				h.reply(cl, hubMessage{Type: "error", Error: "Parse message fail"})
+				continue
+			}
+			return
+		}
+		switch message.Action {
+		case "subscribe":
+			h.subscribe(cl, message)
+		case "unsubscribe":
+			h.unsubscribe(cl, message.Channel)
+		default:
+			h.reply(cl, hubMessage{Type: "error", Error: fmt.Sprintf("Unknown action: %q", message.Action)})
+		}
+	}
+}
+
+// writeLoop sends buffered messages and pings until connection is closed
+func (h *Hub) writeLoop(cl *client) {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	defer cl.close()
+
+	for {
+		select {
+		case message := <-cl.send:
+			if err := cl.write(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case message := <-cl.backfill:
+			if err := cl.write(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := cl.write(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-cl.done:
+			return
+		}
+	}
+}
+
+// reply to client
+func (h *Hub) reply(cl *client, m hubMessage) {
+	message, err := json.Marshal(m)
+	if err != nil {
+		h.logger.Errorf("Marshal message fail: %s", err)
+		return
+	}
+	h.push(cl, message)
+}
+
+// deliver message to client waiting for writer. Client which doesn't
+// receive message in write time is dropped. Returns false if client is closed
+func (h *Hub) deliver(cl *client, m hubMessage) bool {
+	message, err := json.Marshal(m)
+	if err != nil {
+		h.logger.Errorf("Marshal message fail: %s", err)
+		return true
+	}
+	timer := time.NewTimer(writeWait)
+	defer timer.Stop()
+	select {
+	case cl.backfill <- message:
+		return true
+	case <-cl.done:
+	case <-timer.C:
+		h.logger.Warnf("Drop slow WebSocket client: %s", cl.conn.RemoteAddr())
+		cl.close()
+	}
+	return false
+}
+
+// subscribe client to channel and send last stored candles
+func (h *Hub) subscribe(cl *client, message clientMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	key, err := h.resolveChannel(ctx, message.Channel)
+	if err != nil {
+		h.reply(cl, hubMessage{Type: "error", Channel: message.Channel, Error: err.Error()})
+		return
+	}
+	if message.Backfill < 0 || message.Backfill > maxSubscribeBackfill {
+		h.reply(cl, hubMessage{Type: "error", Channel: message.Channel, Error: fmt.Sprintf("Backfill is out of range 0..%d", maxSubscribeBackfill)})
+		return
+	}
+
+	// Subscribe before backfill, so no candle is missed between them.
+	// Client can receive the same candle twice, live copy is sent after backfill
+	sub := &subscription{name: message.Channel, held: [][]byte{}}
+	h.mu.Lock()
+	ch, ok := h.channels[key]
+	if !ok {
+		ch = &channel{clients: map[*client]*subscription{}}
+		h.channels[key] = ch
+	}
+	ch.clients[cl] = sub
+	h.mu.Unlock()
+	defer h.release(cl, sub)
+	if !h.deliver(cl, hubMessage{Type: "subscribed", Channel: message.Channel}) {
+		return
+	}
+
+	if message.Backfill == 0 {
+		return
+	}
+	candlesData, err := queries.LastCandles(ctx, h.db, key.assetID, key.period, message.Backfill)
+	if err != nil {
+		h.logger.Errorf("Query last candles fail: %s", err)
+		h.reply(cl, hubMessage{Type: "error", Channel: message.Channel, Error: "Query last candles fail"})
+		return
+	}
+	for _, c := range candlesData {
+		if !h.deliver(cl, hubMessage{Type: "candle", Channel: message.Channel, Candle: c}) {
+			return
+		}
+	}
+}
+
+// release held live messages of subscription to client buffer after backfill
+func (h *Hub) release(cl *client, sub *subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, message := range sub.held {
+		h.push(cl, message)
+	}
+	sub.held = nil
+}
+
+// unsubscribe client from channel. Channel name is resolved to asset period,
+// so client can unsubscribe by any name of subscribed channel
+func (h *Hub) unsubscribe(cl *client, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	key, err := h.resolveChannel(ctx, name)
+	if err != nil {
+		h.reply(cl, hubMessage{Type: "error", Channel: name, Error: err.Error()})
+		return
+	}
+	h.mu.Lock()
+	if ch, ok := h.channels[key]; ok {
+		delete(ch.clients, cl)
+		if len(ch.clients) == 0 {
+			delete(h.channels, key)
+		}
+	}
+	h.mu.Unlock()
+	h.reply(cl, hubMessage{Type: "unsubscribed", Channel: name})
+}
+
+// remove client from all channels
+func (h *Hub) remove(cl *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for key, ch := range h.channels {
+		delete(ch.clients, cl)
+		if len(ch.clients) == 0 {
+			delete(h.channels, key)
+		}
+	}
+	delete(h.clients, cl)
+	cl.close()
+}
+
+// resolveChannel name in FROM/TO/EXCHANGE/PERIOD format to asset period
+func (h *Hub) resolveChannel(ctx context.Context, name string) (channelKey, error) {
+	i := strings.LastIndex(name, "/")
+	if i < 0 {
+		return channelKey{}, fmt.Errorf("Parse channel fail: %q", name)
+	}
+	period, err := strconv.ParseUint(name[i+1:], 10, 32)
+	if err != nil || period == 0 {
+		return channelKey{}, fmt.Errorf("Parse channel period fail: %q", name)
+	}
+	if _, _, _, err := assets.ParseName(name[:i]); err != nil {
+		return channelKey{}, fmt.Errorf("Parse channel fail: %q", name)
+	}
+	asset, err := assets.GetByName(ctx, h.db, name[:i])
+	if err != nil {
+		return channelKey{}, fmt.Errorf("Unknown channel asset: %q", name[:i])
+	}
+	return channelKey{asset.ID, uint(period)}, nil
+}
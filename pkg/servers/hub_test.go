@@ -0,0 +1,252 @@
+package servers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dneprix/ohlc/pkg/candles"
+)
+
+func dialTestHub(t *testing.T, s *Server) (*websocket.Conn, func()) {
+	ts := httptest.NewServer(s)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, func() {
+		conn.Close()
+		s.Hub().Close()
+		ts.Close()
+	}
+}
+
+func readHubMessage(t *testing.T, conn *websocket.Conn) map[string]interface{} {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	message := map[string]interface{}{}
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+func expectTestChannelAsset(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("SELECT \\* FROM assets").
+		WithArgs("BTC", "USD", "KRAKEN").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "coin_from", "coin_to", "exchange", "downloader", "url"}).
+			AddRow(1, "BTC", "USD", "KRAKEN", "KRAKEN", "TEST_URL"))
+}
+
+func TestHub_SubscribePublish(t *testing.T) {
+	s, mock, closeDB := newTestServer(t)
+	defer closeDB()
+	conn, closeConn := dialTestHub(t, s)
+	defer closeConn()
+
+	expectTestChannelAsset(mock)
+	mock.ExpectQuery("SELECT .+ FROM candles").
+		WithArgs(1, 60, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "asset_id", "period", "close_time", "open_price", "high_price", "low_price", "close_price", "volume", "derived"}).
+			AddRow(1, 1, 60, 1569563400, "1", "1", "1", "1", "1", false))
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"action": "subscribe", "channel": "BTC/USD/KRAKEN/60", "backfill": 1}))
+	assert.Equal(t, map[string]interface{}{"type": "subscribed", "channel": "BTC/USD/KRAKEN/60"}, readHubMessage(t, conn))
+	message := readHubMessage(t, conn)
+	assert.Equal(t, "candle", message["type"])
+	assert.Equal(t, float64(1569563400), message["candle"].(map[string]interface{})["close_time"])
+
+	s.Hub().Publish([]*candles.Candle{
+		{AssetID: 2, Period: 60, CloseTime: 1569563460},
+		{AssetID: 1, Period: 3600, CloseTime: 1569563460},
+		{AssetID: 1, Period: 60, CloseTime: 1569563460, ClosePrice: candles.MustParseDecimal("7937.60")},
+	})
+	message = readHubMessage(t, conn)
+	assert.Equal(t, "candle", message["type"])
+	assert.Equal(t, "BTC/USD/KRAKEN/60", message["channel"])
+	assert.Equal(t, float64(1569563460), message["candle"].(map[string]interface{})["close_time"])
+	assert.Equal(t, "7937.60", message["candle"].(map[string]interface{})["close_price"])
+
+	expectTestChannelAsset(mock)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"action": "unsubscribe", "channel": "BTC/USD/KRAKEN/60"}))
+	assert.Equal(t, map[string]interface{}{"type": "unsubscribed", "channel": "BTC/USD/KRAKEN/60"}, readHubMessage(t, conn))
+	s.Hub().mu.RLock()
+	assert.Empty(t, s.Hub().channels)
+	s.Hub().mu.RUnlock()
+}
+
+func TestHub_SubscribeBackfillOverBuffer(t *testing.T) {
+	s, mock, closeDB := newTestServer(t)
+	defer closeDB()
+	conn, closeConn := dialTestHub(t, s)
+	defer closeConn()
+
+	backfill := clientBufferSize * 3
+	rows := sqlmock.NewRows([]string{"id", "asset_id", "period", "close_time", "open_price", "high_price", "low_price", "close_price", "volume", "derived"})
+	for i := 0; i < backfill; i++ {
+		rows.AddRow(i+1, 1, 60, 1569563400+int64(i*60), "1", "1", "1", "1", "1", false)
+	}
+	expectTestChannelAsset(mock)
+	mock.ExpectQuery("SELECT .+ FROM candles").WithArgs(1, 60, backfill).WillReturnRows(rows)
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"action": "subscribe", "channel": "BTC/USD/KRAKEN/60", "backfill": backfill}))
+	assert.Equal(t, map[string]interface{}{"type": "subscribed", "channel": "BTC/USD/KRAKEN/60"}, readHubMessage(t, conn))
+
+	// Live candles published during backfill don't share its buffer
+	s.Hub().Publish([]*candles.Candle{{AssetID: 1, Period: 60, CloseTime: 1569600000}})
+
+	for i := 0; i < backfill+1; i++ {
+		assert.Equal(t, "candle", readHubMessage(t, conn)["type"])
+	}
+
+	// Client is still connected
+	expectTestChannelAsset(mock)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"action": "unsubscribe", "channel": "BTC/USD/KRAKEN/60"}))
+	assert.Equal(t, map[string]interface{}{"type": "unsubscribed", "channel": "BTC/USD/KRAKEN/60"}, readHubMessage(t, conn))
+}
+
+func TestHub_SubscribeHoldLiveUntilBackfill(t *testing.T) {
+	s, mock, closeDB := newTestServer(t)
+	defer closeDB()
+	conn, closeConn := dialTestHub(t, s)
+	defer closeConn()
+
+	expectTestChannelAsset(mock)
+	mock.ExpectQuery("SELECT .+ FROM candles").
+		WithArgs(1, 60, 1).
+		WillDelayFor(100 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "asset_id", "period", "close_time", "open_price", "high_price", "low_price", "close_price", "volume", "derived"}).
+			AddRow(1, 1, 60, 1569563400, "1", "1", "1", "1", "1", false))
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"action": "subscribe", "channel": "BTC/USD/KRAKEN/60", "backfill": 1}))
+	assert.Equal(t, map[string]interface{}{"type": "subscribed", "channel": "BTC/USD/KRAKEN/60"}, readHubMessage(t, conn))
+
+	// Revision of backfilled candle is published while backfill is queried
+	s.Hub().Publish([]*candles.Candle{
+		{AssetID: 1, Period: 60, CloseTime: 1569563400, ClosePrice: candles.MustParseDecimal("2")},
+	})
+
+	message := readHubMessage(t, conn)
+	assert.Equal(t, "1", message["candle"].(map[string]interface{})["close_price"])
+	message = readHubMessage(t, conn)
+	assert.Equal(t, "2", message["candle"].(map[string]interface{})["close_price"])
+}
+
+func TestHub_ChannelNamePerClient(t *testing.T) {
+	s, mock, closeDB := newTestServer(t)
+	defer closeDB()
+	conn, closeConn := dialTestHub(t, s)
+	defer closeConn()
+	other, closeOther := dialTestHub(t, s)
+	defer closeOther()
+
+	// Clients subscribe to the same asset period by different names
+	expectTestChannelAsset(mock)
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"action": "subscribe", "channel": "BTC/USD/KRAKEN/60"}))
+	assert.Equal(t, map[string]interface{}{"type": "subscribed", "channel": "BTC/USD/KRAKEN/60"}, readHubMessage(t, conn))
+	expectTestChannelAsset(mock)
+	assert.NoError(t, other.WriteJSON(map[string]interface{}{"action": "subscribe", "channel": "BTC/USD/KRAKEN/060"}))
+	assert.Equal(t, map[string]interface{}{"type": "subscribed", "channel": "BTC/USD/KRAKEN/060"}, readHubMessage(t, other))
+
+	s.Hub().Publish([]*candles.Candle{{AssetID: 1, Period: 60, CloseTime: 1569563460}})
+	assert.Equal(t, "BTC/USD/KRAKEN/60", readHubMessage(t, conn)["channel"])
+	assert.Equal(t, "BTC/USD/KRAKEN/060", readHubMessage(t, other)["channel"])
+
+	// Client unsubscribes by its own name, other client is still subscribed
+	expectTestChannelAsset(mock)
+	assert.NoError(t, other.WriteJSON(map[string]interface{}{"action": "unsubscribe", "channel": "BTC/USD/KRAKEN/060"}))
+	assert.Equal(t, map[string]interface{}{"type": "unsubscribed", "channel": "BTC/USD/KRAKEN/060"}, readHubMessage(t, other))
+	s.Hub().mu.RLock()
+	assert.Len(t, s.Hub().channels[channelKey{1, 60}].clients, 1)
+	s.Hub().mu.RUnlock()
+
+	s.Hub().Publish([]*candles.Candle{{AssetID: 1, Period: 60, CloseTime: 1569563520}})
+	assert.Equal(t, float64(1569563520), readHubMessage(t, conn)["candle"].(map[string]interface{})["close_time"])
+}
+
+func TestHub_SubscribeFail(t *testing.T) {
+	s, mock, closeDB := newTestServer(t)
+	defer closeDB()
+	conn, closeConn := dialTestHub(t, s)
+	defer closeConn()
+
+	mock.ExpectQuery("SELECT \\* FROM assets").
+		WithArgs("BTC", "USD", "UNKNOWN").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	for _, tt := range []struct {
+		message  string
+		expected string
+	}{
+		{`{"action": "subscribe", "channel": "BTC"}`, `Parse channel fail: "BTC"`},
+		{`{"action": "subscribe", "channel": "BTC/USD/60"}`, `Parse channel fail: "BTC/USD/60"`},
+		{`{"action": "subscribe", "channel": "BTC/USD/KRAKEN/x"}`, `Parse channel period fail: "BTC/USD/KRAKEN/x"`},
+		{`{"action": "subscribe", "channel": "BTC/USD/UNKNOWN/60"}`, `Unknown channel asset: "BTC/USD/UNKNOWN"`},
+		{`{"action": "publish"}`, `Unknown action: "publish"`},
+		{`{"action": 1}`, `Parse message fail`},
+		{`<>`, `Parse message fail`},
+	} {
+		assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(tt.message)))
+		message := readHubMessage(t, conn)
+		assert.Equal(t, "error", message["type"], tt.message)
+		assert.Equal(t, tt.expected, message["error"], tt.message)
+	}
+}
+
+func TestHub_pushDropSlowClient(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	h := NewHub(nil, logrus.NewEntry(logger))
+
+	connected := make(chan (*websocket.Conn), 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _ := h.upgrader.Upgrade(w, r, nil)
+		connected <- conn
+	}))
+	defer ts.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	cl := &client{
+		conn: <-connected,
+		send: make(chan ([]byte), 1),
+		done: make(chan (bool)),
+	}
+	h.push(cl, []byte("1"))
+	h.push(cl, []byte("2"))
+
+	select {
+	case <-cl.done:
+	default:
+		t.Error("Slow client is not dropped")
+	}
+	assert.Contains(t, hook.LastEntry().Message, "Drop slow WebSocket client")
+
+	// Closed client is skipped
+	h.push(cl, []byte("3"))
+	assert.Len(t, cl.send, 1)
+}
+
+func TestHub_Close(t *testing.T) {
+	s, _, closeDB := newTestServer(t)
+	defer closeDB()
+	conn, closeConn := dialTestHub(t, s)
+	defer closeConn()
+
+	// Wait for client registration
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"action": "unsubscribe", "channel": "X"}))
+	readHubMessage(t, conn)
+
+	s.Hub().Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := conn.ReadMessage()
+	assert.Error(t, err)
+}
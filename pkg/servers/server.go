@@ -0,0 +1,117 @@
+package servers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dneprix/ohlc/pkg/downloaders"
+	"github.com/dneprix/ohlc/pkg/metrics"
+	"github.com/dneprix/ohlc/pkg/watchdogs"
+)
+
+// requestTimeout limits handling of one request
+const requestTimeout = 30 * time.Second
+
+// Server is a read API of stored candles
+type Server struct {
+	db     *sqlx.DB
+	logger *logrus.Entry
+	mux    *http.ServeMux
+	http   *http.Server
+	hub    *Hub
+
+	// watchdog is optional freshness checker
+	watchdog *watchdogs.Watchdog
+
+	// downloaders which heartbeats are checked by health endpoints
+	downloaders []downloaders.Downloader
+	passTimeout time.Duration
+}
+
+// NewServer constructor
+func NewServer(addr string, db *sqlx.DB, logger *logrus.Logger) *Server {
+	s := &Server{
+		db: db,
+		logger: logger.WithFields(logrus.Fields{
+			"server": addr,
+		}),
+		mux:         http.NewServeMux(),
+		passTimeout: defaultPassTimeout,
+	}
+	s.hub = NewHub(db, s.logger)
+	s.mux.HandleFunc("/candles", s.handleCandles)
+	s.mux.Handle("/ws", s.hub)
+	s.mux.Handle("/metrics", metrics.Handler())
+	s.mux.HandleFunc("/freshness", s.handleFreshness)
+	s.mux.HandleFunc("/healthz", s.handleHealthz)
+	s.mux.HandleFunc("/readyz", s.handleReadyz)
+	s.http = &http.Server{
+		Addr:         addr,
+		Handler:      s,
+		ReadTimeout:  requestTimeout,
+		WriteTimeout: requestTimeout,
+	}
+	return s
+}
+
+// Hub of WebSocket clients which publishes changed candles
+func (s *Server) Hub() *Hub {
+	return s.hub
+}
+
+// SetWatchdog which statuses are served on /freshness
+func (s *Server) SetWatchdog(w *watchdogs.Watchdog) {
+	s.watchdog = w
+}
+
+// ServeHTTP implements http.Handler interface
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// WebSocket connection is long-lived
+	if r.URL.Path == "/ws" {
+		s.mux.ServeHTTP(w, r)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+	s.mux.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// Run server. Blocks until Shutdown is called
+func (s *Server) Run() error {
+	s.logger.Info("Run HTTP server")
+	if err := s.http.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown server waiting for active requests. WebSocket connections are closed
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.logger.Warn("Shutdown HTTP server")
+	s.hub.Close()
+	return s.http.Shutdown(ctx)
+}
+
+// errorResponse is a JSON body of failed request
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// writeJSON response with status
+func (s *Server) writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		s.logger.Errorf("Write response fail: %s", err)
+	}
+}
+
+// writeError response with status
+func (s *Server) writeError(w http.ResponseWriter, status int, err error) {
+	s.writeJSON(w, status, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,55 @@
+package servers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_RunShutdown(t *testing.T) {
+	s, _, closeDB := newTestServer(t)
+	defer closeDB()
+	s.http.Addr = "127.0.0.1:0"
+
+	done := make(chan (error))
+	go func() {
+		done <- s.Run()
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	assert.NoError(t, s.Shutdown(context.Background()))
+	assert.NoError(t, <-done)
+}
+
+func TestServer_RunFail(t *testing.T) {
+	s, _, closeDB := newTestServer(t)
+	defer closeDB()
+	s.http.Addr = "invalid address"
+
+	assert.Error(t, s.Run())
+}
+
+func TestServer_NotFound(t *testing.T) {
+	s, _, closeDB := newTestServer(t)
+	defer closeDB()
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestServer_Metrics(t *testing.T) {
+	s, _, closeDB := newTestServer(t)
+	defer closeDB()
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "go_goroutines")
+}
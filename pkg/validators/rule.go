@@ -0,0 +1,96 @@
+package validators
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dneprix/ohlc/pkg/candles"
+)
+
+// futureTolerance allows clock difference with data source
+const futureTolerance = time.Minute
+
+// Rule checks one candle. Error describes violation
+type Rule interface {
+	Name() string
+	Check(c *candles.Candle, now time.Time) error
+}
+
+// RuleFunc adapts function to Rule interface
+type RuleFunc struct {
+	RuleName  string
+	CheckFunc func(c *candles.Candle, now time.Time) error
+}
+
+// Name of rule
+func (rf RuleFunc) Name() string {
+	return rf.RuleName
+}
+
+// Check candle
+func (rf RuleFunc) Check(c *candles.Candle, now time.Time) error {
+	return rf.CheckFunc(c, now)
+}
+
+// HighLow checks that high and low prices bound open and close prices
+var HighLow Rule = RuleFunc{"high-low", func(c *candles.Candle, now time.Time) error {
+	if c.HighPrice.LessThan(c.LowPrice.Decimal) {
+		return fmt.Errorf("high %s < low %s", c.HighPrice, c.LowPrice)
+	}
+	for _, p := range []candles.Decimal{c.OpenPrice, c.ClosePrice} {
+		if p.GreaterThan(c.HighPrice.Decimal) || p.LessThan(c.LowPrice.Decimal) {
+			return fmt.Errorf("price %s is out of low %s and high %s", p, c.LowPrice, c.HighPrice)
+		}
+	}
+	return nil
+}}
+
+// PositivePrices checks that all prices are greater than zero
+var PositivePrices Rule = RuleFunc{"positive-prices", func(c *candles.Candle, now time.Time) error {
+	for _, p := range []candles.Decimal{c.OpenPrice, c.HighPrice, c.LowPrice, c.ClosePrice} {
+		if !p.IsPositive() {
+			return fmt.Errorf("price %s is not positive", p)
+		}
+	}
+	return nil
+}}
+
+// NonNegativeVolume checks that volume is not negative
+var NonNegativeVolume Rule = RuleFunc{"non-negative-volume", func(c *candles.Candle, now time.Time) error {
+	if c.Volume.IsNegative() {
+		return fmt.Errorf("volume %s is negative", c.Volume)
+	}
+	return nil
+}}
+
+// weekPeriod candles close on Monday 00:00 UTC, while Unix epoch is Thursday
+const (
+	weekPeriod = 7 * 24 * 60 * 60
+	weekOffset = 4 * 24 * 60 * 60
+)
+
+// AlignedCloseTime checks that close time is a multiple of period.
+// Weekly close time is a multiple of week since the first Monday after epoch
+var AlignedCloseTime Rule = RuleFunc{"aligned-close-time", func(c *candles.Candle, now time.Time) error {
+	if c.Period == 0 {
+		return fmt.Errorf("period is zero")
+	}
+	offset := int64(0)
+	if c.Period == weekPeriod {
+		offset = weekOffset
+	}
+	if (c.CloseTime-offset)%int64(c.Period) != 0 {
+		return fmt.Errorf("close time %d is not aligned to period %d", c.CloseTime, c.Period)
+	}
+	return nil
+}}
+
+// NotFuture checks that candle period has already started.
+// Forming candle closes in the future and is valid
+var NotFuture Rule = RuleFunc{"not-future", func(c *candles.Candle, now time.Time) error {
+	openTime := time.Unix(c.CloseTime-int64(c.Period), 0)
+	if openTime.After(now.Add(futureTolerance)) {
+		return fmt.Errorf("open time %s is in the future", openTime.UTC().Format(time.RFC3339))
+	}
+	return nil
+}}
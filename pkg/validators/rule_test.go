@@ -0,0 +1,83 @@
+package validators
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dneprix/ohlc/pkg/candles"
+)
+
+func validCandle() *candles.Candle {
+	return &candles.Candle{
+		AssetID:    1,
+		Period:     60,
+		CloseTime:  1569563400,
+		OpenPrice:  candles.MustParseDecimal("7937.2"),
+		HighPrice:  candles.MustParseDecimal("7940.1"),
+		LowPrice:   candles.MustParseDecimal("7930.5"),
+		ClosePrice: candles.MustParseDecimal("7937.6"),
+		Volume:     candles.MustParseDecimal("0.00839492"),
+	}
+}
+
+func TestRules(t *testing.T) {
+	now := time.Unix(1569563400, 0)
+	for _, rule := range []Rule{HighLow, PositivePrices, NonNegativeVolume, AlignedCloseTime, NotFuture} {
+		assert.NoError(t, rule.Check(validCandle(), now), rule.Name())
+	}
+}
+
+func TestHighLow(t *testing.T) {
+	c := validCandle()
+	c.HighPrice = candles.MustParseDecimal("7900")
+	assert.EqualError(t, HighLow.Check(c, time.Now()), "high 7900 < low 7930.5")
+
+	c = validCandle()
+	c.ClosePrice = candles.MustParseDecimal("7950")
+	assert.EqualError(t, HighLow.Check(c, time.Now()), "price 7950 is out of low 7930.5 and high 7940.1")
+}
+
+func TestPositivePrices(t *testing.T) {
+	c := validCandle()
+	c.LowPrice = candles.MustParseDecimal("0")
+	assert.EqualError(t, PositivePrices.Check(c, time.Now()), "price 0 is not positive")
+}
+
+func TestNonNegativeVolume(t *testing.T) {
+	c := validCandle()
+	c.Volume = candles.MustParseDecimal("0")
+	assert.NoError(t, NonNegativeVolume.Check(c, time.Now()))
+
+	c.Volume = candles.MustParseDecimal("-0.1")
+	assert.EqualError(t, NonNegativeVolume.Check(c, time.Now()), "volume -0.1 is negative")
+}
+
+func TestAlignedCloseTime(t *testing.T) {
+	c := validCandle()
+	c.CloseTime = 1569563401
+	assert.EqualError(t, AlignedCloseTime.Check(c, time.Now()), "close time 1569563401 is not aligned to period 60")
+
+	// Weekly candles close on Monday 00:00 UTC
+	c.Period = 604800
+	c.CloseTime = 1569801600
+	assert.NoError(t, AlignedCloseTime.Check(c, time.Now()))
+	c.CloseTime = 1569456000
+	assert.EqualError(t, AlignedCloseTime.Check(c, time.Now()), "close time 1569456000 is not aligned to period 604800")
+
+	c.Period = 0
+	assert.EqualError(t, AlignedCloseTime.Check(c, time.Now()), "period is zero")
+}
+
+func TestNotFuture(t *testing.T) {
+	now := time.Unix(1569563400, 0)
+
+	// Forming candle
+	c := validCandle()
+	c.CloseTime = 1569563460
+	assert.NoError(t, NotFuture.Check(c, now))
+
+	c.CloseTime = 1569563580
+	assert.EqualError(t, NotFuture.Check(c, now), "open time 2019-09-27T05:52:00Z is in the future")
+}
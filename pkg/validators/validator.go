@@ -0,0 +1,211 @@
+package validators
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/dneprix/ohlc/pkg/candles"
+)
+
+// Action on candle which violates rule
+type Action int
+
+const (
+	// ActionWarn logs violation and keeps candle
+	ActionWarn Action = iota
+	// ActionDrop removes candle from batch
+	ActionDrop
+	// ActionReject rejects whole batch
+	ActionReject
+)
+
+var actionNames = map[Action]string{
+	ActionWarn:   "warn",
+	ActionDrop:   "drop",
+	ActionReject: "reject",
+}
+
+// ParseAction from name
+func ParseAction(name string) (Action, error) {
+	for action, actionName := range actionNames {
+		if actionName == name {
+			return action, nil
+		}
+	}
+	return ActionWarn, fmt.Errorf("Unknown validation action: %q", name)
+}
+
+// String name of action
+func (a Action) String() string {
+	if name, ok := actionNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+type validatorRule struct {
+	rule   Rule
+	action Action
+}
+
+// Validator checks candles by rules before saving
+type Validator struct {
+	rules []validatorRule
+	now   func() time.Time
+}
+
+// New validator without rules
+func New() *Validator {
+	return &Validator{now: time.Now}
+}
+
+// Default validator drops malformed candles and candles with close
+// times not aligned to period or in the future
+func Default() *Validator {
+	return New().
+		Add(HighLow, ActionDrop).
+		Add(PositivePrices, ActionDrop).
+		Add(NonNegativeVolume, ActionDrop).
+		Add(AlignedCloseTime, ActionDrop).
+		Add(NotFuture, ActionDrop)
+}
+
+// Add rule with action. Action of already added rule is replaced
+func (v *Validator) Add(rule Rule, action Action) *Validator {
+	for i, vr := range v.rules {
+		if vr.rule.Name() == rule.Name() {
+			v.rules[i].action = action
+			return v
+		}
+	}
+	v.rules = append(v.rules, validatorRule{rule, action})
+	return v
+}
+
+// SetActions of added rules from comma separated list, e.g. "aligned-close-time=warn,high-low=reject"
+func (v *Validator) SetActions(spec string) error {
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("Parse validation action fail: %q", item)
+		}
+		action, err := ParseAction(parts[1])
+		if err != nil {
+			return err
+		}
+		found := false
+		for i, vr := range v.rules {
+			if vr.rule.Name() == parts[0] {
+				v.rules[i].action = action
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("Unknown validation rule: %q", parts[0])
+		}
+	}
+	return nil
+}
+
+// Violation of rule by candle
+type Violation struct {
+	Rule      string
+	Action    Action
+	Period    uint
+	CloseTime int64
+	Err       error
+}
+
+// Report of batch validation
+type Report struct {
+	Total      int
+	Dropped    int
+	Rejected   bool
+	Violations []Violation
+}
+
+// Fields summary for structured logging
+func (r Report) Fields() logrus.Fields {
+	rules := map[string]int{}
+	for _, v := range r.Violations {
+		rules[v.Rule+"="+v.Action.String()]++
+	}
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	summary := make([]string, 0, len(names))
+	for _, name := range names {
+		summary = append(summary, fmt.Sprintf("%s:%d", name, rules[name]))
+	}
+	return logrus.Fields{
+		"validation_total":      r.Total,
+		"validation_dropped":    r.Dropped,
+		"validation_rejected":   r.Rejected,
+		"validation_violations": strings.Join(summary, ","),
+	}
+}
+
+// RejectError is returned when batch is rejected by rule
+type RejectError struct {
+	Violation Violation
+}
+
+// Error implements error interface
+func (re *RejectError) Error() string {
+	return fmt.Sprintf(
+		"Candles batch is rejected by rule %s: close_time=%d period=%d: %s",
+		re.Violation.Rule, re.Violation.CloseTime, re.Violation.Period, re.Violation.Err,
+	)
+}
+
+// Validate candles. Returns valid candles and report of violations.
+// Nil validator keeps all candles
+func (v *Validator) Validate(candlesData []*candles.Candle) ([]*candles.Candle, Report, error) {
+	report := Report{Total: len(candlesData)}
+	if v == nil {
+		return candlesData, report, nil
+	}
+
+	now := v.now()
+	valid := make([]*candles.Candle, 0, len(candlesData))
+	for _, c := range candlesData {
+		dropped := false
+		for _, vr := range v.rules {
+			err := vr.rule.Check(c, now)
+			if err == nil {
+				continue
+			}
+			violation := Violation{
+				Rule:      vr.rule.Name(),
+				Action:    vr.action,
+				Period:    c.Period,
+				CloseTime: c.CloseTime,
+				Err:       err,
+			}
+			report.Violations = append(report.Violations, violation)
+			switch vr.action {
+			case ActionReject:
+				report.Rejected = true
+				return nil, report, &RejectError{Violation: violation}
+			case ActionDrop:
+				dropped = true
+			}
+		}
+		if dropped {
+			report.Dropped++
+			continue
+		}
+		valid = append(valid, c)
+	}
+	return valid, report, nil
+}
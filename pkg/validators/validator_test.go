@@ -0,0 +1,132 @@
+package validators
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dneprix/ohlc/pkg/candles"
+)
+
+func TestParseAction(t *testing.T) {
+	for name, expected := range map[string]Action{"warn": ActionWarn, "drop": ActionDrop, "reject": ActionReject} {
+		actual, err := ParseAction(name)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, actual)
+		assert.Equal(t, name, actual.String())
+	}
+
+	_, err := ParseAction("skip")
+	assert.EqualError(t, err, `Unknown validation action: "skip"`)
+	assert.Equal(t, "Action(100)", Action(100).String())
+}
+
+func TestValidator_Add(t *testing.T) {
+	v := New().Add(HighLow, ActionDrop).Add(HighLow, ActionWarn)
+	assert.Len(t, v.rules, 1)
+	assert.Equal(t, ActionWarn, v.rules[0].action)
+}
+
+func TestValidator_SetActions(t *testing.T) {
+	v := Default()
+	assert.NoError(t, v.SetActions("aligned-close-time=warn, high-low=reject,"))
+	for _, vr := range v.rules {
+		switch vr.rule.Name() {
+		case "aligned-close-time":
+			assert.Equal(t, ActionWarn, vr.action)
+		case "high-low":
+			assert.Equal(t, ActionReject, vr.action)
+		}
+	}
+
+	assert.EqualError(t, v.SetActions("high-low"), `Parse validation action fail: "high-low"`)
+	assert.EqualError(t, v.SetActions("high-low=skip"), `Unknown validation action: "skip"`)
+	assert.EqualError(t, v.SetActions("unknown=drop"), `Unknown validation rule: "unknown"`)
+}
+
+func TestValidator_Validate(t *testing.T) {
+	v := Default()
+	v.now = func() time.Time { return time.Unix(1569563400, 0) }
+
+	negativeVolume := validCandle()
+	negativeVolume.Volume = candles.MustParseDecimal("-1")
+	future := validCandle()
+	future.CloseTime = 1569567000
+	candlesData := []*candles.Candle{validCandle(), negativeVolume, future}
+
+	actual, report, err := v.Validate(candlesData)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []*candles.Candle{candlesData[0]}, actual)
+	assert.Equal(t, 3, report.Total)
+	assert.Equal(t, 2, report.Dropped)
+	assert.False(t, report.Rejected)
+	assert.Len(t, report.Violations, 2)
+	assert.Equal(t, "non-negative-volume", report.Violations[0].Rule)
+	assert.Equal(t, ActionDrop, report.Violations[0].Action)
+	assert.Equal(t, int64(1569567000), report.Violations[1].CloseTime)
+	assert.Equal(t, logrus.Fields{
+		"validation_total":      3,
+		"validation_dropped":    2,
+		"validation_rejected":   false,
+		"validation_violations": "non-negative-volume=drop:1,not-future=drop:1",
+	}, report.Fields())
+}
+
+func TestValidator_ValidateWarn(t *testing.T) {
+	v := New().Add(HighLow, ActionWarn)
+
+	c := validCandle()
+	c.HighPrice = candles.MustParseDecimal("1")
+	actual, report, err := v.Validate([]*candles.Candle{c})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []*candles.Candle{c}, actual)
+	assert.Equal(t, 0, report.Dropped)
+	assert.Len(t, report.Violations, 1)
+}
+
+func TestValidator_ValidateReject(t *testing.T) {
+	v := Default().Add(AlignedCloseTime, ActionReject)
+
+	c := validCandle()
+	c.CloseTime = 1569563430
+	actual, report, err := v.Validate([]*candles.Candle{validCandle(), c})
+
+	assert.Nil(t, actual)
+	assert.True(t, report.Rejected)
+	assert.IsType(t, &RejectError{}, err)
+	assert.EqualError(t, err, "Candles batch is rejected by rule aligned-close-time: close_time=1569563430 period=60: close time 1569563430 is not aligned to period 60")
+}
+
+func TestValidator_ValidateAlignedDefault(t *testing.T) {
+	v := Default()
+	v.now = func() time.Time { return time.Unix(1569801600, 0) }
+
+	// Unfiltered Cryptowatch response has weekly candles
+	weekly := validCandle()
+	weekly.Period = 604800
+	weekly.CloseTime = 1569801600
+	unaligned := validCandle()
+	unaligned.CloseTime = 1569563430
+	actual, report, err := v.Validate([]*candles.Candle{validCandle(), weekly, unaligned})
+
+	// Unaligned candle is dropped without batch
+	assert.NoError(t, err)
+	assert.Equal(t, []*candles.Candle{validCandle(), weekly}, actual)
+	assert.False(t, report.Rejected)
+	assert.Equal(t, 1, report.Dropped)
+}
+
+func TestValidator_ValidateNil(t *testing.T) {
+	var v *Validator
+	candlesData := []*candles.Candle{{Period: 60, CloseTime: 1}}
+
+	actual, report, err := v.Validate(candlesData)
+
+	assert.NoError(t, err)
+	assert.Equal(t, candlesData, actual)
+	assert.Equal(t, Report{Total: 1}, report)
+}
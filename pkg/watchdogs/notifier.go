@@ -0,0 +1,162 @@
+package watchdogs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Alert about asset period which became stale or recovered
+type Alert struct {
+	Status
+	Threshold time.Duration `json:"-"`
+}
+
+// Subject of alert, e.g. "Stale candles: BTC/USD/KRAKEN period 60"
+func (a Alert) Subject() string {
+	state := "Stale"
+	if !a.Stale {
+		state = "Recovered"
+	}
+	return fmt.Sprintf("%s candles: %s period %d", state, a.Asset(), a.Period)
+}
+
+// Text of alert with newest close time
+func (a Alert) Text() string {
+	if a.CloseTime == 0 {
+		return fmt.Sprintf("%s\nNo candles are stored", a.Subject())
+	}
+	return fmt.Sprintf(
+		"%s\nNewest close time: %s (%s ago)\nThreshold: %s",
+		a.Subject(),
+		time.Unix(a.CloseTime, 0).UTC().Format(time.RFC3339),
+		time.Duration(a.Age)*time.Second,
+		a.Threshold,
+	)
+}
+
+// Notifier sends alerts
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// LogNotifier writes alerts to log
+type LogNotifier struct {
+	logger *logrus.Entry
+}
+
+// NewLogNotifier constructor
+func NewLogNotifier(logger *logrus.Logger) *LogNotifier {
+	return &LogNotifier{
+		logger: logger.WithFields(logrus.Fields{
+			"notifier": "log",
+		}),
+	}
+}
+
+// Notify implements Notifier interface
+func (ln *LogNotifier) Notify(ctx context.Context, alert Alert) error {
+	logger := ln.logger.WithFields(logrus.Fields{
+		"asset":      alert.Asset(),
+		"period":     alert.Period,
+		"close_time": alert.CloseTime,
+		"age":        alert.Age,
+	})
+	if alert.Stale {
+		logger.Warn(alert.Subject())
+	} else {
+		logger.Info(alert.Subject())
+	}
+	return nil
+}
+
+// webhookTimeout limits one webhook request, so hanging endpoint doesn't block watchdog checks
+const webhookTimeout = 10 * time.Second
+
+// WebhookNotifier posts alerts as JSON to URL
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookNotifier constructor
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+// webhookBody is a JSON body of webhook request
+type webhookBody struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	Status
+}
+
+// Notify implements Notifier interface
+func (wn *WebhookNotifier) Notify(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(webhookBody{
+		Subject: alert.Subject(),
+		Text:    alert.Text(),
+		Status:  alert.Status,
+	})
+	if err != nil {
+		return fmt.Errorf("Encode webhook body fail: %s", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, wn.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("Create webhook request fail: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := wn.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("Post webhook fail: %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("Webhook response status: %s", res.Status)
+	}
+	return nil
+}
+
+// SMTPNotifier sends alerts by email through SMTP relay without authentication
+type SMTPNotifier struct {
+	addr     string
+	from     string
+	to       []string
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewSMTPNotifier constructor
+func NewSMTPNotifier(addr, from string, to []string) *SMTPNotifier {
+	return &SMTPNotifier{
+		addr:     addr,
+		from:     from,
+		to:       to,
+		sendMail: smtp.SendMail,
+	}
+}
+
+// Notify implements Notifier interface. Context is not supported by net/smtp
+func (sn *SMTPNotifier) Notify(ctx context.Context, alert Alert) error {
+	msg := fmt.Sprintf(
+		"From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		sn.from,
+		strings.Join(sn.to, ", "),
+		alert.Subject(),
+		strings.Replace(alert.Text(), "\n", "\r\n", -1),
+	)
+	if err := sn.sendMail(sn.addr, nil, sn.from, sn.to, []byte(msg)); err != nil {
+		return fmt.Errorf("Send mail fail: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package watchdogs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+var testAlert = Alert{
+	Status: Status{
+		AssetID:   1,
+		CoinFrom:  "BTC",
+		CoinTo:    "USD",
+		Exchange:  "KRAKEN",
+		Period:    60,
+		CloseTime: 1569563400,
+		Age:       600,
+		Stale:     true,
+	},
+	Threshold: 5 * time.Minute,
+}
+
+func TestAlert_Subject(t *testing.T) {
+	assert.Equal(t, "Stale candles: BTC/USD/KRAKEN period 60", testAlert.Subject())
+
+	recovered := testAlert
+	recovered.Stale = false
+	assert.Equal(t, "Recovered candles: BTC/USD/KRAKEN period 60", recovered.Subject())
+}
+
+func TestAlert_Text(t *testing.T) {
+	assert.Equal(t,
+		"Stale candles: BTC/USD/KRAKEN period 60\nNewest close time: 2019-09-27T05:50:00Z (10m0s ago)\nThreshold: 5m0s",
+		testAlert.Text(),
+	)
+
+	empty := Alert{Status: Status{CoinFrom: "BTC", CoinTo: "USD", Exchange: "KRAKEN", Stale: true}}
+	assert.Equal(t, "Stale candles: BTC/USD/KRAKEN period 0\nNo candles are stored", empty.Text())
+}
+
+func TestLogNotifier_Notify(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	n := NewLogNotifier(logger)
+
+	assert.NoError(t, n.Notify(context.Background(), testAlert))
+	assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+	assert.Equal(t, "Stale candles: BTC/USD/KRAKEN period 60", hook.LastEntry().Message)
+	assert.Equal(t, "BTC/USD/KRAKEN", hook.LastEntry().Data["asset"])
+
+	recovered := testAlert
+	recovered.Stale = false
+	assert.NoError(t, n.Notify(context.Background(), recovered))
+	assert.Equal(t, logrus.InfoLevel, hook.LastEntry().Level)
+}
+
+func TestWebhookNotifier_Notify(t *testing.T) {
+	var body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer ts.Close()
+
+	n := NewWebhookNotifier(ts.URL)
+	assert.NoError(t, n.Notify(context.Background(), testAlert))
+	assert.JSONEq(t, `{
+      "subject": "Stale candles: BTC/USD/KRAKEN period 60",
+      "text": "Stale candles: BTC/USD/KRAKEN period 60\nNewest close time: 2019-09-27T05:50:00Z (10m0s ago)\nThreshold: 5m0s",
+      "asset_id": 1,
+      "coin_from": "BTC",
+      "coin_to": "USD",
+      "exchange": "KRAKEN",
+      "period": 60,
+      "close_time": 1569563400,
+      "age": 600,
+      "stale": true
+    }`, body)
+}
+
+func TestWebhookNotifier_NotifyTimeout(t *testing.T) {
+	release := make(chan (bool))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	n := NewWebhookNotifier(ts.URL)
+	assert.Equal(t, webhookTimeout, n.client.Timeout)
+	n.client.Timeout = 10 * time.Millisecond
+
+	err := n.Notify(context.Background(), testAlert)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Post webhook fail")
+}
+
+func TestWebhookNotifier_NotifyFail(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	err := NewWebhookNotifier(ts.URL).Notify(context.Background(), testAlert)
+	assert.EqualError(t, err, "Webhook response status: 502 Bad Gateway")
+
+	err = NewWebhookNotifier("http://invalid url").Notify(context.Background(), testAlert)
+	assert.Error(t, err)
+}
+
+func TestSMTPNotifier_Notify(t *testing.T) {
+	n := NewSMTPNotifier("localhost:25", "ohlc@example.com", []string{"ops@example.com", "dev@example.com"})
+	var sent string
+	n.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		assert.Equal(t, "localhost:25", addr)
+		assert.Nil(t, a)
+		assert.Equal(t, "ohlc@example.com", from)
+		assert.Equal(t, []string{"ops@example.com", "dev@example.com"}, to)
+		sent = string(msg)
+		return nil
+	}
+
+	assert.NoError(t, n.Notify(context.Background(), testAlert))
+	assert.Equal(t, "From: ohlc@example.com\r\n"+
+		"To: ops@example.com, dev@example.com\r\n"+
+		"Subject: Stale candles: BTC/USD/KRAKEN period 60\r\n"+
+		"Content-Type: text/plain; charset=UTF-8\r\n"+
+		"\r\n"+
+		"Stale candles: BTC/USD/KRAKEN period 60\r\n"+
+		"Newest close time: 2019-09-27T05:50:00Z (10m0s ago)\r\n"+
+		"Threshold: 5m0s\r\n", sent)
+}
+
+func TestSMTPNotifier_NotifyFail(t *testing.T) {
+	n := NewSMTPNotifier("localhost:25", "ohlc@example.com", []string{"ops@example.com"})
+	n.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		return fmt.Errorf("Connection refused")
+	}
+	assert.EqualError(t, n.Notify(context.Background(), testAlert), "Send mail fail: Connection refused")
+}
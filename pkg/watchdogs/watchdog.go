@@ -0,0 +1,183 @@
+package watchdogs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultInterval between freshness checks
+const DefaultInterval = time.Minute
+
+// Status of asset period freshness
+type Status struct {
+	AssetID   uint   `json:"asset_id" db:"asset_id"`
+	CoinFrom  string `json:"coin_from" db:"coin_from"`
+	CoinTo    string `json:"coin_to" db:"coin_to"`
+	Exchange  string `json:"exchange" db:"exchange"`
+	Period    uint   `json:"period" db:"period"`
+	CloseTime int64  `json:"close_time" db:"close_time"`
+	Age       int64  `json:"age"`
+	Stale     bool   `json:"stale"`
+}
+
+// Asset name of status, e.g. BTC/USD/KRAKEN
+func (s Status) Asset() string {
+	return fmt.Sprintf("%s/%s/%s", s.CoinFrom, s.CoinTo, s.Exchange)
+}
+
+// statusKey of asset period
+type statusKey struct {
+	assetID uint
+	period  uint
+}
+
+// Watchdog checks newest stored close time of asset periods against wall-clock.
+// Asset period is stale when its newest candle is older than period plus threshold.
+// Asset without any candles is stale too
+type Watchdog struct {
+	db        *sqlx.DB
+	logger    *logrus.Entry
+	threshold time.Duration
+	interval  time.Duration
+	notifiers []Notifier
+	now       func() time.Time
+
+	mu        sync.RWMutex
+	statuses  []Status
+	checkedAt time.Time
+}
+
+// NewWatchdog constructor
+func NewWatchdog(db *sqlx.DB, logger *logrus.Logger, threshold time.Duration) *Watchdog {
+	return &Watchdog{
+		db: db,
+		logger: logger.WithFields(logrus.Fields{
+			"watchdog": "freshness",
+		}),
+		threshold: threshold,
+		interval:  DefaultInterval,
+		now:       time.Now,
+	}
+}
+
+// Threshold of staleness over candle period
+func (w *Watchdog) Threshold() time.Duration {
+	return w.threshold
+}
+
+// Interval between checks
+func (w *Watchdog) Interval() time.Duration {
+	return w.interval
+}
+
+// SetInterval between checks
+func (w *Watchdog) SetInterval(interval time.Duration) {
+	w.interval = interval
+}
+
+// AddNotifier of stale and recovered assets
+func (w *Watchdog) AddNotifier(n Notifier) {
+	w.notifiers = append(w.notifiers, n)
+}
+
+// Statuses of the last check and its time. Zero time if there was no successful check
+func (w *Watchdog) Statuses() ([]Status, time.Time) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.statuses, w.checkedAt
+}
+
+// Run checks by interval until context is done
+func (w *Watchdog) Run(ctx context.Context) {
+	w.logger.Infof("Run watchdog: threshold=%s interval=%s", w.threshold, w.interval)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		if err := w.Check(ctx); err != nil {
+			w.logger.Errorf("Check freshness fail: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			w.logger.Warn("Watchdog is stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check freshness of all assets. Notifiers are called when asset period
+// becomes stale or recovers after being stale
+func (w *Watchdog) Check(ctx context.Context) error {
+	statuses, err := getNewest(ctx, w.db)
+	if err != nil {
+		return err
+	}
+
+	now := w.now()
+	for i := range statuses {
+		s := &statuses[i]
+		if s.CloseTime == 0 {
+			s.Stale = true
+			continue
+		}
+		age := now.Sub(time.Unix(s.CloseTime, 0))
+		s.Age = int64(age / time.Second)
+		s.Stale = age > time.Duration(s.Period)*time.Second+w.threshold
+	}
+
+	w.mu.Lock()
+	previous := make(map[statusKey]bool, len(w.statuses))
+	for _, s := range w.statuses {
+		previous[statusKey{s.AssetID, s.Period}] = s.Stale
+	}
+	w.statuses, w.checkedAt = statuses, now
+	w.mu.Unlock()
+
+	for _, s := range statuses {
+		// Asset period which is fresh since start is not notified
+		if previous[statusKey{s.AssetID, s.Period}] == s.Stale {
+			continue
+		}
+		w.notify(ctx, Alert{Status: s, Threshold: w.threshold})
+	}
+	return nil
+}
+
+// notify all notifiers. Failed notifier doesn't stop others
+func (w *Watchdog) notify(ctx context.Context, alert Alert) {
+	for _, n := range w.notifiers {
+		if err := n.Notify(ctx, alert); err != nil {
+			w.logger.WithFields(logrus.Fields{
+				"asset":  alert.Asset(),
+				"period": alert.Period,
+			}).Errorf("Notify fail: %s", err)
+		}
+	}
+}
+
+// getNewest close time of source candles for each asset period.
+// Asset without candles has zero period and close time
+func getNewest(ctx context.Context, db *sqlx.DB) ([]Status, error) {
+	statuses := []Status{}
+	sqls := `SELECT
+        a.id AS asset_id,
+        a.coin_from,
+        a.coin_to,
+        a.exchange,
+        coalesce(c.period, 0) AS period,
+        coalesce(extract(epoch FROM max(c.close_time)::timestamptz)::bigint, 0) AS close_time
+      FROM assets a
+      LEFT JOIN candles c ON c.asset_id=a.id AND NOT c.derived
+      GROUP BY a.id, c.period
+      ORDER BY a.id, c.period;
+      `
+	if err := db.SelectContext(ctx, &statuses, sqls); err != nil {
+		return nil, fmt.Errorf("Get newest close times fail: %s", err)
+	}
+	return statuses, nil
+}
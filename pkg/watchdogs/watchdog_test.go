@@ -0,0 +1,168 @@
+package watchdogs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockNotifier struct {
+	alerts []Alert
+	err    error
+}
+
+func (mn *mockNotifier) Notify(ctx context.Context, alert Alert) error {
+	mn.alerts = append(mn.alerts, alert)
+	return mn.err
+}
+
+var newestColumns = []string{"asset_id", "coin_from", "coin_to", "exchange", "period", "close_time"}
+
+func newTestWatchdog(t *testing.T) (*Watchdog, sqlmock.Sqlmock, *mockNotifier, func()) {
+	t.Helper()
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger, _ := test.NewNullLogger()
+	w := NewWatchdog(sqlx.NewDb(mockDB, "sqlmock"), logger, 5*time.Minute)
+	w.now = func() time.Time { return time.Unix(1569564000, 0) }
+	n := &mockNotifier{}
+	w.AddNotifier(n)
+	return w, mock, n, func() { mockDB.Close() }
+}
+
+func TestNewWatchdog(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	w := NewWatchdog(nil, logger, time.Minute)
+	assert.Equal(t, time.Minute, w.Threshold())
+	assert.Equal(t, DefaultInterval, w.Interval())
+	w.SetInterval(time.Second)
+	assert.Equal(t, time.Second, w.Interval())
+
+	statuses, checkedAt := w.Statuses()
+	assert.Nil(t, statuses)
+	assert.True(t, checkedAt.IsZero())
+}
+
+func TestWatchdog_Check(t *testing.T) {
+	w, mock, n, closeDB := newTestWatchdog(t)
+	defer closeDB()
+
+	mock.ExpectQuery("SELECT .+ coalesce\\(extract\\(epoch FROM max\\(c.close_time\\)::timestamptz\\)::bigint, 0\\) AS close_time FROM assets a LEFT JOIN candles c ON c.asset_id=a.id AND NOT c.derived").
+		WillReturnRows(sqlmock.NewRows(newestColumns).
+			AddRow(1, "BTC", "USD", "KRAKEN", 60, 1569563700).
+			AddRow(1, "BTC", "USD", "KRAKEN", 3600, 1569560400).
+			AddRow(2, "ETH", "USD", "KRAKEN", 60, 1569563400).
+			AddRow(3, "XRP", "USD", "KRAKEN", 0, 0))
+
+	assert.NoError(t, w.Check(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	statuses, checkedAt := w.Statuses()
+	assert.Equal(t, int64(1569564000), checkedAt.Unix())
+	assert.Equal(t, []Status{
+		{AssetID: 1, CoinFrom: "BTC", CoinTo: "USD", Exchange: "KRAKEN", Period: 60, CloseTime: 1569563700, Age: 300, Stale: false},
+		{AssetID: 1, CoinFrom: "BTC", CoinTo: "USD", Exchange: "KRAKEN", Period: 3600, CloseTime: 1569560400, Age: 3600, Stale: false},
+		{AssetID: 2, CoinFrom: "ETH", CoinTo: "USD", Exchange: "KRAKEN", Period: 60, CloseTime: 1569563400, Age: 600, Stale: true},
+		{AssetID: 3, CoinFrom: "XRP", CoinTo: "USD", Exchange: "KRAKEN", Stale: true},
+	}, statuses)
+
+	// Only stale asset periods are notified on first check
+	assert.Len(t, n.alerts, 2)
+	assert.Equal(t, "ETH/USD/KRAKEN", n.alerts[0].Asset())
+	assert.Equal(t, 5*time.Minute, n.alerts[0].Threshold)
+	assert.Equal(t, "XRP/USD/KRAKEN", n.alerts[1].Asset())
+}
+
+func TestWatchdog_CheckTransitions(t *testing.T) {
+	w, mock, n, closeDB := newTestWatchdog(t)
+	defer closeDB()
+
+	mock.ExpectQuery("SELECT .+ FROM assets").
+		WillReturnRows(sqlmock.NewRows(newestColumns).
+			AddRow(1, "BTC", "USD", "KRAKEN", 60, 1569563400).
+			AddRow(2, "ETH", "USD", "KRAKEN", 60, 1569563940))
+	mock.ExpectQuery("SELECT .+ FROM assets").
+		WillReturnRows(sqlmock.NewRows(newestColumns).
+			AddRow(1, "BTC", "USD", "KRAKEN", 60, 1569563400).
+			AddRow(2, "ETH", "USD", "KRAKEN", 60, 1569563940))
+	mock.ExpectQuery("SELECT .+ FROM assets").
+		WillReturnRows(sqlmock.NewRows(newestColumns).
+			AddRow(1, "BTC", "USD", "KRAKEN", 60, 1569564000).
+			AddRow(2, "ETH", "USD", "KRAKEN", 60, 1569563940))
+
+	assert.NoError(t, w.Check(context.Background()))
+	assert.Len(t, n.alerts, 1)
+	assert.True(t, n.alerts[0].Stale)
+
+	// Still stale asset is not notified again
+	assert.NoError(t, w.Check(context.Background()))
+	assert.Len(t, n.alerts, 1)
+
+	// Recovered asset is notified
+	assert.NoError(t, w.Check(context.Background()))
+	assert.Len(t, n.alerts, 2)
+	assert.Equal(t, "BTC/USD/KRAKEN", n.alerts[1].Asset())
+	assert.False(t, n.alerts[1].Stale)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWatchdog_CheckFail(t *testing.T) {
+	w, mock, n, closeDB := newTestWatchdog(t)
+	defer closeDB()
+
+	mock.ExpectQuery("SELECT .+ FROM assets").WillReturnError(fmt.Errorf("DB error"))
+
+	err := w.Check(context.Background())
+	assert.EqualError(t, err, "Get newest close times fail: DB error")
+	assert.Len(t, n.alerts, 0)
+	_, checkedAt := w.Statuses()
+	assert.True(t, checkedAt.IsZero())
+}
+
+func TestWatchdog_CheckNotifyFail(t *testing.T) {
+	w, mock, n, closeDB := newTestWatchdog(t)
+	defer closeDB()
+	n.err = fmt.Errorf("Notify error")
+	other := &mockNotifier{}
+	w.AddNotifier(other)
+
+	mock.ExpectQuery("SELECT .+ FROM assets").
+		WillReturnRows(sqlmock.NewRows(newestColumns).AddRow(1, "BTC", "USD", "KRAKEN", 60, 1569563400))
+
+	assert.NoError(t, w.Check(context.Background()))
+	assert.Len(t, n.alerts, 1)
+	assert.Len(t, other.alerts, 1)
+}
+
+func TestWatchdog_Run(t *testing.T) {
+	w, mock, _, closeDB := newTestWatchdog(t)
+	defer closeDB()
+	w.SetInterval(time.Millisecond)
+
+	mock.ExpectQuery("SELECT .+ FROM assets").WillReturnRows(sqlmock.NewRows(newestColumns))
+	mock.ExpectQuery("SELECT .+ FROM assets").WillReturnRows(sqlmock.NewRows(newestColumns))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan (bool))
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run was not stopped")
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}